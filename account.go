@@ -0,0 +1,111 @@
+package ldap
+
+// noinspection GoRedundantImportAlias
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	ldap "github.com/go-ldap/ldap/v3"
+	"github.com/pkg/errors"
+)
+
+const (
+	uacLockout            = 0x10
+	uacDontExpirePassword = 0x10000
+	uacPasswordExpired    = 0x800000
+	// AD computes lockout and password expiry for the domain policy, it is returned only when asked for
+	attrUACComputed = "msDS-User-Account-Control-Computed"
+)
+
+// Account state errors, Auth returns them when WithAccountCheck is set
+var (
+	ErrAccountDisabled    = errors.New("ldap account is disabled")
+	ErrAccountLocked      = errors.New("ldap account is locked")
+	ErrAccountExpired     = errors.New("ldap account is expired")
+	ErrPasswordExpired    = errors.New("ldap password is expired")
+	ErrPasswordMustChange = errors.New("ldap password must be changed")
+)
+
+// AccountStatus is decoded from userAccountControl, msDS-User-Account-Control-Computed, lockoutTime,
+// accountExpires and pwdLastSet on AD and from the password policy overlay attributes on other servers
+type AccountStatus struct {
+	Disabled             bool
+	Locked               bool
+	Expired              bool
+	PasswordExpired      bool
+	MustChangePassword   bool
+	PasswordNeverExpires bool
+	LockedAt             time.Time
+	ExpiresAt            time.Time
+	PasswordSetAt        time.Time
+}
+
+// Err is the first reason the account can not log on, nil for an active account
+func (s AccountStatus) Err() error {
+	switch {
+	case s.Disabled:
+		return ErrAccountDisabled
+	case s.Locked:
+		return ErrAccountLocked
+	case s.Expired:
+		return ErrAccountExpired
+	case s.PasswordExpired:
+		return ErrPasswordExpired
+	case s.MustChangePassword:
+		return ErrPasswordMustChange
+	}
+	return nil
+}
+
+// DecodeAccountStatus reads the account state of a user entry as of now
+func DecodeAccountStatus(ent *ldap.Entry, now time.Time) (s AccountStatus) {
+	uac, hasUAC := intValue(ent, "userAccountControl")
+	computed, hasComputed := intValue(ent, attrUACComputed)
+	s.Disabled = uac&uacAccountDisable != 0 || strings.EqualFold(value(ent, "nsAccountLock"), "true")
+	s.PasswordNeverExpires = uac&uacDontExpirePassword != 0
+	s.LockedAt = timeValue(ent, "lockoutTime")
+	if v := value(ent, "pwdAccountLockedTime"); v != "" {
+		// 000001010000Z is the permanent lock of the password policy overlay
+		s.Locked = true
+		s.LockedAt = timeValue(ent, "pwdAccountLockedTime")
+	}
+	if hasComputed {
+		s.Locked = s.Locked || computed&uacLockout != 0
+		s.PasswordExpired = computed&uacPasswordExpired != 0
+	} else {
+		// without the computed flags the lockout duration is unknown, a lockout time means locked
+		s.Locked = s.Locked || !s.LockedAt.IsZero() || uac&uacLockout != 0
+		s.PasswordExpired = uac&uacPasswordExpired != 0
+	}
+	s.ExpiresAt = timeValue(ent, "accountExpires")
+	s.Expired = !s.ExpiresAt.IsZero() && !s.ExpiresAt.After(now)
+	s.PasswordSetAt = timeValue(ent, "pwdLastSet")
+	if s.PasswordSetAt.IsZero() {
+		s.PasswordSetAt = timeValue(ent, "pwdChangedTime")
+	}
+	pwdLastSet, hasPwdLastSet := intValue(ent, "pwdLastSet")
+	s.MustChangePassword = hasUAC && hasPwdLastSet && pwdLastSet == 0 ||
+		strings.EqualFold(value(ent, "pwdReset"), "true")
+	return
+}
+
+func value(ent *ldap.Entry, name string) string {
+	if a := attribute(ent, name); a != nil && len(a.Values) > 0 {
+		return strings.TrimSpace(a.Values[0])
+	}
+	return ""
+}
+
+func intValue(ent *ldap.Entry, name string) (int64, bool) {
+	n, err := strconv.ParseInt(value(ent, name), 10, 64)
+	return n, err == nil
+}
+
+func timeValue(ent *ldap.Entry, name string) time.Time {
+	t, err := parseTime(value(ent, name))
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
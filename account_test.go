@@ -0,0 +1,169 @@
+package ldap
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	ldap "github.com/go-ldap/ldap/v3"
+	"github.com/pkg/errors"
+
+	"github.com/shubinmi/ldap/ldaptest"
+)
+
+const accountsLDIF = `dn: dc=acc,dc=test
+objectClass: domain
+dc: acc
+
+dn: cn=admin,dc=acc,dc=test
+objectClass: organizationalPerson
+cn: admin
+sAMAccountName: admin
+userPassword: adminPass
+
+dn: cn=active,dc=acc,dc=test
+objectClass: organizationalPerson
+cn: active
+sAMAccountName: active
+userAccountControl: 66048
+pwdLastSet: 132473664000000000
+accountExpires: 9223372036854775807
+userPassword: pass
+
+dn: cn=disabled,dc=acc,dc=test
+objectClass: organizationalPerson
+cn: disabled
+sAMAccountName: disabled
+userAccountControl: 514
+userPassword: pass
+
+dn: cn=locked,dc=acc,dc=test
+objectClass: organizationalPerson
+cn: locked
+sAMAccountName: locked
+userAccountControl: 512
+msDS-User-Account-Control-Computed: 16
+lockoutTime: 132473664000000000
+userPassword: pass
+
+dn: cn=expired,dc=acc,dc=test
+objectClass: organizationalPerson
+cn: expired
+sAMAccountName: expired
+userAccountControl: 512
+accountExpires: 132473664000000000
+userPassword: pass
+
+dn: cn=reset,dc=acc,dc=test
+objectClass: organizationalPerson
+cn: reset
+sAMAccountName: reset
+userAccountControl: 512
+pwdLastSet: 0
+userPassword: pass
+`
+
+func TestDecodeAccountStatus(t *testing.T) {
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	filetime := "132473664000000000" // 2020-10-17
+	tests := []struct {
+		name  string
+		attrs map[string][]string
+		want  AccountStatus
+	}{
+		{
+			name:  "active",
+			attrs: map[string][]string{"userAccountControl": {"66048"}, "pwdLastSet": {filetime}, "accountExpires": {"0"}},
+			want:  AccountStatus{PasswordNeverExpires: true, PasswordSetAt: time.Date(2020, 10, 17, 0, 0, 0, 0, time.UTC)},
+		},
+		{
+			name:  "disabled",
+			attrs: map[string][]string{"userAccountControl": {"514"}},
+			want:  AccountStatus{Disabled: true},
+		},
+		{
+			name: "lockout expired",
+			attrs: map[string][]string{"userAccountControl": {"512"}, "lockoutTime": {filetime},
+				attrUACComputed: {"0"}},
+			want: AccountStatus{LockedAt: time.Date(2020, 10, 17, 0, 0, 0, 0, time.UTC)},
+		},
+		{
+			name:  "locked without computed",
+			attrs: map[string][]string{"userAccountControl": {"512"}, "lockoutTime": {filetime}},
+			want:  AccountStatus{Locked: true, LockedAt: time.Date(2020, 10, 17, 0, 0, 0, 0, time.UTC)},
+		},
+		{
+			name:  "password expired",
+			attrs: map[string][]string{"userAccountControl": {"512"}, attrUACComputed: {"8388608"}},
+			want:  AccountStatus{PasswordExpired: true},
+		},
+		{
+			name:  "account expired",
+			attrs: map[string][]string{"userAccountControl": {"512"}, "accountExpires": {filetime}},
+			want:  AccountStatus{Expired: true, ExpiresAt: time.Date(2020, 10, 17, 0, 0, 0, 0, time.UTC)},
+		},
+		{
+			name:  "must change",
+			attrs: map[string][]string{"userAccountControl": {"512"}, "pwdLastSet": {"0"}},
+			want:  AccountStatus{MustChangePassword: true},
+		},
+		{
+			name: "password policy overlay",
+			attrs: map[string][]string{"pwdAccountLockedTime": {"000001010000Z"}, "pwdReset": {"TRUE"},
+				"pwdChangedTime": {"20201017000000Z"}},
+			want: AccountStatus{Locked: true, MustChangePassword: true,
+				PasswordSetAt: time.Date(2020, 10, 17, 0, 0, 0, 0, time.UTC)},
+		},
+		{
+			name: "not an account",
+			want: AccountStatus{},
+		},
+	}
+	for _, test := range tests {
+		tt := test
+		t.Run(tt.name, func(t *testing.T) {
+			got := DecodeAccountStatus(ldap.NewEntry("cn=x", tt.attrs), now)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DecodeAccountStatus() got = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClient_AccountCheck(t *testing.T) {
+	srv := testServer(t, ldaptest.WithLDIF(accountsLDIF))
+	defer srv.Close()
+	admin := WithAdmin("admin", "adminPass")
+	plain, checked := testClient(t, srv, admin), testClient(t, srv, admin, WithAccountCheck())
+	defer plain.Close()
+	defer checked.Close()
+	tests := []struct {
+		login   string
+		wantErr error
+	}{
+		{login: "active"},
+		{login: "disabled", wantErr: ErrAccountDisabled},
+		{login: "locked", wantErr: ErrAccountLocked},
+		{login: "expired", wantErr: ErrAccountExpired},
+		{login: "reset", wantErr: ErrPasswordMustChange},
+	}
+	for _, test := range tests {
+		tt := test
+		t.Run(tt.login, func(t *testing.T) {
+			u, err := checked.Auth(tt.login, "pass")
+			if errors.Cause(err) != tt.wantErr {
+				t.Errorf("Auth() with check error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if u.Status.Err() != tt.wantErr {
+				t.Errorf("Auth() user status = %+v, want %v", u.Status, tt.wantErr)
+			}
+			if _, err = plain.Auth(tt.login, "pass"); err != nil {
+				t.Errorf("Auth() without check unexpected error = %v", err)
+			}
+			// the status is not told without the password
+			if _, err = checked.Auth(tt.login, "wrong"); !errors.Is(err, ErrInvalidCredentials) {
+				t.Errorf("Auth() with a wrong password error = %v, want %v", err, ErrInvalidCredentials)
+			}
+		})
+	}
+}
@@ -1,6 +1,11 @@
 package agent
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/shubinmi/ldap"
+)
 
 type LdapMsg struct {
 	GUID   string
@@ -19,23 +24,60 @@ type RPCAuth struct {
 	Pass  string
 }
 
+// RPCUser is ldap.User on the wire, MemberOf stays the JSON encoded string older peers expect
+type RPCUser struct {
+	ldap.User
+	MemberOf string
+}
+
+func ToRPCUser(u ldap.User) RPCUser {
+	memberOf := u.MemberOf
+	if memberOf == nil {
+		memberOf = []string{}
+	}
+	bt, _ := json.Marshal(memberOf)
+	return RPCUser{User: u, MemberOf: string(bt)}
+}
+
+func toRPCUsers(us []ldap.User) []RPCUser {
+	res := make([]RPCUser, 0, len(us))
+	for _, u := range us {
+		res = append(res, ToRPCUser(u))
+	}
+	return res
+}
+
+// RPCPag selects a page: PageNum rescans from the start, Cursor continues where the previous call stopped.
+// A request with Cursor set, "" for the first page, gets an RPCPage back instead of the bare list.
+// The agent keeps the scan of a cursor open for a minute, a later cursor is resumed by the server cookie, which it
+// may refuse. Users of several units or read from member lists have no cookie, only the open scan continues them.
 type RPCPag struct {
 	PerPage uint32
 	PageNum uint32
+	Cursor  *string
 }
 
 type RPCPagGql struct {
 	PerPage int
 	PageNum int
+	Cursor  *string
 }
 
 func (p RPCPagGql) ToPag() RPCPag {
 	return RPCPag{
 		PerPage: uint32(p.PerPage),
 		PageNum: uint32(p.PageNum),
+		Cursor:  p.Cursor,
 	}
 }
 
+// RPCPage is a page read by cursor, NextCursor is passed back as Cursor for the next one
+type RPCPage struct {
+	Items      interface{} `json:"items"`
+	NextCursor string      `json:"nextCursor"`
+	HasMore    bool        `json:"hasMore"`
+}
+
 type RPCNodeUsers struct {
 	ID     string
 	Pag    RPCPag
@@ -2,15 +2,29 @@ package agent
 
 import (
 	"encoding/json"
+	"fmt"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/shubinmi/ldap"
 )
 
+// scanIdleTTL is how long the scanner of a cursor walk waits for its next page before it is closed
+const scanIdleTTL = time.Minute
+
 type rpcClient struct {
 	client *ldap.Client
 	funcs  map[string]RPCFunc
+	mtx    sync.Mutex
+	// scans are the open scanners of cursor walks by the cursor of their next page
+	scans map[string]*openScan
+}
+
+type openScan struct {
+	sc    ldap.ResultsScanner
+	timer *time.Timer
 }
 
 const (
@@ -92,7 +106,7 @@ func (r *rpcClient) auth(params string) (data string, err error) {
 	if err != nil {
 		return
 	}
-	d, err := json.Marshal(u)
+	d, err := json.Marshal(ToRPCUser(u))
 	if err != nil {
 		return
 	}
@@ -102,7 +116,7 @@ func (r *rpcClient) auth(params string) (data string, err error) {
 
 func (r *rpcClient) nodes(params string,
 	retriever func(pageSize uint32) (ldap.ResultsScanner, error),
-	result func(scanner func(setter func(res interface{}))) interface{}) (data string, err error) {
+	result func(scanner func(setter func(res interface{}) error)) interface{}) (data string, err error) {
 	defer func() {
 		if err != nil {
 			err = errors.Wrap(err, "rpc nodes")
@@ -113,24 +127,10 @@ func (r *rpcClient) nodes(params string,
 	if err != nil {
 		return
 	}
-	sc, err := retriever(pag.PerPage)
+	res, err := r.page(func() (ldap.ResultsScanner, error) { return retriever(pag.PerPage) }, pag, result)
 	if err != nil {
 		return
 	}
-	var res interface{}
-	var i uint32 = 0
-	for sc.Next() {
-		i++
-		if i < pag.PageNum {
-			continue
-		}
-		res = result(sc.Scan)
-		if sc.LastErr() != nil {
-			err = sc.LastErr()
-			return
-		}
-		break
-	}
 
 	d, err := json.Marshal(res)
 	if err != nil {
@@ -143,7 +143,7 @@ func (r *rpcClient) nodes(params string,
 func (r *rpcClient) groups(params string) (data string, err error) {
 	return r.nodes(params,
 		r.client.Groups,
-		func(scanner func(setter func(res interface{}))) interface{} {
+		func(scanner func(setter func(res interface{}) error)) interface{} {
 			res := make([]ldap.Group, 0)
 			scanner(ldap.GroupsSetter(&res))
 			return res
@@ -153,7 +153,7 @@ func (r *rpcClient) groups(params string) (data string, err error) {
 func (r *rpcClient) units(params string) (data string, err error) {
 	return r.nodes(params,
 		r.client.OrganizationalUnits,
-		func(scanner func(setter func(res interface{}))) interface{} {
+		func(scanner func(setter func(res interface{}) error)) interface{} {
 			res := make([]ldap.Unit, 0)
 			scanner(ldap.UnitsSetter(&res))
 			return res
@@ -189,24 +189,12 @@ func (r *rpcClient) groupUsers(params string) (data string, err error) {
 	if err != nil {
 		return
 	}
-	sc, err := r.client.GroupUsers(rUsers.ID, rUsers.Pag.PerPage)
+	res, err := r.page(func() (ldap.ResultsScanner, error) {
+		return r.client.GroupUsers(rUsers.ID, rUsers.Pag.PerPage)
+	}, rUsers.Pag, usersResult(rUsers.Pag.PerPage))
 	if err != nil {
 		return
 	}
-	res := make([]ldap.User, 0, rUsers.Pag.PerPage)
-	var i uint32 = 0
-	for sc.Next() {
-		i++
-		if i < rUsers.Pag.PageNum {
-			continue
-		}
-		sc.Scan(ldap.UsersSetter(&res))
-		if sc.LastErr() != nil {
-			err = sc.LastErr()
-			return
-		}
-		break
-	}
 
 	d, err := json.Marshal(res)
 	if err != nil {
@@ -228,24 +216,12 @@ func (r *rpcClient) unitUsers(params string) (data string, err error) {
 		return
 	}
 	ouNames := strings.Split(rUsers.ID, ";")
-	sc, err := r.client.OUUsers(rUsers.Pag.PerPage, ouNames...)
+	res, err := r.page(func() (ldap.ResultsScanner, error) {
+		return r.client.OUUsers(rUsers.Pag.PerPage, ouNames...)
+	}, rUsers.Pag, usersResult(rUsers.Pag.PerPage))
 	if err != nil {
 		return
 	}
-	res := make([]ldap.User, 0, rUsers.Pag.PerPage)
-	var i uint32 = 0
-	for sc.Next() {
-		i++
-		if i < rUsers.Pag.PageNum {
-			continue
-		}
-		sc.Scan(ldap.UsersSetter(&res))
-		if sc.LastErr() != nil {
-			err = sc.LastErr()
-			return
-		}
-		break
-	}
 
 	d, err := json.Marshal(res)
 	if err != nil {
@@ -254,3 +230,114 @@ func (r *rpcClient) unitUsers(params string) (data string, err error) {
 	data = string(d)
 	return data, err
 }
+
+// page reads the page pag asks for: by cursor into an RPCPage, or the legacy way by scanning up to PageNum.
+// A cursor walk keeps its scanner open between the calls, so the next page continues on the connection of its cookie.
+func (r *rpcClient) page(open func() (ldap.ResultsScanner, error), pag RPCPag,
+	result func(scanner func(setter func(res interface{}) error)) interface{}) (interface{}, error) {
+	// an empty list rather than null when there is no such page
+	res := result(func(func(res interface{}) error) {})
+	if pag.Cursor == nil {
+		sc, err := open()
+		if err != nil {
+			return nil, err
+		}
+		defer sc.Close()
+		var i uint32 = 0
+		for sc.Next() {
+			i++
+			if i < pag.PageNum {
+				continue
+			}
+			res = result(sc.Scan)
+			if sc.LastErr() != nil {
+				return nil, sc.LastErr()
+			}
+			break
+		}
+		return res, nil
+	}
+	sc := r.takeScan(*pag.Cursor, pag.PerPage)
+	if sc == nil {
+		var err error
+		if sc, err = open(); err != nil {
+			return nil, err
+		}
+		if *pag.Cursor != "" {
+			if err = sc.Resume(*pag.Cursor); err != nil {
+				sc.Close()
+				return nil, err
+			}
+		}
+	}
+	if sc.Next() {
+		res = result(sc.Scan)
+	}
+	if sc.LastErr() != nil {
+		sc.Close()
+		return nil, sc.LastErr()
+	}
+	next := sc.Cursor()
+	if next == "" {
+		sc.Close()
+	} else {
+		r.keepScan(next, pag.PerPage, sc)
+	}
+	return RPCPage{Items: res, NextCursor: next, HasMore: next != ""}, nil
+}
+
+func scanKey(cursor string, perPage uint32) string {
+	return fmt.Sprintf("%d:%s", perPage, cursor)
+}
+
+// takeScan returns the open scanner of cursor, nil when there is none
+func (r *rpcClient) takeScan(cursor string, perPage uint32) ldap.ResultsScanner {
+	if cursor == "" {
+		return nil
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	key := scanKey(cursor, perPage)
+	held, ok := r.scans[key]
+	if !ok {
+		return nil
+	}
+	held.timer.Stop()
+	delete(r.scans, key)
+	return held.sc
+}
+
+// keepScan holds sc for the page of cursor, it is closed when that page is not asked for within scanIdleTTL
+func (r *rpcClient) keepScan(cursor string, perPage uint32, sc ldap.ResultsScanner) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if r.scans == nil {
+		r.scans = make(map[string]*openScan)
+	}
+	key := scanKey(cursor, perPage)
+	if prev, ok := r.scans[key]; ok {
+		prev.timer.Stop()
+		prev.sc.Close()
+	}
+	held := &openScan{sc: sc}
+	held.timer = time.AfterFunc(scanIdleTTL, func() {
+		r.mtx.Lock()
+		idle := r.scans[key] == held
+		if idle {
+			delete(r.scans, key)
+		}
+		r.mtx.Unlock()
+		if idle {
+			sc.Close()
+		}
+	})
+	r.scans[key] = held
+}
+
+func usersResult(perPage uint32) func(scanner func(setter func(res interface{}) error)) interface{} {
+	return func(scanner func(setter func(res interface{}) error)) interface{} {
+		res := make([]ldap.User, 0, perPage)
+		scanner(ldap.UsersSetter(&res))
+		return toRPCUsers(res)
+	}
+}
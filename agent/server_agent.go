@@ -7,6 +7,7 @@ import (
 	"log"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -36,12 +37,16 @@ type mapRPC map[string]chan<- LdapResp
 type agentServer struct {
 	connOps chan func(mapWsConn)
 	rpcOps  chan func(mapRPC)
+	// closed stops the op loops, the op channels stay open for senders still running
+	closed    chan struct{}
+	closeOnce sync.Once
 }
 
 func newAgentServer() *agentServer {
 	a := &agentServer{
-		connOps: make(chan func(conn mapWsConn), 1),
-		rpcOps:  make(chan func(conn mapRPC), 1),
+		connOps: make(chan func(conn mapWsConn)),
+		rpcOps:  make(chan func(conn mapRPC)),
+		closed:  make(chan struct{}),
 	}
 	go a.serveRPC()
 	go a.serveConnOps()
@@ -53,9 +58,7 @@ func (a *agentServer) Send(id string, msg LdapMsg, response chan<- LdapResp) (er
 	if msg.GUID == "" {
 		msg.GUID = uuid.NewV4().String()
 	}
-	done := make(chan struct{})
-	a.connOps <- func(cs mapWsConn) {
-		defer close(done)
+	ok := a.withConns(func(cs mapWsConn) {
 		wss, ok := cs[id]
 		if !ok {
 			err = errs.WithState(ErrNoAgent, "cannot find conn with id: "+id)
@@ -89,8 +92,10 @@ func (a *agentServer) Send(id string, msg LdapMsg, response chan<- LdapResp) (er
 		if response != nil {
 			a.rpcResponded(msg.GUID)
 		}
+	})
+	if !ok {
+		return errs.WithState(ErrNoAgent, "agent server is closed")
 	}
-	<-done
 	return err
 }
 
@@ -125,7 +130,10 @@ func (a *agentServer) Handler(w http.ResponseWriter, r *http.Request) {
 		}
 	}()
 
-	seed := a.addConn(id, conn)
+	seed, ok := a.addConn(id, conn)
+	if !ok {
+		return
+	}
 	defer a.removeConn(id, seed)
 	err = a.serveConn(conn)
 	if err != nil {
@@ -135,9 +143,7 @@ func (a *agentServer) Handler(w http.ResponseWriter, r *http.Request) {
 }
 
 func (a *agentServer) removeConn(id, seed string) {
-	done := make(chan struct{})
-	a.connOps <- func(cs mapWsConn) {
-		defer close(done)
+	a.withConns(func(cs mapWsConn) {
 		_, ok := cs[id]
 		if !ok {
 			return
@@ -151,23 +157,20 @@ func (a *agentServer) removeConn(id, seed string) {
 			return
 		}
 		delete(cs, id)
-	}
-	<-done
+	})
 }
 
-func (a *agentServer) addConn(id string, conn *websocket.Conn) (seed string) {
-	done := make(chan struct{})
+// addConn is not served when the server is closed and conn is not kept
+func (a *agentServer) addConn(id string, conn *websocket.Conn) (seed string, served bool) {
 	seed = fmt.Sprint(time.Now()) + fmt.Sprint(rand.Intn(maxRand))
-	a.connOps <- func(cs mapWsConn) {
-		defer close(done)
+	served = a.withConns(func(cs mapWsConn) {
 		_, ok := cs[id]
 		if !ok {
 			cs[id] = map[string]*websocket.Conn{seed: conn}
 			return
 		}
 		cs[id][seed] = conn
-	}
-	<-done
+	})
 	return
 }
 
@@ -223,9 +226,7 @@ func (a *agentServer) deliverRPCRespond(msg []byte) (err error) {
 	if e := json.Unmarshal(msg, &res); e != nil {
 		return errors.Wrapf(e, "wrong response format; msg: %s", string(msg))
 	}
-	done := make(chan struct{})
-	a.rpcOps <- func(rpc mapRPC) {
-		defer close(done)
+	if !a.withRPC(func(rpc mapRPC) {
 		defer func() {
 			if r := recover(); r != nil {
 				err = errors.Errorf(fmt.Sprint("recovered in deliverRPCRespond", r)+"; msg: %s", string(msg))
@@ -237,53 +238,94 @@ func (a *agentServer) deliverRPCRespond(msg []byte) (err error) {
 			return
 		}
 		sender <- res
+	}) {
+		return errors.New("agent server is closed")
 	}
-	<-done
 	a.rpcResponded(res.GUID)
 	return
 }
 
 func (a *agentServer) rpcResponded(guid string) {
-	done := make(chan struct{})
-	a.rpcOps <- func(rpc mapRPC) {
-		defer close(done)
+	a.withRPC(func(rpc mapRPC) {
 		if _, ok := rpc[guid]; !ok {
 			return
 		}
 		delete(rpc, guid)
-	}
-	<-done
+	})
 }
 
 func (a *agentServer) withRPCRespond(guid string, response chan<- LdapResp) (err error) {
-	done := make(chan struct{})
-	a.rpcOps <- func(rpc mapRPC) {
-		defer close(done)
+	if !a.withRPC(func(rpc mapRPC) {
 		if _, ok := rpc[guid]; ok {
 			err = errors.New("guid rpc already exist: " + guid)
 			return
 		}
 		rpc[guid] = response
+	}) {
+		return errors.New("agent server is closed")
 	}
-	<-done
 	return
 }
 
+// withConns runs op in the connections loop and waits for it, false when the server is closed
+func (a *agentServer) withConns(op func(mapWsConn)) bool {
+	done := make(chan struct{})
+	select {
+	case a.connOps <- func(cs mapWsConn) {
+		defer close(done)
+		op(cs)
+	}:
+	case <-a.closed:
+		return false
+	}
+	<-done
+	return true
+}
+
+// withRPC runs op in the rpc loop and waits for it, false when the server is closed
+func (a *agentServer) withRPC(op func(mapRPC)) bool {
+	done := make(chan struct{})
+	select {
+	case a.rpcOps <- func(rpc mapRPC) {
+		defer close(done)
+		op(rpc)
+	}:
+	case <-a.closed:
+		return false
+	}
+	<-done
+	return true
+}
+
 func (a *agentServer) serveRPC() {
 	rs := make(mapRPC)
-	for op := range a.rpcOps {
-		op(rs)
-	}
-	for id := range rs {
-		delete(rs, id)
+	for {
+		select {
+		case op := <-a.rpcOps:
+			op(rs)
+		case <-a.closed:
+			for id := range rs {
+				delete(rs, id)
+			}
+			return
+		}
 	}
 }
 
 func (a *agentServer) serveConnOps() {
 	cs := make(mapWsConn)
-	for op := range a.connOps {
-		op(cs)
+	for {
+		select {
+		case op := <-a.connOps:
+			op(cs)
+		case <-a.closed:
+			closeConns(cs)
+			return
+		}
 	}
+}
+
+func closeConns(cs mapWsConn) {
 	for id := range cs {
 		for seed, c := range cs[id] {
 			if c != nil {
@@ -297,7 +339,8 @@ func (a *agentServer) serveConnOps() {
 }
 
 func (a *agentServer) Close() {
-	log.Println("agent close")
-	close(a.rpcOps)
-	close(a.connOps)
+	a.closeOnce.Do(func() {
+		log.Println("agent close")
+		close(a.closed)
+	})
 }
@@ -2,6 +2,8 @@ package agent
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"net/http"
 	"os"
 	"reflect"
@@ -10,15 +12,42 @@ import (
 	"time"
 
 	"github.com/shubinmi/ldap"
+	"github.com/shubinmi/ldap/ldaptest"
 	"github.com/spf13/viper"
 )
 
+const testsConf = "../tests_conf.json"
+
 func TestMain(m *testing.M) {
-	viper.SetConfigFile("../tests_conf.json")
-	if e := viper.ReadInConfig(); e != nil {
-		panic(e)
+	if _, e := os.Stat(testsConf); e == nil {
+		viper.SetConfigFile(testsConf)
+		if e := viper.ReadInConfig(); e != nil {
+			panic(e)
+		}
+		os.Exit(m.Run())
+	}
+	srv, err := ldaptest.NewServer(ldaptest.WithLDIFFile("../testdata/directory.ldif"))
+	if err != nil {
+		panic(err)
 	}
-	os.Exit(m.Run())
+	viper.Set("ldap.url", srv.URL())
+	viper.Set("ldap.dn", srv.BaseDN())
+	viper.Set("ldap.user", `corp\test.user`)
+	viper.Set("ldap.pass", "testPass")
+	viper.Set("tests.server.auth.params", `{"login":"corp\\test.user","pass":"testPass"}`)
+	viper.Set("tests.server.auth.data", `{"Name":"Test User",`+
+		`"DN":"CN=Test User,OU=Users,OU=St-Petersburg,OU=Staff,DC=corp,DC=test,DC=com",`+
+		`"CN":"Test User","Mail":"test.user@test.com","Phone":"","Logon":"test.user","GUID":"","SID":"",`+
+		`"Title":"","Department":"","Company":"","Manager":"","EmployeeID":"","GivenName":"","Surname":"",`+
+		`"WhenCreated":"0001-01-01T00:00:00Z","WhenChanged":"0001-01-01T00:00:00Z","LastLogon":"0001-01-01T00:00:00Z",`+
+		`"Status":{"Disabled":false,"Locked":false,"Expired":false,"PasswordExpired":false,`+
+		`"MustChangePassword":false,"PasswordNeverExpires":false,"LockedAt":"0001-01-01T00:00:00Z",`+
+		`"ExpiresAt":"0001-01-01T00:00:00Z","PasswordSetAt":"0001-01-01T00:00:00Z"},"Attributes":null,`+
+		`"MemberOf":"[\"CN=Clients,OU=Products,OU=Service Accounts,DC=corp,DC=test,DC=com\",`+
+		`\"CN=Staff,OU=Staff,DC=corp,DC=test,DC=com\"]"}`)
+	code := m.Run()
+	srv.Close()
+	os.Exit(code)
 }
 
 func TestLdapServer_RPC(t *testing.T) {
@@ -108,3 +137,110 @@ func TestLdapServer_RPC(t *testing.T) {
 	cancel()
 	wg.Wait()
 }
+
+func TestRPCClient_Cursor(t *testing.T) {
+	const group = "CN=Clients,OU=Products,OU=Service Accounts,DC=corp,DC=test,DC=com"
+	// with several idle connections a page taken from the pool would land on another one than its cookie
+	tests := []struct {
+		name     string
+		min, max int
+	}{
+		{name: "single connection", min: 1, max: 1},
+		{name: "pool", min: 2, max: 4},
+	}
+	for _, test := range tests {
+		tt := test
+		t.Run(tt.name, func(t *testing.T) {
+			ldapCl, err := ldap.New(context.Background(),
+				ldap.WithTimeout(5*time.Second),
+				ldap.WithPoolSize(tt.min, tt.max),
+				ldap.WithURL(viper.GetString("ldap.url")),
+				ldap.WithBaseDN(viper.GetString("ldap.dn")),
+				ldap.WithAdmin(viper.GetString("ldap.user"), viper.GetString("ldap.pass")))
+			if err != nil {
+				t.Fatal("unexpected ldap connect", err)
+			}
+			defer ldapCl.Close()
+			r := &rpcClient{client: ldapCl}
+
+			var want []RPCUser
+			for i := uint32(1); ; i++ {
+				d, err := r.groupUsers(fmt.Sprintf(`{"ID":%q,"Pag":{"PerPage":1,"PageNum":%d}}`, group, i))
+				if err != nil {
+					t.Fatalf("groupUsers() unexpected error = %v", err)
+				}
+				var users []RPCUser
+				if err = json.Unmarshal([]byte(d), &users); err != nil {
+					t.Fatal(err)
+				}
+				if len(users) == 0 {
+					break
+				}
+				want = append(want, users...)
+			}
+			if len(want) < 2 {
+				t.Fatalf("groupUsers() got %d users, want several", len(want))
+			}
+
+			var got []RPCUser
+			cursor := ""
+			for {
+				d, err := r.groupUsers(fmt.Sprintf(`{"ID":%q,"Pag":{"PerPage":1,"Cursor":%q}}`, group, cursor))
+				if err != nil {
+					t.Fatalf("groupUsers() unexpected error = %v", err)
+				}
+				var p struct {
+					Items      []RPCUser `json:"items"`
+					NextCursor string    `json:"nextCursor"`
+					HasMore    bool      `json:"hasMore"`
+				}
+				if err = json.Unmarshal([]byte(d), &p); err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, p.Items...)
+				if !p.HasMore {
+					if p.NextCursor != "" {
+						t.Errorf("groupUsers() nextCursor = %q without more pages", p.NextCursor)
+					}
+					break
+				}
+				cursor = p.NextCursor
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("groupUsers() by cursor got = %v, want %v", got, want)
+			}
+			if len(r.scans) != 0 {
+				t.Errorf("groupUsers() kept %d scanners after the last page", len(r.scans))
+			}
+
+			if _, err = r.groupUsers(fmt.Sprintf(`{"ID":%q,"Pag":{"PerPage":1,"Cursor":"bogus"}}`, group)); err == nil {
+				t.Error("groupUsers() expected error for a malformed cursor")
+			}
+		})
+	}
+}
+
+func TestAgentServer_Close(t *testing.T) {
+	a := newAgentServer()
+	seed, served := a.addConn("agent", nil)
+	if !served {
+		t.Fatal("addConn() not served before Close")
+	}
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			a.removeConn("agent", seed)
+		}()
+	}
+	a.Close()
+	wg.Wait()
+	a.Close()
+	if err := a.Send("agent", LdapMsg{Method: RPCPingMethod}, make(chan LdapResp, 1)); err == nil {
+		t.Error("Send() expected error after Close")
+	}
+	if _, served = a.addConn("agent", nil); served {
+		t.Error("addConn() served after Close")
+	}
+}
@@ -0,0 +1,116 @@
+package ldap
+
+// noinspection GoRedundantImportAlias
+import (
+	"reflect"
+	"strings"
+)
+
+const (
+	AllAttributes         = "*"
+	OperationalAttributes = "+"
+	// NoAttributes returns DNs only
+	NoAttributes = "1.1"
+)
+
+// defaultAttributes is every user attribute plus the constructed account control of AD
+var defaultAttributes = []string{AllAttributes, attrUACComputed}
+
+// accountAttributes are read by DecodeAccountStatus
+var accountAttributes = []string{
+	"userAccountControl", attrUACComputed, "lockoutTime", "accountExpires", "pwdLastSet",
+	"pwdAccountLockedTime", "pwdReset", "pwdChangedTime", "nsAccountLock",
+}
+
+func (c *Client) userAttributes(s *Schema) []string {
+	attrs := append(tagAttributes(reflect.TypeOf(User{}), s.UserFields), accountAttributes...)
+	if s.MemberOfAttr != "" {
+		attrs = append(attrs, s.MemberOfAttr)
+	}
+	return uniqueAttributes(append(attrs, c.opt.extraAttrs...))
+}
+
+func (c *Client) groupAttributes(s *Schema) []string {
+	attrs := tagAttributes(reflect.TypeOf(Group{}), s.GroupFields)
+	return uniqueAttributes(append(attrs, c.opt.extraAttrs...))
+}
+
+func (c *Client) unitAttributes(s *Schema) []string {
+	attrs := tagAttributes(reflect.TypeOf(Unit{}), s.UnitFields)
+	return uniqueAttributes(append(attrs, c.opt.extraAttrs...))
+}
+
+// destAttributes lists what SearchInto needs for dst, a pointer to a slice of tagged structs; nil is everything
+func destAttributes(dst interface{}) []string {
+	t := reflect.TypeOf(dst)
+	if t == nil || t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Slice {
+		return nil
+	}
+	et := t.Elem().Elem()
+	if et.Kind() == reflect.Ptr {
+		et = et.Elem()
+	}
+	if et.Kind() != reflect.Struct {
+		return nil
+	}
+	attrs := uniqueAttributes(tagAttributes(et, nil))
+	if len(attrs) == 0 {
+		return []string{NoAttributes}
+	}
+	return attrs
+}
+
+// tagAttributes lists the attributes bound by the ldap tags of struct t, fields override the tags as in unmarshal
+func tagAttributes(t reflect.Type, fields map[string]string) []string {
+	var attrs []string
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag, tagged := sf.Tag.Lookup(tagName)
+		if f, ok := fields[sf.Name]; ok {
+			tag, tagged = f, true
+		}
+		if !tagged && sf.Anonymous && sf.Type.Kind() == reflect.Struct {
+			attrs = append(attrs, tagAttributes(sf.Type, fields)...)
+			continue
+		}
+		if !tagged || tag == "-" {
+			continue
+		}
+		for _, name := range strings.Split(tag, ",") {
+			if name = strings.TrimSpace(name); name != "" && !strings.EqualFold(name, tagDN) {
+				attrs = append(attrs, name)
+			}
+		}
+	}
+	return attrs
+}
+
+func uniqueAttributes(attrs []string) []string {
+	seen := make(map[string]bool, len(attrs))
+	res := make([]string, 0, len(attrs))
+	for _, a := range attrs {
+		k := strings.ToLower(a)
+		if a == "" || seen[k] {
+			continue
+		}
+		seen[k] = true
+		res = append(res, a)
+	}
+	return res
+}
+
+// fieldAttributes lists the attributes bound to the field of struct t, fields override its tag
+func fieldAttributes(t reflect.Type, fields map[string]string, field string) []string {
+	tag, ok := fields[field]
+	if !ok {
+		sf, _ := t.FieldByName(field)
+		tag = sf.Tag.Get(tagName)
+	}
+	var attrs []string
+	for _, name := range strings.Split(tag, ",") {
+		if name = strings.TrimSpace(name); name != "" && name != "-" {
+			attrs = append(attrs, name)
+		}
+	}
+	return attrs
+}
@@ -0,0 +1,123 @@
+package ldap
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/shubinmi/ldap/ldaptest"
+)
+
+func TestTagAttributes(t *testing.T) {
+	type person struct {
+		User
+		Department string   `ldap:"department"`
+		Groups     []string `ldap:"memberOf"`
+		Skip       string   `ldap:"-"`
+		Plain      string
+	}
+	tests := []struct {
+		name   string
+		t      reflect.Type
+		fields map[string]string
+		want   []string
+	}{
+		{
+			name: "group",
+			t:    reflect.TypeOf(Group{}),
+			want: []string{"name", "sAMAccountName", "userPrincipalName", "cn", "description", "cn", "member", "objectGUID", "objectSid"},
+		},
+		{
+			name:   "group fields",
+			t:      reflect.TypeOf(Group{}),
+			fields: map[string]string{"Name": "cn", "Member": "member,uniqueMember", "GUID": "entryUUID"},
+			want:   []string{"cn", "description", "cn", "member", "uniqueMember", "entryUUID", "objectSid"},
+		},
+		{
+			name: "embedded",
+			t:    reflect.TypeOf(person{}),
+			want: []string{"name", "displayName", "cn", "sAMAccountName", "userPrincipalName", "cn", "mail", "email",
+				"telephoneNumber", "mobile", "phone", "sAMAccountName", "userPrincipalName", "objectGUID", "objectSid",
+				"title", "department", "departmentNumber", "company", "o", "manager", "employeeID", "employeeNumber",
+				"givenName", "sn", "whenCreated", "createTimestamp", "whenChanged", "modifyTimestamp",
+				"lastLogonTimestamp", "lastLogon", "authTimestamp", "department", "memberOf"},
+		},
+	}
+	for _, test := range tests {
+		tt := test
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tagAttributes(tt.t, tt.fields); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("tagAttributes() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if got := destAttributes(&[]Unit{}); !reflect.DeepEqual(got, []string{"ou", "name"}) {
+		t.Errorf("destAttributes() got = %v", got)
+	}
+	if got := destAttributes(&[]struct {
+		DN string `ldap:"dn"`
+	}{}); !reflect.DeepEqual(got, []string{NoAttributes}) {
+		t.Errorf("destAttributes() DN only got = %v", got)
+	}
+}
+
+func TestClient_SearchWithOptions(t *testing.T) {
+	srv := testServer(t, ldaptest.WithLDIFFile(testDirectory))
+	defer srv.Close()
+	c := testClient(t, srv)
+	defer c.Close()
+	query := Eq("sAMAccountName", "test.user").String()
+	tests := []struct {
+		name  string
+		attrs []string
+		want  []string
+	}{
+		{name: "default", want: []string{"DN", "cn", "mail", "memberOf", "name", "objectCategory", "objectClass",
+			"sAMAccountName", "userPrincipalName"}},
+		{name: "selected", attrs: []string{"cn", "mail"}, want: []string{"DN", "cn", "mail"}},
+		{name: "operational", attrs: []string{"cn", OperationalAttributes}, want: []string{"DN", "cn", "memberOf"}},
+		{name: "dn only", attrs: []string{NoAttributes}, want: []string{"DN"}},
+	}
+	for _, test := range tests {
+		tt := test
+		t.Run(tt.name, func(t *testing.T) {
+			sr, err := c.SearchWithOptions(query, SearchOptions{Attributes: tt.attrs})
+			res := sr.Entries
+			if err != nil || len(res) != 1 {
+				t.Fatalf("SearchWithOptions() got = %v, err %v", res, err)
+			}
+			got := make([]string, 0, len(res[0]))
+			for k := range res[0] {
+				got = append(got, k)
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SearchWithOptions() attributes got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	type person struct {
+		User
+		Category string `ldap:"objectCategory"`
+	}
+	extra := testClient(t, srv, WithExtraAttributes("objectCategory"))
+	defer extra.Close()
+	for _, cl := range []struct {
+		name string
+		c    *Client
+		want string
+	}{{name: "built-in attributes", c: c}, {name: "extra attributes", c: extra, want: "person"}} {
+		sc, err := cl.c.OUUsers(10, "Users")
+		if err != nil {
+			t.Fatalf("%s: OUUsers() unexpected error = %v", cl.name, err)
+		}
+		var ps []person
+		for sc.Next() {
+			sc.Scan(Setter(&ps))
+		}
+		if len(ps) == 0 || ps[0].Logon == "" || ps[0].Category != cl.want {
+			t.Errorf("%s: OUUsers() got = %+v, want category %q", cl.name, ps, cl.want)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package ldap
+
+// noinspection GoRedundantImportAlias
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	ldap "github.com/go-ldap/ldap/v3"
+	"github.com/pkg/errors"
+)
+
+var (
+	guidAttributes  = map[string]bool{"objectguid": true}
+	sidAttributes   = map[string]bool{"objectsid": true, "sidhistory": true, "tokengroups": true, "securityidentifier": true}
+	bytesAttributes = map[string]bool{"jpegphoto": true, "thumbnailphoto": true, "photo": true}
+	certAttributes  = map[string]bool{"usercertificate": true, "cacertificate": true}
+)
+
+// GUID is the canonical string form of an AD objectGUID, like 6f9619ff-8b86-d011-b42d-00c04fc964ff.
+// Text ids of other servers (entryUUID, nsUniqueId, ipaUniqueID) are kept lowercased, other binary values as hex.
+type GUID string
+
+func (g *GUID) UnmarshalBinary(b []byte) error {
+	if len(b) != 16 && utf8.Valid(b) {
+		*g = GUID(strings.ToLower(string(b)))
+		return nil
+	}
+	if len(b) != 16 {
+		*g = GUID(hex.EncodeToString(b))
+		return nil
+	}
+	// the first three groups are little-endian on the wire
+	*g = GUID(fmt.Sprintf("%08x-%04x-%04x-%x-%x",
+		binary.LittleEndian.Uint32(b[0:4]), binary.LittleEndian.Uint16(b[4:6]),
+		binary.LittleEndian.Uint16(b[6:8]), b[8:10], b[10:16]))
+	return nil
+}
+
+// Bytes is the objectGUID value of g as AD keeps it
+func (g GUID) Bytes() ([]byte, error) {
+	b, err := hex.DecodeString(strings.NewReplacer("-", "", "{", "", "}", "").Replace(string(g)))
+	if err != nil || len(b) != 16 {
+		return nil, errors.Errorf("wrong GUID %q", string(g))
+	}
+	b[0], b[1], b[2], b[3] = b[3], b[2], b[1], b[0]
+	b[4], b[5] = b[5], b[4]
+	b[6], b[7] = b[7], b[6]
+	return b, nil
+}
+
+// SID is a security identifier in its S-1-5-21-... form
+type SID string
+
+func (s *SID) UnmarshalBinary(b []byte) error {
+	if bytes.HasPrefix(b, []byte("S-")) {
+		*s = SID(b)
+		return nil
+	}
+	// revision, sub-authority count, 48-bit big-endian authority and little-endian 32-bit sub-authorities
+	if len(b) < 8 || len(b) != 8+4*int(b[1]) {
+		return errors.Errorf("wrong SID length %d", len(b))
+	}
+	var auth uint64
+	for _, x := range b[2:8] {
+		auth = auth<<8 | uint64(x)
+	}
+	sb := strings.Builder{}
+	sb.WriteString("S-" + strconv.Itoa(int(b[0])) + "-" + strconv.FormatUint(auth, 10))
+	for i := 8; i < len(b); i += 4 {
+		sb.WriteString("-" + strconv.FormatUint(uint64(binary.LittleEndian.Uint32(b[i:])), 10))
+	}
+	*s = SID(sb.String())
+	return nil
+}
+
+// Bytes is the binary objectSid value of s
+func (s SID) Bytes() ([]byte, error) {
+	parts := strings.Split(string(s), "-")
+	if len(parts) < 3 || len(parts) > 3+255 || !strings.EqualFold(parts[0], "S") {
+		return nil, errors.Errorf("wrong SID %q", string(s))
+	}
+	rev, err := strconv.ParseUint(parts[1], 10, 8)
+	if err != nil {
+		return nil, errors.Errorf("wrong SID %q", string(s))
+	}
+	auth, err := strconv.ParseUint(parts[2], 10, 48)
+	if err != nil {
+		return nil, errors.Errorf("wrong SID %q", string(s))
+	}
+	b := make([]byte, 8, 8+4*(len(parts)-3))
+	b[0], b[1] = byte(rev), byte(len(parts)-3)
+	for i := 7; i >= 2; i-- {
+		b[i] = byte(auth)
+		auth >>= 8
+	}
+	for _, p := range parts[3:] {
+		sub, err := strconv.ParseUint(p, 10, 32)
+		if err != nil {
+			return nil, errors.Errorf("wrong SID %q", string(s))
+		}
+		b = append(b, 0, 0, 0, 0)
+		binary.LittleEndian.PutUint32(b[len(b)-4:], uint32(sub))
+	}
+	return b, nil
+}
+
+// attributeValues decodes the values of a for Search: GUIDs and SIDs as strings, photos as [][]byte,
+// certificates as []*x509.Certificate and everything else as []string
+func attributeValues(a *ldap.EntryAttribute) interface{} {
+	name := strings.ToLower(a.Name)
+	if i := strings.Index(name, ";"); i >= 0 {
+		// userCertificate;binary
+		name = name[:i]
+	}
+	switch {
+	case guidAttributes[name]:
+		res := make([]string, 0, len(a.ByteValues))
+		for _, b := range a.ByteValues {
+			var g GUID
+			_ = g.UnmarshalBinary(b)
+			res = append(res, string(g))
+		}
+		return res
+	case sidAttributes[name]:
+		res := make([]string, 0, len(a.ByteValues))
+		for _, b := range a.ByteValues {
+			var s SID
+			if err := s.UnmarshalBinary(b); err != nil {
+				return a.ByteValues
+			}
+			res = append(res, string(s))
+		}
+		return res
+	case bytesAttributes[name]:
+		return a.ByteValues
+	case certAttributes[name]:
+		res := make([]*x509.Certificate, 0, len(a.ByteValues))
+		for _, b := range a.ByteValues {
+			cert, err := x509.ParseCertificate(b)
+			if err != nil {
+				return a.ByteValues
+			}
+			res = append(res, cert)
+		}
+		return res
+	}
+	return a.Values
+}
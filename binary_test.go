@@ -0,0 +1,135 @@
+package ldap
+
+import (
+	"crypto/x509"
+	"encoding/hex"
+	"reflect"
+	"testing"
+
+	"github.com/shubinmi/ldap/ldaptest"
+)
+
+func TestGUID_UnmarshalBinary(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		want GUID
+	}{
+		{name: "ad", raw: "\xff\x19\x96\x6f\x86\x8b\x11\xd0\xb4\x2d\x00\xc0\x4f\xc9\x64\xff",
+			want: "6f9619ff-8b86-d011-b42d-00c04fc964ff"},
+		{name: "text", raw: "597AE2F6-157D-4A4C-9E6F-0AB3E1A7AA8D", want: "597ae2f6-157d-4a4c-9e6f-0ab3e1a7aa8d"},
+	}
+	for _, test := range tests {
+		tt := test
+		t.Run(tt.name, func(t *testing.T) {
+			var g GUID
+			if err := g.UnmarshalBinary([]byte(tt.raw)); err != nil || g != tt.want {
+				t.Errorf("UnmarshalBinary() got = %v, err %v, want %v", g, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSID_UnmarshalBinary(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		want    SID
+		wantErr bool
+	}{
+		{name: "builtin", raw: "01020000000000052000000020020000", want: "S-1-5-32-544"},
+		{name: "domain", raw: "010500000000000515000000a065cf7e784b9b5fe77c8770f4010000",
+			want: "S-1-5-21-2127521184-1604012920-1887927527-500"},
+		{name: "short", raw: "010200000000000520000000", wantErr: true},
+	}
+	for _, test := range tests {
+		tt := test
+		t.Run(tt.name, func(t *testing.T) {
+			b, _ := hex.DecodeString(tt.raw)
+			var s SID
+			err := s.UnmarshalBinary(b)
+			if (err != nil) != tt.wantErr || s != tt.want {
+				t.Errorf("UnmarshalBinary() got = %v, err %v, want %v", s, err, tt.want)
+			}
+		})
+	}
+	var s SID
+	if err := s.UnmarshalBinary([]byte("S-1-5-32-544")); err != nil || s != "S-1-5-32-544" {
+		t.Errorf("UnmarshalBinary() text got = %v, err %v", s, err)
+	}
+}
+
+func TestClient_BinaryAttributes(t *testing.T) {
+	cert, _, err := ldaptest.GenerateCert()
+	if err != nil {
+		t.Fatal("generate cert", err)
+	}
+	guid, _ := hex.DecodeString("ff19966f868b11d0b42d00c04fc964ff")
+	sid, _ := hex.DecodeString("010500000000000515000000a065cf7e784b9b5fe77c8770f4010000")
+	photo := "\xff\xd8\xff\xe0\x00"
+	srv := testServer(t, ldaptest.WithLDIF(openLDAPLDIF), ldaptest.WithEntries(ldaptest.Entry{
+		DN: "uid=carol,ou=people,dc=example,dc=org",
+		Attributes: map[string][]string{
+			"objectClass":     {"organizationalPerson", "inetOrgPerson"},
+			"uid":             {"carol"},
+			"cn":              {"Carol"},
+			"objectGUID":      {string(guid)},
+			"objectSid":       {string(sid)},
+			"thumbnailPhoto":  {photo},
+			"userCertificate": {string(cert.Certificate[0])},
+		},
+	}))
+	defer srv.Close()
+	c := testClient(t, srv, WithBaseDN("dc=example,dc=org"), WithAdmin("admin", "adminPass"), WithSchema(SchemaActiveDirectory))
+	defer c.Close()
+
+	res, err := c.Search("(uid=carol)")
+	if err != nil || len(res) != 1 {
+		t.Fatalf("Search() got = %v, err %v", res, err)
+	}
+	if got := res[0]["objectGUID"]; !reflect.DeepEqual(got, []string{"6f9619ff-8b86-d011-b42d-00c04fc964ff"}) {
+		t.Errorf("Search() objectGUID = %v", got)
+	}
+	if got := res[0]["objectSid"]; !reflect.DeepEqual(got, []string{"S-1-5-21-2127521184-1604012920-1887927527-500"}) {
+		t.Errorf("Search() objectSid = %v", got)
+	}
+	if got := res[0]["thumbnailPhoto"]; !reflect.DeepEqual(got, [][]byte{[]byte(photo)}) {
+		t.Errorf("Search() thumbnailPhoto = %v", got)
+	}
+	if got, ok := res[0]["userCertificate"].([]*x509.Certificate); !ok || len(got) != 1 ||
+		len(got[0].Subject.Organization) == 0 {
+		t.Errorf("Search() userCertificate = %v", res[0]["userCertificate"])
+	}
+
+	var dst []struct {
+		GUID  GUID              `ldap:"objectGUID"`
+		SID   SID               `ldap:"objectSid"`
+		Photo []byte            `ldap:"thumbnailPhoto"`
+		Cert  *x509.Certificate `ldap:"userCertificate"`
+	}
+	if err = c.SearchInto("(uid=carol)", &dst); err != nil || len(dst) != 1 {
+		t.Fatalf("SearchInto() got = %v, err %v", dst, err)
+	}
+	if dst[0].GUID != "6f9619ff-8b86-d011-b42d-00c04fc964ff" || dst[0].SID != "S-1-5-21-2127521184-1604012920-1887927527-500" ||
+		string(dst[0].Photo) != photo || dst[0].Cert == nil {
+		t.Errorf("SearchInto() got = %+v", dst[0])
+	}
+}
+
+func TestSID_Bytes(t *testing.T) {
+	for _, s := range []SID{"S-1-5-32-544", "S-1-5-21-2127521184-1604012920-1887927527-500", "S-1-0-0"} {
+		b, err := s.Bytes()
+		var got SID
+		if err == nil {
+			err = got.UnmarshalBinary(b)
+		}
+		if err != nil || got != s {
+			t.Errorf("Bytes() round trip of %v got = %v, err %v", s, got, err)
+		}
+	}
+	for _, s := range []SID{"", "S-1", "S-1-x-1", "X-1-5", "S-1-5-4294967296"} {
+		if _, err := s.Bytes(); err == nil {
+			t.Errorf("Bytes() expected error for %q", s)
+		}
+	}
+}
@@ -0,0 +1,265 @@
+package ldap
+
+// noinspection GoRedundantImportAlias
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	ldap "github.com/go-ldap/ldap/v3"
+	"github.com/pkg/errors"
+)
+
+// ChangeKind tells what happened to an entry since a watermark
+type ChangeKind int
+
+const (
+	ChangeAdded ChangeKind = iota
+	ChangeModified
+	ChangeDeleted
+	// ChangeRenamed is only reported by Watch, Changes sees a renamed entry as modified
+	ChangeRenamed
+)
+
+// Change is a user, group or unit added, modified or deleted since a watermark
+type Change struct {
+	Kind ChangeKind
+	// DN is where the entry is, or was before it was deleted
+	DN   string
+	GUID GUID
+	// Object is the User, Group or Unit as it is now, nil for deletions
+	Object interface{}
+}
+
+// watermark is the serialized position of Changes: the USN of one domain controller on AD,
+// entryCSN or else modifyTimestamp on other servers
+type watermark struct {
+	Identity string `json:"i"`
+	Server   string `json:"s,omitempty"`
+	USN      int64  `json:"u,omitempty"`
+	CSN      string `json:"c,omitempty"`
+	Time     string `json:"t,omitempty"`
+}
+
+const generalizedTime = "20060102150405Z"
+
+var (
+	usnAttributes  = []string{"uSNCreated", "uSNChanged"}
+	timeAttributes = []string{"createTimestamp", "modifyTimestamp", "entryCSN"}
+	// tombstones keep objectClass but not objectCategory, which the AD schema filters match on
+	tombstoneClasses = Or(And(Eq("objectClass", "user"), Not(Eq("objectClass", "computer"))),
+		Eq("objectClass", "group"), Eq("objectClass", "organizationalUnit"))
+	rdnEscaper = strings.NewReplacer(`\`, `\\`, `,`, `\,`, `+`, `\+`, `"`, `\"`, `<`, `\<`, `>`, `\>`, `;`, `\;`, `=`, `\=`)
+)
+
+func (c *Client) Changes(watermark string) ([]Change, string, error) {
+	return c.ChangesContext(context.Background(), watermark)
+}
+
+// ChangesContext returns the users, groups and units under the base DN changed since watermark and the watermark
+// to pass next time, an empty one lists everything as added. Changes may be reported again, never skipped.
+// AD counts them by uSNChanged of the domain controller that answers and reports deletions from the tombstones,
+// other servers by entryCSN or modifyTimestamp, which do not tell about deletions.
+func (c *Client) ChangesContext(ctx context.Context, watermark string) ([]Change, string, error) {
+	if c.isClosed() {
+		return nil, "", ErrClosed
+	}
+	s, err := c.schema(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	dse, err := c.rootDSE(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	objects := Or(s.Users, s.Groups, s.Units)
+	wm, err := parseWatermark(watermark, searchIdentity(normalizeDN(c.opt.dn), objects.String()))
+	if err != nil {
+		return nil, "", err
+	}
+	var changes []Change
+	if dse.activeDirectory {
+		changes, wm, err = c.usnChanges(ctx, s, objects, wm)
+	} else {
+		changes, wm, err = c.timeChanges(ctx, s, objects, wm)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return changes, wm.String(), nil
+}
+
+func parseWatermark(w, identity string) (watermark, error) {
+	wm := watermark{Identity: identity}
+	if w == "" {
+		return wm, nil
+	}
+	bt, err := base64.RawURLEncoding.DecodeString(w)
+	if err == nil {
+		err = json.Unmarshal(bt, &wm)
+	}
+	if err != nil || wm.Identity != identity {
+		return watermark{}, ErrInvalidWatermark
+	}
+	return wm, nil
+}
+
+func (w watermark) String() string {
+	bt, _ := json.Marshal(w)
+	return base64.RawURLEncoding.EncodeToString(bt)
+}
+
+// usnChanges reads what changed above the USN of wm, the highest committed USN read first is the next watermark
+func (c *Client) usnChanges(ctx context.Context, s *Schema, objects Filter, wm watermark) ([]Change, watermark, error) {
+	dse, err := c.rootDSEEntry(ctx, "highestCommittedUSN", "dsServiceName", "defaultNamingContext")
+	if err != nil {
+		return nil, wm, err
+	}
+	highest, err := strconv.ParseInt(dse.GetAttributeValue("highestCommittedUSN"), 10, 64)
+	if err != nil {
+		return nil, wm, errors.Wrap(err, "ldap changes: highestCommittedUSN")
+	}
+	server := dse.GetAttributeValue("dsServiceName")
+	if wm.Server != "" && !strings.EqualFold(wm.Server, server) {
+		return nil, wm, ErrStaleWatermark
+	}
+	// every domain controller has a dsServiceName, a watermark without one is the first call
+	initial := wm.Server == ""
+	f := objects
+	since := GreaterOrEqual("uSNChanged", strconv.FormatInt(wm.USN+1, 10))
+	if !initial {
+		f = And(objects, since)
+	}
+	entries, err := c.allEntries(ctx, c.searchRequest(f.String(), append(c.objectAttributes(s), usnAttributes...)))
+	if err != nil {
+		return nil, wm, err
+	}
+	changes := make([]Change, 0, len(entries))
+	for _, e := range entries {
+		kind := ChangeAdded
+		if !initial && usn(e, "uSNCreated") <= wm.USN {
+			kind = ChangeModified
+		}
+		changes = append(changes, objectChange(s, kind, e))
+	}
+	if !initial {
+		// tombstones are moved to CN=Deleted Objects of the domain, lastKnownParent tells where they were
+		req := c.searchRequest(And(Eq("isDeleted", "TRUE"), tombstoneClasses, since).String(),
+			[]string{"objectGUID", "lastKnownParent"}, ldap.NewControlMicrosoftShowDeleted())
+		if nc := dse.GetAttributeValue("defaultNamingContext"); nc != "" {
+			req.BaseDN = nc
+		}
+		if entries, err = c.allEntries(ctx, req); err != nil {
+			return nil, wm, err
+		}
+		base := normalizeDN(c.opt.dn)
+		for _, e := range entries {
+			parent := ""
+			if a := attribute(e, "lastKnownParent"); a != nil && len(a.Values) > 0 {
+				parent = a.Values[0]
+			}
+			if p := normalizeDN(parent); p != base && !strings.HasSuffix(p, ","+base) {
+				continue
+			}
+			changes = append(changes, Change{Kind: ChangeDeleted, DN: deletedDN(e.DN, parent), GUID: entryGUID(e)})
+		}
+	}
+	return changes, watermark{Identity: wm.Identity, Server: server, USN: highest}, nil
+}
+
+// timeChanges reads what changed since the entryCSN or modifyTimestamp of wm. The newest ones seen are the next
+// watermark, the entry of the newest CSN is not reported twice.
+func (c *Client) timeChanges(ctx context.Context, s *Schema, objects Filter, wm watermark) ([]Change, watermark, error) {
+	f := objects
+	switch {
+	case wm.CSN != "":
+		f = And(objects, GreaterOrEqual("entryCSN", wm.CSN))
+	case wm.Time != "":
+		f = And(objects, GreaterOrEqual("modifyTimestamp", wm.Time))
+	}
+	entries, err := c.allEntries(ctx, c.searchRequest(f.String(), append(c.objectAttributes(s), timeAttributes...)))
+	if err != nil {
+		return nil, wm, err
+	}
+	initial := wm.CSN == "" && wm.Time == ""
+	next := wm
+	changes := make([]Change, 0, len(entries))
+	for _, e := range entries {
+		csn, modified := firstValue(e, "entryCSN"), generalized(firstValue(e, "modifyTimestamp"))
+		if wm.CSN != "" && csn == wm.CSN {
+			continue
+		}
+		kind := ChangeAdded
+		if created := generalized(firstValue(e, "createTimestamp")); !initial && (created == "" || created < wm.Time) {
+			kind = ChangeModified
+		}
+		changes = append(changes, objectChange(s, kind, e))
+		if csn > next.CSN {
+			next.CSN = csn
+		}
+		if modified > next.Time {
+			next.Time = modified
+		}
+	}
+	if next.Time == "" {
+		// entries without timestamps, what changes from now on will have them
+		next.Time = time.Now().UTC().Format(generalizedTime)
+	}
+	return changes, next, nil
+}
+
+// allEntries pages through req on one connection, a page at a time within the client timeout
+func (c *Client) allEntries(ctx context.Context, req *ldap.SearchRequest) ([]*ldap.Entry, error) {
+	entries, _, _, err := c.limitedSearch(ctx, req, 0)
+	return entries, errors.Wrap(err, "ldap changes")
+}
+
+func objectChange(s *Schema, kind ChangeKind, e *ldap.Entry) Change {
+	return Change{Kind: kind, DN: e.DN, GUID: entryGUID(e), Object: mapToObject(s, e)}
+}
+
+func entryGUID(e *ldap.Entry) GUID {
+	var g GUID
+	if a := attribute(e, "objectGUID"); a != nil && len(a.ByteValues) > 0 {
+		_ = g.UnmarshalBinary(a.ByteValues[0])
+	}
+	return g
+}
+
+// deletedDN is the DN of a tombstone before the deletion: "CN=name\0ADEL:guid" under lastKnownParent
+func deletedDN(dn, parent string) string {
+	parsed, err := ldap.ParseDN(dn)
+	if err != nil || len(parsed.RDNs) == 0 || len(parsed.RDNs[0].Attributes) == 0 || parent == "" {
+		return dn
+	}
+	rdn := parsed.RDNs[0].Attributes[0]
+	name := rdn.Value
+	if i := strings.Index(name, "\nDEL:"); i >= 0 {
+		name = name[:i]
+	}
+	return rdn.Type + "=" + rdnEscaper.Replace(name) + "," + parent
+}
+
+func firstValue(e *ldap.Entry, name string) string {
+	if a := attribute(e, name); a != nil && len(a.Values) > 0 {
+		return a.Values[0]
+	}
+	return ""
+}
+
+// generalized is v in the one generalized time format that compares as a string, "" when it is not a time
+func generalized(v string) string {
+	t, err := parseTime(v)
+	if v == "" || err != nil || t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(generalizedTime)
+}
+
+func usn(e *ldap.Entry, name string) int64 {
+	v, _ := strconv.ParseInt(firstValue(e, name), 10, 64)
+	return v
+}
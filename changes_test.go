@@ -0,0 +1,147 @@
+package ldap
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/shubinmi/ldap/ldaptest"
+)
+
+func TestClient_Changes(t *testing.T) {
+	const (
+		staff   = "OU=Staff,DC=corp,DC=test,DC=com"
+		updated = "CN=Test 1,OU=TestGroup," + staff
+		deleted = "CN=Test 2,OU=TestGroup," + staff
+		created = "CN=New Hire,OU=Users,OU=St-Petersburg," + staff
+	)
+	tests := []struct {
+		name string
+		dse  map[string][]string
+		want map[string]ChangeKind
+	}{
+		{name: "entryCSN", want: map[string]ChangeKind{updated: ChangeModified, created: ChangeAdded}},
+		{name: "active directory", dse: map[string][]string{"supportedCapabilities": {capActiveDirectory}},
+			want: map[string]ChangeKind{updated: ChangeModified, created: ChangeAdded, deleted: ChangeDeleted}},
+	}
+	for _, test := range tests {
+		tt := test
+		t.Run(tt.name, func(t *testing.T) {
+			c, closeAll := writeClient(t, tt.dse)
+			defer closeAll()
+			changes := func(w string) (map[string]ChangeKind, string) {
+				cs, next, err := c.Changes(w)
+				if err != nil {
+					t.Fatalf("Changes() unexpected error = %v", err)
+				}
+				got := make(map[string]ChangeKind, len(cs))
+				for _, ch := range cs {
+					got[ch.DN] = ch.Kind
+					if (ch.Object == nil) != (ch.Kind == ChangeDeleted) {
+						t.Errorf("Changes() %s object = %v", ch.DN, ch.Object)
+					}
+				}
+				return got, next
+			}
+
+			all, w := changes("")
+			dns := make([]string, 0, len(all))
+			for dn, kind := range all {
+				if kind != ChangeAdded {
+					t.Errorf("Changes() first call %s kind = %v", dn, kind)
+				}
+				dns = append(dns, dn)
+			}
+			sort.Strings(dns)
+			if len(dns) != 11 {
+				t.Errorf("Changes() first call got = %v", dns)
+			}
+			if got, _ := changes(w); len(got) != 0 {
+				t.Errorf("Changes() without writes got = %v", got)
+			}
+
+			if err := c.UpdateUser(User{DN: updated, Mail: "test.1@test.com"}, nil); err != nil {
+				t.Fatalf("UpdateUser() unexpected error = %v", err)
+			}
+			if err := c.CreateUser(User{DN: created, Name: "New Hire", Logon: "new.hire"}, "newPass1!", nil); err != nil {
+				t.Fatalf("CreateUser() unexpected error = %v", err)
+			}
+			if err := c.DeleteUser(deleted); err != nil {
+				t.Fatalf("DeleteUser() unexpected error = %v", err)
+			}
+			// a computer is neither a user, a group nor a unit, its deletion is not reported
+			computer := "CN=WS01,OU=Users,OU=St-Petersburg," + staff
+			if err := c.CreateUser(User{DN: computer, Name: "WS01", Logon: "WS01$"}, "", map[string][]string{
+				"objectClass":    {"top", "person", "organizationalPerson", "user", "computer"},
+				"objectCategory": {"computer"},
+			}); err != nil {
+				t.Fatalf("CreateUser() computer unexpected error = %v", err)
+			}
+			if err := c.DeleteUser(computer); err != nil {
+				t.Fatalf("DeleteUser() computer unexpected error = %v", err)
+			}
+			got, next := changes(w)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Changes() got = %v, want %v", got, tt.want)
+			}
+			if got, _ = changes(next); len(got) != 0 {
+				t.Errorf("Changes() after the last one got = %v", got)
+			}
+			// a job restarted with the old watermark sees the same changes again
+			if got, _ = changes(w); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Changes() repeated got = %v, want %v", got, tt.want)
+			}
+
+			if _, _, err := c.Changes("garbage"); err != ErrInvalidWatermark {
+				t.Errorf("Changes() malformed watermark error = %v, want %v", err, ErrInvalidWatermark)
+			}
+			var wm watermark
+			bt, _ := base64.RawURLEncoding.DecodeString(next)
+			_ = json.Unmarshal(bt, &wm)
+			if wm.Server == "" {
+				return
+			}
+			wm.Server = "CN=NTDS Settings,CN=another"
+			if _, _, err := c.Changes(wm.String()); err != ErrStaleWatermark {
+				t.Errorf("Changes() watermark of another server error = %v, want %v", err, ErrStaleWatermark)
+			}
+		})
+	}
+}
+
+func TestClient_ChangesPageTimeout(t *testing.T) {
+	// the initial sync of eleven pages takes longer than the timeout, every page is within it
+	srv := testServer(t, ldaptest.WithLDIFFile(testDirectory), ldaptest.WithMaxPageSize(1),
+		ldaptest.WithLatency(50*time.Millisecond))
+	defer srv.Close()
+	c := testClient(t, srv, WithTimeout(300*time.Millisecond))
+	defer c.Close()
+	changes, _, err := c.Changes("")
+	if err != nil {
+		t.Fatalf("Changes() unexpected error = %v", err)
+	}
+	if len(changes) != 11 {
+		t.Errorf("Changes() got %d changes, want 11", len(changes))
+	}
+}
+
+func TestDeletedDN(t *testing.T) {
+	tests := []struct {
+		dn, parent, want string
+	}{
+		{dn: `CN=Test 2\0ADEL:5f1c,CN=Deleted Objects,DC=corp,DC=com`, parent: "OU=Staff,DC=corp,DC=com",
+			want: "CN=Test 2,OU=Staff,DC=corp,DC=com"},
+		{dn: `CN=Smith\, John\0ADEL:5f1c,CN=Deleted Objects,DC=corp,DC=com`, parent: "OU=Staff,DC=corp,DC=com",
+			want: `CN=Smith\, John,OU=Staff,DC=corp,DC=com`},
+		{dn: `CN=Test 2\0ADEL:5f1c,CN=Deleted Objects,DC=corp,DC=com`,
+			want: `CN=Test 2\0ADEL:5f1c,CN=Deleted Objects,DC=corp,DC=com`},
+	}
+	for _, tt := range tests {
+		if got := deletedDN(tt.dn, tt.parent); got != tt.want {
+			t.Errorf("deletedDN(%q) = %q, want %q", tt.dn, got, tt.want)
+		}
+	}
+}
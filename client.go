@@ -18,14 +18,15 @@ import (
 
 const (
 	sleepTimeout = 20 * time.Millisecond
+	maxRetries   = 3
 )
 
 type Client struct {
 	closed bool
 	mtx    *sync.Mutex
-	con    *ldap.Conn
+	pool   *pool
 	opt    *opt
-	comCh  chan concurrentFunc
+	dse    *rootDSE
 }
 
 func New(ctx context.Context, fs ...optF) (*Client, error) {
@@ -33,61 +34,65 @@ func New(ctx context.Context, fs ...optF) (*Client, error) {
 	if e != nil {
 		return nil, errors.Wrap(e, "wrong ldap Client options")
 	}
-	done := make(chan struct{})
-	var (
-		l   *ldap.Conn
-		err error
-	)
-	go func() {
-		l, err = ldap.DialURL(opt.url, ldap.DialWithDialer(&net.Dialer{Timeout: opt.timeout}))
-		close(done)
-	}()
-	select {
-	case <-time.After(opt.timeout):
-		return nil, errors.New("new ldap Client Dial timeout")
-	case <-done:
-	}
+	cl := &Client{opt: opt, mtx: &sync.Mutex{}}
+	p, err := newPool(ctx, opt, cl.dial, cl.bindAdmin)
 	if err != nil {
 		return nil, err
 	}
-	if opt.debug {
-		l.Debug.Enable(true)
+	cl.pool = p
+	go cl.closeOnDone(ctx)
+	return cl, nil
+}
+
+func (c *Client) Ping() error {
+	return c.PingContext(context.Background())
+}
+
+func (c *Client) PingContext(ctx context.Context) error {
+	if c.isClosed() {
+		return ErrClosed
 	}
-	cl := &Client{con: l, opt: opt, mtx: &sync.Mutex{}}
-	err = cl.bindAdmin()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	pc, err := c.pool.get(ctx, c.opt.timeout)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	cl.comCh = make(chan concurrentFunc, 1)
-	go cl.serveCommands(ctx)
-	return cl, nil
+	err = c.bindAdmin(ctx, pc.con)
+	c.pool.put(pc, err != nil)
+	return err
 }
 
-func (c *Client) Ping() error {
-	return c.bindAdmin()
+func (c *Client) Auth(usr, pass string) (User, error) {
+	return c.AuthContext(context.Background(), usr, pass)
 }
 
-func (c *Client) Auth(usr, pass string) (user User, err error) {
+// AuthContext verifies pass by a bind as usr. The account check of WithAccountCheck runs after the bind,
+// so the status of an account is only told to a caller who knows its password.
+func (c *Client) AuthContext(ctx context.Context, usr, pass string) (user User, err error) {
 	if c.isClosed() {
-		err = errors.New("client is closed")
+		err = ErrClosed
 		return
 	}
-	user, err = c.SearchByLogon(usr)
+	user, err = c.SearchByLogonContext(ctx, usr)
 	if err != nil {
 		return
 	}
-	f := func() chan struct{} {
+	f := func(con *ldap.Conn) chan struct{} {
 		done := make(chan struct{})
 		go func() {
 			defer close(done)
 			// Bind as the user to verify their password
-			err = c.con.Bind(user.DN, pass)
+			err = ldapError(con.Bind(user.DN, pass))
 		}()
 		return done
 	}
-	e := c.concurrentDo(f)
-	if e != nil {
-		err = errs.Merge(err, e)
+	if err = doError(err, c.concurrentBind(ctx, f)); err != nil {
+		return
+	}
+	if c.opt.accountCheck {
+		err = user.Status.Err()
 	}
 	return
 }
@@ -100,191 +105,381 @@ func (c *Client) Close() {
 	}()
 	c.mtx.Lock()
 	defer c.mtx.Unlock()
-	if c.isClosed() {
+	if c.closed {
 		return
 	}
 	c.closed = true
-	close(c.comCh)
-	c.con.Close()
+	c.pool.close()
+}
+
+func (c *Client) GroupUsers(nodeDN string, pageSize uint32, mode ...MembershipMode) (ResultsScanner, error) {
+	return c.GroupUsersContext(context.Background(), nodeDN, pageSize, mode...)
 }
 
-func (c *Client) GroupUsers(nodeDN string, pageSize uint32) (ResultsScanner, error) {
+// GroupUsersContext pages through the users of nodeDN. Users read from the member lists, where the
+// server can not search them by group, can not be resumed by cursor.
+func (c *Client) GroupUsersContext(ctx context.Context, nodeDN string, pageSize uint32,
+	mode ...MembershipMode) (ResultsScanner, error) {
 	if c.isClosed() {
-		return nil, errors.New("client is closed")
+		return nil, ErrClosed
+	}
+	s, err := c.schema(ctx)
+	if err != nil {
+		return nil, err
 	}
-	mapper := func(ent *ldap.Entry) interface{} { return mapToUser(ent) }
-	f := c.retriever(pageSize,
-		fmt.Sprintf("(&(objectCategory=person)(objectClass=user)(memberOf=%s))", nodeDN),
-		mapper)
-	sc := newScanner(f)
+	mapper := func(ent *ldap.Entry) interface{} { return mapToUser(s, ent) }
+	transitive := membership(mode) == Transitive
+	f, err := c.groupUsersFilter(ctx, s, nodeDN, transitive)
+	if err != nil {
+		return nil, err
+	}
+	if f == nil {
+		entries, err := c.members(ctx, s, nodeDN, transitive)
+		if err != nil {
+			return nil, err
+		}
+		return newScanner(searchIdentity("members", nodeDN, transitive), entriesRetriever(entries, pageSize, mapper)), nil
+	}
+	sc := newPagedScanner(c.retriever(ctx, pageSize,
+		f.String(),
+		c.userAttributes(s),
+		mapper))
 	return sc, nil
 }
 
+// groupUsersFilter finds the users of nodeDN, nil when users can not be searched by group
+// and the member lists are to be read instead
+func (c *Client) groupUsersFilter(ctx context.Context, s *Schema, nodeDN string, transitive bool) (Filter, error) {
+	inChain := false
+	if transitive {
+		dse, err := c.rootDSE(ctx)
+		if err != nil {
+			return nil, err
+		}
+		inChain = dse.activeDirectory
+	}
+	if s.MemberOfAttr == "" || transitive && !inChain {
+		return nil, nil
+	}
+	memberOf := Eq(s.MemberOfAttr, nodeDN)
+	if transitive {
+		memberOf = ExtensibleMatch(s.MemberOfAttr, ruleInChain, nodeDN, false)
+	}
+	return And(s.Users, memberOf), nil
+}
+
 func (c *Client) OUUsers(pageSize uint32, ouNames ...string) (ResultsScanner, error) {
+	return c.OUUsersContext(context.Background(), pageSize, ouNames...)
+}
+
+func (c *Client) OUUsersContext(ctx context.Context, pageSize uint32, ouNames ...string) (ResultsScanner, error) {
+	return c.OUUsersScopeContext(ctx, pageSize, ScopeSubtree, ouNames...)
+}
+
+func (c *Client) OUUsersScope(pageSize uint32, scope Scope, ous ...string) (ResultsScanner, error) {
+	return c.OUUsersScopeContext(context.Background(), pageSize, scope, ous...)
+}
+
+// OUUsersScopeContext pages through users under the given OUs. An OU is either an exact DN
+// or a name, which is resolved to the DNs of all organizational units having it.
+// The scan of several OUs can not be resumed by cursor.
+func (c *Client) OUUsersScopeContext(ctx context.Context, pageSize uint32, scope Scope,
+	ous ...string) (ResultsScanner, error) {
 	if c.isClosed() {
-		return nil, errors.New("client is closed")
-	}
-	var allUsersPageSize uint32 = 1000
-	mapper := func(ent *ldap.Entry) interface{} { return mapToUser(ent) }
-	f := c.retriever(allUsersPageSize,
-		"(&(objectCategory=person)(objectClass=user))",
-		mapper)
-	sc := newScanner(f)
-	cashRestResults := make([]User, 0, allUsersPageSize)
-
-	uf := func() (interface{}, error) {
-		users := make([]interface{}, 0, pageSize)
-		res := make([]User, 0, allUsersPageSize)
-	LOOP:
-		for len(cashRestResults) > 0 || sc.Next() {
-			if len(cashRestResults) > 0 {
-				res = append(res, cashRestResults...)
-				cashRestResults = []User{}
-			} else {
-				sc.Scan(UsersSetter(&res))
-			}
-			for i, u := range res {
-				has := false
-				for _, ouName := range ouNames {
-					ouName = strings.ToLower(strings.TrimSpace(ouName))
-					if strings.Contains(strings.ToLower(u.DN), ouName) ||
-						strings.Contains(strings.ToLower(u.MemberOf), ouName) {
-						has = true
-						break
-					}
-				}
-				if !has {
-					continue
-				}
-				users = append(users, u)
-				if len(users) == int(pageSize) {
-					if i+1 < len(res) {
-						cashRestResults = res[i+1:]
-					}
-					break LOOP
-				}
-			}
-		}
-		err := sc.LastErr()
-		if err == nil && len(users) < int(pageSize) {
-			err = errs.NothingToDo{}
+		return nil, ErrClosed
+	}
+	s, err := c.schema(ctx)
+	if err != nil {
+		return nil, err
+	}
+	bases, err := c.resolveOUs(ctx, s, scope, ous)
+	if err != nil {
+		return nil, err
+	}
+	mapper := func(ent *ldap.Entry) interface{} { return mapToUser(s, ent) }
+	fs := make([]func() (interface{}, error), 0, len(bases))
+	releases := make([]func(), 0, len(bases))
+	ids := make([]string, 0, len(bases))
+	for _, base := range bases {
+		req := ldap.NewSearchRequest(base, scope.ldapScope(), ldap.NeverDerefAliases, 0, timeLimit(c.opt.timeout), false,
+			s.Users.String(), c.userAttributes(s), nil)
+		ps := c.pagedRetriever(ctx, pageSize, req, mapper)
+		if len(bases) == 1 {
+			return newPagedScanner(ps), nil
 		}
-		return users, err
+		fs, releases, ids = append(fs, ps.next), append(releases, ps.release), append(ids, ps.identity)
 	}
-	usc := newScanner(uf)
-	return usc, nil
+	return newScanner(searchIdentity(ids), chainRetriever(pageSize, fs...), releases...), nil
+}
+
+// SearchOptions tune Search, the zero value is a subtree search of the base DN for every user attribute
+type SearchOptions struct {
+	// Attributes to return: names, AllAttributes, OperationalAttributes or NoAttributes for DNs only
+	Attributes []string
+	// BaseDN replaces the client base DN
+	BaseDN string
+	// Scope is ScopeSubtree unless set, with or without BaseDN
+	Scope Scope
+	// SizeLimit caps the number of entries, 0 is no limit
+	SizeLimit int
+	// TimeLimit is the server time limit, rounded up to seconds, 0 is the client timeout
+	TimeLimit time.Duration
+	Deref     Deref
+	// TypesOnly returns attribute names without values
+	TypesOnly bool
+	// Controls are sent with the request, a paging control turns off the paging done by Search
+	Controls []ldap.Control
+	// Sort has the server sort the results
+	Sort []SortKey
+	// View reads one sorted window instead of every result, its Sort falls back to the one above
+	View *View
+}
+
+// SearchResult is what SearchWithOptions found
+type SearchResult struct {
+	Entries []map[string]interface{}
+	// Controls are the response controls of the last request
+	Controls []ldap.Control
+	// Partial is set when SizeLimit, a server size, time or admin limit cut the results short
+	Partial bool
+	// View places the entries in the list when SearchOptions.View was set
+	View ViewResult
 }
 
 func (c *Client) Search(query string) ([]map[string]interface{}, error) {
+	return c.SearchContext(context.Background(), query)
+}
+
+func (c *Client) SearchContext(ctx context.Context, query string) ([]map[string]interface{}, error) {
+	res, err := c.SearchWithOptionsContext(ctx, query, SearchOptions{})
+	return res.Entries, err
+}
+
+func (c *Client) SearchWithOptions(query string, o SearchOptions) (SearchResult, error) {
+	return c.SearchWithOptionsContext(context.Background(), query, o)
+}
+
+// SearchWithOptionsContext pages through the results on one connection, so the entries found before a limit
+// was hit are returned rather than dropped.
+func (c *Client) SearchWithOptionsContext(ctx context.Context, query string, o SearchOptions) (SearchResult, error) {
 	if c.isClosed() {
-		return nil, errors.New("client is closed")
+		return SearchResult{}, ErrClosed
 	}
-	searchRequest := c.searchRequest(query)
+	searchRequest := c.optionsRequest(query, o)
+	var (
+		entries []*ldap.Entry
+		res     SearchResult
+		err     error
+	)
+	if o.View != nil {
+		v := *o.View
+		if len(v.Sort) == 0 {
+			v.Sort = o.Sort
+		}
+		if entries, res.Controls, res.View, err = c.viewSearch(ctx, searchRequest, v); err != nil {
+			return SearchResult{}, err
+		}
+	} else {
+		entries, res.Controls, res.Partial, err = c.limitedSearch(ctx, searchRequest, o.SizeLimit)
+		if err != nil {
+			return SearchResult{}, errors.Wrap(err, "ldap search")
+		}
+		if res.Controls, err = decodeControls(res.Controls); err != nil {
+			return SearchResult{}, err
+		}
+	}
+	res.Entries = make([]map[string]interface{}, 0, len(entries))
+	for _, e := range entries {
+		res.Entries = append(res.Entries, entryMap(e))
+	}
+	return res, nil
+}
+
+// entryMap is a Search result: the DN under "DN" and the values decoded by attributeValues
+func entryMap(e *ldap.Entry) map[string]interface{} {
+	item := make(map[string]interface{}, len(e.Attributes)+1)
+	item["DN"] = e.DN
+	for _, attr := range e.Attributes {
+		item[attr.Name] = attributeValues(attr)
+	}
+	return item
+}
+
+func (c *Client) SearchInto(query string, dst interface{}) error {
+	return c.SearchIntoContext(context.Background(), query, dst)
+}
+
+// SearchIntoContext decodes every found entry with Unmarshal and appends it to the slice dst points to.
+func (c *Client) SearchIntoContext(ctx context.Context, query string, dst interface{}) error {
+	if c.isClosed() {
+		return ErrClosed
+	}
+	searchRequest := c.searchRequest(query, destAttributes(dst))
 	var (
 		err error
 		sr  *ldap.SearchResult
 	)
-	search := func() (done chan struct{}) {
+	search := func(con *ldap.Conn) (done chan struct{}) {
 		done = make(chan struct{})
 		go func() {
 			defer close(done)
-			sr, err = c.con.Search(searchRequest)
+			sr, err = con.Search(searchRequest)
+			err = ldapError(err)
 		}()
 		return
 	}
-	err = errs.Merge(err, c.concurrentDo(search))
+	err = doError(err, c.concurrentDo(ctx, search))
 	if err != nil {
-		return nil, errors.Wrap(err, "ldap search")
+		return errors.Wrap(err, "ldap search")
 	}
-
-	res := make([]map[string]interface{}, 0, len(sr.Entries))
+	items := make([]interface{}, 0, len(sr.Entries))
 	for _, e := range sr.Entries {
-		item := make(map[string]interface{})
-		item["DN"] = e.DN
-		for _, attr := range e.Attributes {
-			item[attr.Name] = attr.Values
-		}
-		res = append(res, item)
+		items = append(items, scanItem{entry: e})
 	}
-
-	return res, nil
+	return appendItems(dst, items)
 }
 
 func (c *Client) OrganizationalUnits(pageSize uint32) (ResultsScanner, error) {
+	return c.OrganizationalUnitsContext(context.Background(), pageSize)
+}
+
+func (c *Client) OrganizationalUnitsContext(ctx context.Context, pageSize uint32) (ResultsScanner, error) {
 	if c.isClosed() {
-		return nil, errors.New("client is closed")
+		return nil, ErrClosed
+	}
+	s, err := c.schema(ctx)
+	if err != nil {
+		return nil, err
 	}
-	f := c.retriever(pageSize,
-		"(objectCategory=organizationalUnit)",
-		func(v *ldap.Entry) interface{} { return mapToUnit(v) })
-	sc := newScanner(f)
+	sc := newPagedScanner(c.retriever(ctx, pageSize,
+		s.Units.String(),
+		c.unitAttributes(s),
+		func(v *ldap.Entry) interface{} { return mapToUnit(s, v) }))
 	return sc, nil
 }
 
 func (c *Client) Groups(pageSize uint32) (ResultsScanner, error) {
+	return c.GroupsContext(context.Background(), pageSize)
+}
+
+func (c *Client) GroupsContext(ctx context.Context, pageSize uint32) (ResultsScanner, error) {
 	if c.isClosed() {
-		return nil, errors.New("client is closed")
+		return nil, ErrClosed
 	}
-	f := c.retriever(pageSize,
-		"(|(objectclass=group)(objectclass=groupofnames)(objectclass=groupofuniquenames)(objectCategory=group))",
-		func(v *ldap.Entry) interface{} { return mapToGroup(v) })
-	sc := newScanner(f)
+	s, err := c.schema(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sc := newPagedScanner(c.retriever(ctx, pageSize,
+		s.Groups.String(),
+		c.groupAttributes(s),
+		func(v *ldap.Entry) interface{} { return mapToGroup(s, v) }))
 	return sc, nil
 }
 
-func (c *Client) SearchByLogon(loginName string) (user User, err error) {
+func (c *Client) SearchByLogon(loginName string) (User, error) {
+	return c.SearchByLogonContext(context.Background(), loginName)
+}
+
+func (c *Client) SearchByLogonContext(ctx context.Context, loginName string) (user User, err error) {
 	if c.isClosed() {
-		err = errors.New("client is closed")
+		err = ErrClosed
+		return
+	}
+	s, err := c.schema(ctx)
+	if err != nil {
 		return
 	}
 	loginName = loginNameNormalize(loginName)
-	searchRequest := c.searchRequest(fmt.Sprintf(
-		"(&(objectClass=organizationalPerson)(|(sAMAccountName:=%s)(userPrincipalName:=%s)))",
-		loginName, loginName))
+	f := s.loginFilter(loginName)
+	if i := strings.LastIndex(loginName, "@"); i > 0 {
+		// user@domain is a UPN or mail, otherwise its local part is the login
+		f = Or(f, s.loginFilter(loginName[:i]))
+	}
+	// persons of every profile derive from organizationalPerson
+	searchRequest := c.searchRequest(And(
+		Eq("objectClass", "organizationalPerson"),
+		f,
+	).String(), c.userAttributes(s))
 	var sr *ldap.SearchResult
-	search := func() (done chan struct{}) {
+	search := func(con *ldap.Conn) (done chan struct{}) {
 		done = make(chan struct{})
 		go func() {
 			defer close(done)
-			sr, err = c.con.Search(searchRequest)
+			sr, err = con.Search(searchRequest)
+			err = ldapError(err)
 		}()
 		return
 	}
-	err = errs.Merge(err, c.concurrentDo(search))
+	err = doError(err, c.concurrentDo(ctx, search))
 	if err != nil {
 		return
 	}
 	if len(sr.Entries) == 0 {
-		err = errors.New("user does not exist")
+		err = ErrUserNotFound
 		return
 	}
-	return mapToUser(sr.Entries[0]), nil
+	return mapToUser(s, exactLogin(s, sr.Entries, loginName)), nil
+}
+
+// exactLogin prefers the entry with the whole login, so bob@other.org does not resolve to bob of this domain
+func exactLogin(s *Schema, entries []*ldap.Entry, login string) *ldap.Entry {
+	for _, e := range entries {
+		for _, a := range s.LoginAttrs {
+			if attr := attribute(e, a); attr != nil {
+				for _, v := range attr.Values {
+					if strings.EqualFold(v, login) {
+						return e
+					}
+				}
+			}
+		}
+	}
+	return entries[0]
+}
+
+// pagedSearch reads a page per next call on the connection the previous page came from, servers keep
+// the paging state per connection. release gives the connection back before the last page.
+type pagedSearch struct {
+	next    func() (interface{}, error)
+	release func()
+	paging  *ldap.ControlPaging
+	// identity tells searches apart, so a cursor is not resumed by another one
+	identity string
 }
 
-func (c *Client) retriever(pageSize uint32, query string,
-	mapper func(entry *ldap.Entry) interface{}) func() (interface{}, error) {
+func (c *Client) retriever(ctx context.Context, pageSize uint32, query string, attrs []string,
+	mapper func(entry *ldap.Entry) interface{}) *pagedSearch {
+	return c.pagedRetriever(ctx, pageSize, c.searchRequest(query, attrs), mapper)
+}
+
+func (c *Client) pagedRetriever(ctx context.Context, pageSize uint32, searchRequest *ldap.SearchRequest,
+	mapper func(entry *ldap.Entry) interface{}) *pagedSearch {
 	pagingControl := ldap.NewControlPaging(pageSize)
-	searchRequest := c.searchRequest(query, pagingControl)
-	return func() (interface{}, error) {
+	searchRequest.Controls = append(searchRequest.Controls, pagingControl)
+	pin := &pinnedConn{c: c}
+	next := func() (interface{}, error) {
 		var (
 			err error
 			sr  *ldap.SearchResult
 		)
-		search := func() (done chan struct{}) {
+		search := func(con *ldap.Conn) (done chan struct{}) {
 			done = make(chan struct{})
 			go func() {
 				defer close(done)
-				sr, err = c.con.Search(searchRequest)
+				sr, err = con.Search(searchRequest)
+				err = ldapError(err)
 			}()
 			return
 		}
-		err = errs.Merge(err, c.concurrentDo(search))
+		err = doError(err, pin.do(ctx, search))
 		if err != nil {
+			pin.release()
 			return nil, errors.Wrap(err, "ldap retriever in search")
 		}
 		items := make([]interface{}, 0, len(sr.Entries))
 		for _, e := range sr.Entries {
-			items = append(items, mapper(e))
+			items = append(items, scanItem{value: mapper(e), entry: e})
 		}
 
 		var er error
@@ -292,117 +487,230 @@ func (c *Client) retriever(pageSize uint32, query string,
 		if ctrl, ok := updatedControl.(*ldap.ControlPaging); ctrl != nil && ok && len(ctrl.Cookie) != 0 {
 			pagingControl.SetCookie(ctrl.Cookie)
 		} else {
+			pin.release()
 			er = errs.NothingToDo{}
 		}
 		return items, er
 	}
+	return &pagedSearch{
+		next:    next,
+		release: pin.release,
+		paging:  pagingControl,
+		identity: searchIdentity(searchRequest.BaseDN, searchRequest.Scope, searchRequest.Filter,
+			searchRequest.Attributes),
+	}
 }
 
-func (c *Client) concurrentDo(f concurrentFunc) (err error) {
+func (c *Client) concurrentDo(ctx context.Context, f concurrentFunc) error {
+	return c.do(ctx, f, false, false)
+}
+
+func (c *Client) concurrentBind(ctx context.Context, f concurrentFunc) error {
+	return c.do(ctx, f, true, false)
+}
+
+// do runs f on a pool connection and runs it again on another one when the connection breaks, unless it timed out
+// or ctx is done. A write is run again only when it was never sent: the server may have applied it already.
+func (c *Client) do(ctx context.Context, f concurrentFunc, rebind, write bool) (err error) {
 	var i int32
-	defer func() {
-		if e := recover(); e != nil {
-			c.reconnect()
-			err = errors.New(fmt.Sprintf("recovered in concurrentDo = %v", e))
-		}
-	}()
 Retry:
 	if c.isClosed() {
-		return errors.New("client is closed")
+		return ErrClosed
+	}
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	pc, err := c.pool.get(ctx, c.opt.timeout)
+	if err != nil {
+		return err
+	}
+	broken, sent, err := c.run(ctx, pc, f)
+	pc.dirty = rebind
+	c.pool.put(pc, broken)
+	if err == nil && ctx.Err() == nil && (!write || !sent) && c.needRetry(broken, &i) {
+		goto Retry
 	}
-	done := make(chan struct{})
-	wrap := func() chan struct{} {
-		defer func() { err = errs.Merge(err, c.bindAdmin()) }()
-		tick := time.NewTicker(c.opt.timeout)
+	return
+}
+
+// run does f on the connection of pc, broken is set when the connection can not be used any more. err is set when
+// f timed out or ctx is done. sent is false when the connection was closed before f, go-ldap writes nothing then.
+func (c *Client) run(ctx context.Context, pc *poolConn, f concurrentFunc) (broken, sent bool, err error) {
+	sent = !pc.con.IsClosing()
+	func() {
+		defer func() {
+			if e := recover(); e != nil {
+				broken = true
+				err = errors.New(fmt.Sprintf("recovered in concurrentDo = %v", e))
+			}
+		}()
+		tick := time.NewTimer(c.opt.timeout)
 		defer tick.Stop()
+		done := f(pc.con)
 		select {
 		case <-tick.C:
-			err = errors.New("concurrentDo timeout")
-		case <-f():
+			err = errors.Wrap(ErrTimeout, "concurrentDo")
+		case <-ctx.Done():
+			err = ctx.Err()
+		case <-done:
+			return
 		}
-		return done
+		// closing the connection releases the pending operation
+		pc.con.Close()
+		<-done
+		broken = true
+	}()
+	return broken || pc.con.IsClosing(), sent, err
+}
+
+func (c *Client) isClosed() bool {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.closed
+}
+
+func (c *Client) search(ctx context.Context, req *ldap.SearchRequest) (sr *ldap.SearchResult, err error) {
+	err = c.exec(ctx, func(con *ldap.Conn) (e error) {
+		sr, e = con.Search(req)
+		return
+	})
+	return
+}
+
+func (c *Client) exec(ctx context.Context, f func(con *ldap.Conn) error) (err error) {
+	op := func(con *ldap.Conn) (done chan struct{}) {
+		done = make(chan struct{})
+		go func() {
+			defer close(done)
+			err = ldapError(f(con))
+		}()
+		return
 	}
-	c.comCh <- wrap
-	<-done
-	if c.needRetry(err, &i) {
-		goto Retry
+	err = doError(err, c.concurrentDo(ctx, op))
+	return
+}
+
+// write is exec for add, modify and delete requests, they are not sent twice
+func (c *Client) write(ctx context.Context, f func(con *ldap.Conn) error) (err error) {
+	op := func(con *ldap.Conn) (done chan struct{}) {
+		done = make(chan struct{})
+		go func() {
+			defer close(done)
+			err = ldapError(f(con))
+		}()
+		return
 	}
+	err = doError(err, c.do(ctx, op, false, true))
 	return
 }
 
-func (c *Client) isClosed() bool {
-	return c.closed
+// doError is the result of an operation run by do. An error of do itself, a timeout, a done context or a closed
+// client, wins over the one closing the connection left in the operation, so errors.Is matches its sentinel.
+func doError(op, do error) error {
+	if do != nil {
+		return do
+	}
+	return op
 }
 
-func (c *Client) searchRequest(query string, cs ...ldap.Control) *ldap.SearchRequest {
+// searchRequest searches the base DN subtree for attrs, nil attrs are defaultAttributes
+func (c *Client) searchRequest(query string, attrs []string, cs ...ldap.Control) *ldap.SearchRequest {
+	if len(attrs) == 0 {
+		attrs = defaultAttributes
+	}
 	return ldap.NewSearchRequest(
 		c.opt.dn,
-		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, int(c.opt.timeout), false,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, timeLimit(c.opt.timeout), false,
 		query,
-		[]string{},
+		attrs,
 		cs,
 	)
 }
 
-func (c *Client) serveCommands(ctx context.Context) {
-	for {
-		select {
-		case <-ctx.Done():
-			c.Close()
-			return
-		case f, ok := <-c.comCh:
-			if !ok {
-				return
+func (c *Client) closeOnDone(ctx context.Context) {
+	select {
+	case <-ctx.Done():
+		c.Close()
+	case <-c.pool.done:
+	}
+}
+
+func (c *Client) dial(ctx context.Context) (*ldap.Conn, error) {
+	type dialed struct {
+		con *ldap.Conn
+		err error
+	}
+	res := make(chan dialed, 1)
+	go func() {
+		cfg := c.opt.tlsConfig()
+		l, err := ldap.DialURL(c.opt.url,
+			ldap.DialWithDialer(&net.Dialer{Timeout: c.opt.timeout}),
+			ldap.DialWithTLSConfig(cfg))
+		if err == nil && c.opt.startTLS {
+			if err = l.StartTLS(cfg); err != nil {
+				l.Close()
+				l, err = nil, errors.Wrap(err, "ldap StartTLS")
 			}
-			done := f()
-			close(done)
 		}
+		res <- dialed{con: l, err: err}
+	}()
+	var (
+		d   dialed
+		err error
+	)
+	select {
+	case <-time.After(c.opt.timeout):
+		err = errors.Wrap(ErrTimeout, "new ldap Client Dial")
+	case <-ctx.Done():
+		err = ctx.Err()
+	case d = <-res:
 	}
+	if err != nil {
+		go func() {
+			if d := <-res; d.con != nil {
+				d.con.Close()
+			}
+		}()
+		return nil, err
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	if c.opt.debug {
+		d.con.Debug.Enable(true)
+	}
+	if err = c.bindAdmin(ctx, d.con); err != nil {
+		d.con.Close()
+		return nil, err
+	}
+	return d.con, nil
 }
 
-func (c *Client) bindAdmin() (err error) {
-	if c.isClosed() {
-		return errors.New("client is closed")
-	}
+func (c *Client) bindAdmin(ctx context.Context, con *ldap.Conn) (err error) {
 	defer func() {
 		if e := recover(); e != nil {
 			err = errors.New(fmt.Sprintf("recovered in bindAdmin = %v", e))
-			c.reconnect()
 		}
 	}()
-	var i int32
-Retry:
-	done := make(chan struct{})
+	res := make(chan error, 1)
 	go func() {
-		err = c.con.Bind(c.opt.usr, c.opt.pass)
-		close(done)
+		res <- ldapError(con.Bind(c.opt.usr, c.opt.pass))
 	}()
 	select {
 	case <-time.After(c.opt.timeout):
-		err = errors.New("bindAdmin timeout")
-	case <-done:
-	}
-	if c.needRetry(err, &i) {
-		goto Retry
+		err = errors.Wrap(ErrTimeout, "bindAdmin")
+	case <-ctx.Done():
+		err = ctx.Err()
+	case err = <-res:
 	}
 	return
 }
 
-func (c *Client) needRetry(err error, trying *int32) bool {
-	if err == nil || !ldap.IsErrorWithCode(err, ldap.ErrorNetwork) && *trying >= 10 {
+func (c *Client) needRetry(broken bool, trying *int32) bool {
+	if !broken || atomic.LoadInt32(trying) >= maxRetries {
 		return false
 	}
 	atomic.AddInt32(trying, 1)
-	c.reconnect()
-	return true
-}
-
-func (c *Client) reconnect() {
-	defer func() {
-		if e := recover(); e != nil {
-			log.Println("recover on reconnect()", e)
-		}
-	}()
-	c.con.Start()
 	time.Sleep(sleepTimeout)
+	return true
 }
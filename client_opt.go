@@ -1,14 +1,18 @@
 package ldap
 
+// noinspection GoRedundantImportAlias
 import (
+	"crypto/tls"
+	"net/url"
 	"strings"
 	"time"
 
+	ldap "github.com/go-ldap/ldap/v3"
 	"github.com/pkg/errors"
 	"github.com/shubinmi/util/errs"
 )
 
-type concurrentFunc func() (done chan struct{})
+type concurrentFunc func(con *ldap.Conn) (done chan struct{})
 
 type opt struct {
 	url     string
@@ -17,13 +21,30 @@ type opt struct {
 	dn      string
 	timeout time.Duration
 	debug   bool
+
+	accountCheck bool
+	schema       *Schema
+	extraAttrs   []string
+
+	tls                *tls.Config
+	startTLS           bool
+	insecureSkipVerify bool
+
+	poolMin         int
+	poolMax         int
+	poolIdleTimeout time.Duration
+	poolHealthCheck time.Duration
 }
 
 type optF func(*opt)
 
 func newOpt(fs ...optF) (*opt, error) {
 	o := &opt{
-		timeout: 5 * time.Second,
+		timeout:         5 * time.Second,
+		poolMin:         1,
+		poolMax:         10,
+		poolIdleTimeout: 5 * time.Minute,
+		poolHealthCheck: 30 * time.Second,
 	}
 	for _, f := range fs {
 		f(o)
@@ -45,6 +66,15 @@ func (o *opt) valid() (err error) {
 	if o.dn == "" {
 		err = errs.Merge(err, errors.New("dn is required"))
 	}
+	if o.poolMin < 0 || o.poolMax < 1 || o.poolMin > o.poolMax {
+		err = errs.Merge(err, errors.New("pool size must satisfy 0 <= min <= max and max >= 1"))
+	}
+	if o.startTLS && strings.HasPrefix(strings.ToLower(o.url), "ldaps://") {
+		err = errs.Merge(err, errors.New("start tls can not be used with ldaps url"))
+	}
+	if o.poolIdleTimeout <= 0 {
+		err = errs.Merge(err, errors.New("pool idle timeout must be positive"))
+	}
 	return
 }
 
@@ -72,6 +102,66 @@ func WithDebug() func(*opt) {
 	}
 }
 
+// WithAccountCheck makes Auth refuse disabled, locked and expired accounts once the password is verified,
+// the error is one of ErrAccount* and ErrPassword*
+func WithAccountCheck() func(*opt) {
+	return func(o *opt) {
+		o.accountCheck = true
+	}
+}
+
+// WithSchema sets the directory profile instead of detecting it from RootDSE
+func WithSchema(s Schema) func(*opt) {
+	return func(o *opt) {
+		o.schema = &s
+	}
+}
+
+// WithExtraAttributes adds attributes to the ones the built-in user, group and unit searches request,
+// so Setter can fill types with more fields; AllAttributes brings everything back
+func WithExtraAttributes(attrs ...string) func(*opt) {
+	return func(o *opt) {
+		o.extraAttrs = append(o.extraAttrs, attrs...)
+	}
+}
+
+func WithTLSConfig(cfg *tls.Config) func(*opt) {
+	return func(o *opt) {
+		o.tls = cfg
+	}
+}
+
+func WithStartTLS() func(*opt) {
+	return func(o *opt) {
+		o.startTLS = true
+	}
+}
+
+func WithInsecureSkipVerify() func(*opt) {
+	return func(o *opt) {
+		o.insecureSkipVerify = true
+	}
+}
+
+func WithPoolSize(min, max int) func(*opt) {
+	return func(o *opt) {
+		o.poolMin = min
+		o.poolMax = max
+	}
+}
+
+func WithPoolIdleTimeout(t time.Duration) func(*opt) {
+	return func(o *opt) {
+		o.poolIdleTimeout = t
+	}
+}
+
+func WithPoolHealthCheck(t time.Duration) func(*opt) {
+	return func(o *opt) {
+		o.poolHealthCheck = t
+	}
+}
+
 func WithAdmin(usr, pass string) func(*opt) {
 	return func(o *opt) {
 		o.usr = usr
@@ -79,10 +169,25 @@ func WithAdmin(usr, pass string) func(*opt) {
 	}
 }
 
+func (o *opt) tlsConfig() *tls.Config {
+	cfg := &tls.Config{}
+	if o.tls != nil {
+		cfg = o.tls.Clone()
+	}
+	if o.insecureSkipVerify {
+		cfg.InsecureSkipVerify = true
+	}
+	if cfg.ServerName == "" {
+		// StartTLS upgrades an established connection, so the name is not known to crypto/tls
+		if u, e := url.Parse(o.url); e == nil {
+			cfg.ServerName = u.Hostname()
+		}
+	}
+	return cfg
+}
+
+// loginNameNormalize drops the NetBIOS domain of DOMAIN\login, user@domain is kept as a UPN
 func loginNameNormalize(loginName string) string {
 	logon := strings.Split(loginName, `\`)
-	loginName = logon[len(logon)-1]
-	logon = strings.Split(loginName, `@`)
-	loginName = logon[0]
-	return loginName
+	return logon[len(logon)-1]
 }
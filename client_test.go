@@ -7,9 +7,17 @@ import (
 	"testing"
 	"time"
 
+	"github.com/pkg/errors"
+	"github.com/shubinmi/ldap/ldaptest"
 	"github.com/spf13/viper"
 )
 
+const (
+	testsConf = "./tests_conf.json"
+	// testDirectory is the AD like directory the test admin corp\test.user belongs to
+	testDirectory = "./testdata/directory.ldif"
+)
+
 func client(t *testing.T) *Client {
 	client, err := New(context.Background(),
 		WithTimeout(5*time.Second),
@@ -22,12 +30,49 @@ func client(t *testing.T) *Client {
 	return client
 }
 
+// testServer starts an ldaptest server, close it when the test is done
+func testServer(t *testing.T, fs ...ldaptest.Option) *ldaptest.Server {
+	srv, err := ldaptest.NewServer(fs...)
+	if err != nil {
+		t.Fatal("ldaptest start", err)
+	}
+	return srv
+}
+
+// testClient connects to srv as the test admin with the base DN of srv, opts override them
+func testClient(t *testing.T, srv *ldaptest.Server, opts ...optF) *Client {
+	c, err := New(context.Background(), append([]optF{
+		WithURL(srv.URL()), WithBaseDN(srv.BaseDN()), WithAdmin(`corp\test.user`, "testPass"),
+	}, opts...)...)
+	if err != nil {
+		t.Fatal("ldap connect", err)
+	}
+	return c
+}
+
 func TestMain(m *testing.M) {
-	viper.SetConfigFile("./tests_conf.json")
-	if e := viper.ReadInConfig(); e != nil {
-		panic(e)
+	if _, e := os.Stat(testsConf); e == nil {
+		viper.SetConfigFile(testsConf)
+		if e := viper.ReadInConfig(); e != nil {
+			panic(e)
+		}
+		os.Exit(m.Run())
+	}
+	srv, err := ldaptest.NewServer(ldaptest.WithLDIFFile(testDirectory))
+	if err != nil {
+		panic(err)
 	}
-	os.Exit(m.Run())
+	viper.Set("ldap.url", srv.URL())
+	viper.Set("ldap.dn", srv.BaseDN())
+	viper.Set("ldap.user", `corp\test.user`)
+	viper.Set("ldap.pass", "testPass")
+	viper.Set("tests.client.auth.dn", "CN=Test User,OU=Users,OU=St-Petersburg,OU=Staff,DC=corp,DC=test,DC=com")
+	viper.Set("tests.client.groupUsers.nodeDN", "CN=Clients,OU=Products,OU=Service Accounts,DC=corp,DC=test,DC=com")
+	viper.Set("tests.client.ouUsers.nodeDN", "TestGroup")
+	viper.Set("tests.client.ouUsers.wantNames", []string{"Test 1", "Test 2"})
+	code := m.Run()
+	srv.Close()
+	os.Exit(code)
 }
 
 func TestClient_Auth(t *testing.T) {
@@ -66,6 +111,15 @@ func TestClient_Auth(t *testing.T) {
 			wantUser: User{},
 			wantErr:  true,
 		},
+		{
+			name: "filter injection",
+			fields: fields{
+				cl: client,
+			},
+			args:     args{usr: "*)(sAMAccountName=*", pass: viper.GetString("ldap.pass")},
+			wantUser: User{},
+			wantErr:  true,
+		},
 	}
 	for _, test := range tests {
 		tt := test
@@ -342,3 +396,37 @@ func TestClient_OUUsers(t *testing.T) {
 		})
 	}
 }
+
+func TestClient_Context(t *testing.T) {
+	c := client(t)
+	defer c.Close()
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	expired, cancelExpired := context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancelExpired()
+	<-expired.Done()
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		wantErr error
+	}{
+		{name: "background", ctx: context.Background()},
+		{name: "canceled", ctx: canceled, wantErr: context.Canceled},
+		{name: "deadline", ctx: expired, wantErr: context.DeadlineExceeded},
+	}
+	for _, test := range tests {
+		tt := test
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := c.SearchByLogonContext(tt.ctx, viper.GetString("ldap.user"))
+			if errors.Cause(err) != tt.wantErr {
+				t.Errorf("SearchByLogonContext() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err = c.PingContext(tt.ctx); errors.Cause(err) != tt.wantErr {
+				t.Errorf("PingContext() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+	if _, err := c.SearchByLogon(viper.GetString("ldap.user")); err != nil {
+		t.Errorf("SearchByLogon() after canceled calls error = %v", err)
+	}
+}
@@ -0,0 +1,291 @@
+package ldap
+
+// noinspection GoRedundantImportAlias
+import (
+	"fmt"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	ldap "github.com/go-ldap/ldap/v3"
+	"github.com/pkg/errors"
+)
+
+const (
+	// ControlTypeSort is the Server Side Sort request control of RFC 2891
+	ControlTypeSort = "1.2.840.113556.1.4.473"
+	// ControlTypeSortResult is the Server Side Sort response control of RFC 2891
+	ControlTypeSortResult = "1.2.840.113556.1.4.474"
+	// ControlTypeVLV is the Virtual List View request control
+	ControlTypeVLV = "2.16.840.1.113730.3.4.9"
+	// ControlTypeVLVResponse is the Virtual List View response control
+	ControlTypeVLVResponse = "2.16.840.1.113730.3.4.10"
+	// ControlTypePersistentSearch is the Persistent Search request control of draft-ietf-ldapext-psearch
+	ControlTypePersistentSearch = "2.16.840.1.113730.3.4.3"
+	// ControlTypeEntryChange comes with the entries of a persistent search
+	ControlTypeEntryChange = "2.16.840.1.113730.3.4.7"
+)
+
+// Persistent search change types, ControlPersistentSearch takes a mask of them
+const (
+	PersistentSearchAdd    = 1
+	PersistentSearchDelete = 2
+	PersistentSearchModify = 4
+	PersistentSearchModDN  = 8
+)
+
+// SortKey orders the results by the first value of Attribute
+type SortKey struct {
+	Attribute string
+	// MatchingRule is an ordering rule OID, empty for the attribute default
+	MatchingRule string
+	Reverse      bool
+}
+
+type ControlSort struct {
+	Keys        []SortKey
+	Criticality bool
+}
+
+// NewControlSort is a critical sort control, servers that can not sort fail the search rather than ignore it
+func NewControlSort(keys ...SortKey) *ControlSort {
+	return &ControlSort{Keys: keys, Criticality: true}
+}
+
+func (c *ControlSort) GetControlType() string {
+	return ControlTypeSort
+}
+
+func (c *ControlSort) Encode() *ber.Packet {
+	keys := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Sort Key List")
+	for _, k := range c.Keys {
+		key := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Sort Key")
+		key.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, k.Attribute, "Attribute Type"))
+		if k.MatchingRule != "" {
+			key.AppendChild(ber.NewString(ber.ClassContext, ber.TypePrimitive, 0, k.MatchingRule, "Ordering Rule"))
+		}
+		if k.Reverse {
+			key.AppendChild(ber.NewBoolean(ber.ClassContext, ber.TypePrimitive, 1, true, "Reverse Order"))
+		}
+		keys.AppendChild(key)
+	}
+	return encodeControl(ControlTypeSort, c.Criticality, keys)
+}
+
+func (c *ControlSort) String() string {
+	return fmt.Sprintf("Control Type: %s (%q)  Criticality: %t  Keys: %v", "Server Side Sort", ControlTypeSort,
+		c.Criticality, c.Keys)
+}
+
+// ControlSortResult tells whether the server sorted the results, Attribute names the key it failed on
+type ControlSortResult struct {
+	Result    uint16
+	Attribute string
+}
+
+func (c *ControlSortResult) GetControlType() string {
+	return ControlTypeSortResult
+}
+
+func (c *ControlSortResult) Encode() *ber.Packet {
+	seq := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Sort Result")
+	seq.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, uint64(c.Result), "Sort Result"))
+	if c.Attribute != "" {
+		seq.AppendChild(ber.NewString(ber.ClassContext, ber.TypePrimitive, 0, c.Attribute, "Attribute Type"))
+	}
+	return encodeControl(ControlTypeSortResult, false, seq)
+}
+
+func (c *ControlSortResult) String() string {
+	return fmt.Sprintf("Control Type: %s (%q)  Result: %d  Attribute: %s", "Server Side Sort Result",
+		ControlTypeSortResult, c.Result, c.Attribute)
+}
+
+// ControlVLV asks for BeforeCount and AfterCount entries around a target of the sorted results.
+// The target is the entry at Offset of ContentCount, or the first one not below GreaterOrEqual when it is set.
+type ControlVLV struct {
+	BeforeCount int
+	AfterCount  int
+	// Offset is 1-based, relative to ContentCount, 0 ContentCount takes the server count
+	Offset         int
+	ContentCount   int
+	GreaterOrEqual string
+	// ContextID is the one of the previous response, servers use it to keep the list state
+	ContextID   []byte
+	Criticality bool
+}
+
+func (c *ControlVLV) GetControlType() string {
+	return ControlTypeVLV
+}
+
+func (c *ControlVLV) Encode() *ber.Packet {
+	seq := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Virtual List View")
+	seq.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, c.BeforeCount, "Before Count"))
+	seq.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, c.AfterCount, "After Count"))
+	if c.GreaterOrEqual != "" {
+		seq.AppendChild(ber.NewString(ber.ClassContext, ber.TypePrimitive, 1, c.GreaterOrEqual, "Greater Than Or Equal"))
+	} else {
+		offset := ber.Encode(ber.ClassContext, ber.TypeConstructed, 0, nil, "By Offset")
+		offset.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, c.Offset, "Offset"))
+		offset.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, c.ContentCount, "Content Count"))
+		seq.AppendChild(offset)
+	}
+	if len(c.ContextID) > 0 {
+		seq.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, string(c.ContextID), "Context ID"))
+	}
+	return encodeControl(ControlTypeVLV, c.Criticality, seq)
+}
+
+func (c *ControlVLV) String() string {
+	return fmt.Sprintf("Control Type: %s (%q)  Criticality: %t  Before: %d  After: %d  Offset: %d  ContentCount: %d  "+
+		"GreaterOrEqual: %q", "Virtual List View", ControlTypeVLV, c.Criticality, c.BeforeCount, c.AfterCount,
+		c.Offset, c.ContentCount, c.GreaterOrEqual)
+}
+
+// ControlVLVResponse is the 1-based position of the target entry and the server estimate of the list size
+type ControlVLVResponse struct {
+	TargetPosition int
+	ContentCount   int
+	Result         uint16
+	ContextID      []byte
+}
+
+func (c *ControlVLVResponse) GetControlType() string {
+	return ControlTypeVLVResponse
+}
+
+func (c *ControlVLVResponse) Encode() *ber.Packet {
+	seq := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Virtual List View Response")
+	seq.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, c.TargetPosition, "Target Position"))
+	seq.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, c.ContentCount, "Content Count"))
+	seq.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, uint64(c.Result), "Result"))
+	if len(c.ContextID) > 0 {
+		seq.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, string(c.ContextID), "Context ID"))
+	}
+	return encodeControl(ControlTypeVLVResponse, false, seq)
+}
+
+func (c *ControlVLVResponse) String() string {
+	return fmt.Sprintf("Control Type: %s (%q)  TargetPosition: %d  ContentCount: %d  Result: %d",
+		"Virtual List View Response", ControlTypeVLVResponse, c.TargetPosition, c.ContentCount, c.Result)
+}
+
+// ControlPersistentSearch keeps a search open and sends the entries of ChangeTypes as they change.
+// ChangesOnly skips the entries found at the start, ReturnECs adds ControlEntryChange to the entries.
+type ControlPersistentSearch struct {
+	ChangeTypes int
+	ChangesOnly bool
+	ReturnECs   bool
+	Criticality bool
+}
+
+func (c *ControlPersistentSearch) GetControlType() string {
+	return ControlTypePersistentSearch
+}
+
+func (c *ControlPersistentSearch) Encode() *ber.Packet {
+	seq := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Persistent Search")
+	seq.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, c.ChangeTypes, "Change Types"))
+	seq.AppendChild(ber.NewBoolean(ber.ClassUniversal, ber.TypePrimitive, ber.TagBoolean, c.ChangesOnly, "Changes Only"))
+	seq.AppendChild(ber.NewBoolean(ber.ClassUniversal, ber.TypePrimitive, ber.TagBoolean, c.ReturnECs, "Return ECs"))
+	return encodeControl(ControlTypePersistentSearch, c.Criticality, seq)
+}
+
+func (c *ControlPersistentSearch) String() string {
+	return fmt.Sprintf("Control Type: %s (%q)  Criticality: %t  ChangeTypes: %d  ChangesOnly: %t  ReturnECs: %t",
+		"Persistent Search", ControlTypePersistentSearch, c.Criticality, c.ChangeTypes, c.ChangesOnly, c.ReturnECs)
+}
+
+// ControlEntryChange tells which change of a persistent search sent the entry, PreviousDN is set for renames
+type ControlEntryChange struct {
+	ChangeType   int
+	PreviousDN   string
+	ChangeNumber int64
+}
+
+func (c *ControlEntryChange) GetControlType() string {
+	return ControlTypeEntryChange
+}
+
+func (c *ControlEntryChange) Encode() *ber.Packet {
+	seq := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Entry Change Notification")
+	seq.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, uint64(c.ChangeType), "Change Type"))
+	if c.PreviousDN != "" {
+		seq.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, c.PreviousDN, "Previous DN"))
+	}
+	if c.ChangeNumber != 0 {
+		seq.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, c.ChangeNumber, "Change Number"))
+	}
+	return encodeControl(ControlTypeEntryChange, false, seq)
+}
+
+func (c *ControlEntryChange) String() string {
+	return fmt.Sprintf("Control Type: %s (%q)  ChangeType: %d  PreviousDN: %s  ChangeNumber: %d",
+		"Entry Change Notification", ControlTypeEntryChange, c.ChangeType, c.PreviousDN, c.ChangeNumber)
+}
+
+func encodeControl(controlType string, criticality bool, value *ber.Packet) *ber.Packet {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Control")
+	packet.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, controlType, "Control Type"))
+	if criticality {
+		packet.AppendChild(ber.NewBoolean(ber.ClassUniversal, ber.TypePrimitive, ber.TagBoolean, true, "Criticality"))
+	}
+	v := ber.Encode(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, nil, "Control Value")
+	v.AppendChild(value)
+	packet.AppendChild(v)
+	return packet
+}
+
+// decodeControls replaces the controls go-ldap leaves undecoded with the ones of this package
+func decodeControls(controls []ldap.Control) ([]ldap.Control, error) {
+	res := make([]ldap.Control, 0, len(controls))
+	for _, c := range controls {
+		cs, ok := c.(*ldap.ControlString)
+		if !ok || cs.ControlType != ControlTypeSortResult && cs.ControlType != ControlTypeVLVResponse &&
+			cs.ControlType != ControlTypeEntryChange {
+			res = append(res, c)
+			continue
+		}
+		p, err := ber.DecodePacketErr([]byte(cs.ControlValue))
+		if err != nil || len(p.Children) == 0 {
+			return nil, errors.Errorf("ldap malformed control %s", cs.ControlType)
+		}
+		switch cs.ControlType {
+		case ControlTypeSortResult:
+			r := &ControlSortResult{Result: uint16(berInt(p.Children[0]))}
+			if len(p.Children) > 1 {
+				r.Attribute = p.Children[1].Data.String()
+			}
+			res = append(res, r)
+			continue
+		case ControlTypeEntryChange:
+			r := &ControlEntryChange{ChangeType: int(berInt(p.Children[0]))}
+			for _, o := range p.Children[1:] {
+				if o.Tag == ber.TagOctetString {
+					r.PreviousDN = o.Data.String()
+				} else {
+					r.ChangeNumber = berInt(o)
+				}
+			}
+			res = append(res, r)
+			continue
+		}
+		if len(p.Children) < 3 {
+			return nil, errors.Errorf("ldap malformed control %s", cs.ControlType)
+		}
+		r := &ControlVLVResponse{
+			TargetPosition: int(berInt(p.Children[0])),
+			ContentCount:   int(berInt(p.Children[1])),
+			Result:         uint16(berInt(p.Children[2])),
+		}
+		if len(p.Children) > 3 {
+			r.ContextID = p.Children[3].Data.Bytes()
+		}
+		res = append(res, r)
+	}
+	return res, nil
+}
+
+func berInt(p *ber.Packet) int64 {
+	v, _ := p.Value.(int64)
+	return v
+}
@@ -0,0 +1,121 @@
+package ldap
+
+// noinspection GoRedundantImportAlias
+import (
+	"regexp"
+	"strings"
+
+	ldap "github.com/go-ldap/ldap/v3"
+	"github.com/pkg/errors"
+)
+
+// Client errors, compare them with errors.Is
+var (
+	ErrClosed             = errors.New("ldap client is closed")
+	ErrUserNotFound       = errors.New("ldap user does not exist")
+	ErrNotFound           = errors.New("ldap entry does not exist")
+	ErrInvalidCredentials = errors.New("ldap invalid credentials")
+	ErrTimeout            = errors.New("ldap timeout")
+	ErrLogonRestricted    = errors.New("ldap logon is not permitted at this time or workstation")
+	ErrInvalidCursor      = errors.New("ldap cursor is malformed or belongs to another search")
+	// ErrCursorNotSupported is a scan with no paging cookie to resume from, it can only be read from the start
+	ErrCursorNotSupported = errors.New("ldap scan can not be resumed by cursor")
+	ErrInvalidWatermark   = errors.New("ldap watermark is malformed or belongs to another directory")
+	// ErrStaleWatermark is a USN watermark of another domain controller, start over with an empty one
+	ErrStaleWatermark = errors.New("ldap watermark belongs to another domain controller")
+	// ErrWatchNotSupported is a server with neither the persistent search nor the AD notification control
+	ErrWatchNotSupported = errors.New("ldap server does not support change notifications")
+	// ErrGroupNeedsMember is an empty member list for a groupOfNames or groupOfUniqueNames, member is a MUST there
+	ErrGroupNeedsMember = errors.New("ldap group needs at least one member")
+)
+
+// AD explains a failed bind with a sub-code in the diagnostic message: "... AcceptSecurityContext error, data 52e, v4563"
+var (
+	subCodeRe = regexp.MustCompile(`\bdata ([0-9a-fA-F]+)\b`)
+	subCodes  = map[string]error{
+		"52e": ErrInvalidCredentials,
+		"525": ErrUserNotFound,
+		"530": ErrLogonRestricted,
+		"531": ErrLogonRestricted,
+		"532": ErrPasswordExpired,
+		"533": ErrAccountDisabled,
+		"701": ErrAccountExpired,
+		"773": ErrPasswordMustChange,
+		"775": ErrAccountLocked,
+	}
+)
+
+// LDAPError is an error result of the server. errors.Is matches it against ErrInvalidCredentials, ErrTimeout
+// and the sentinel of its AD sub-code, errors.Cause returns that sentinel when there is one.
+type LDAPError struct {
+	Code      uint16
+	SubCode   string
+	Message   string
+	MatchedDN string
+
+	reason error
+	err    *ldap.Error
+}
+
+func (e *LDAPError) Error() string {
+	return e.err.Error()
+}
+
+func (e *LDAPError) Unwrap() error {
+	return e.err
+}
+
+func (e *LDAPError) Cause() error {
+	if e.reason != nil {
+		return e.reason
+	}
+	return e.err
+}
+
+func (e *LDAPError) Is(target error) bool {
+	switch {
+	case target == nil:
+		return false
+	case target == e.reason:
+		return true
+	case target == ErrInvalidCredentials:
+		return e.Code == ldap.LDAPResultInvalidCredentials
+	case target == ErrTimeout:
+		return e.Code == ldap.LDAPResultTimeLimitExceeded
+	}
+	return false
+}
+
+// ldapError turns a go-ldap result error into LDAPError, other errors are returned as they are
+func ldapError(err error) error {
+	le, ok := err.(*ldap.Error)
+	if !ok {
+		return err
+	}
+	e := &LDAPError{Code: le.ResultCode, MatchedDN: le.MatchedDN, err: le}
+	if le.Err != nil {
+		e.Message = le.Err.Error()
+	}
+	if m := subCodeRe.FindStringSubmatch(e.Message); m != nil {
+		e.SubCode = strings.ToLower(m[1])
+		e.reason = subCodes[e.SubCode]
+	}
+	if e.reason == nil && e.Code == ldap.LDAPResultInvalidCredentials {
+		e.reason = ErrInvalidCredentials
+	}
+	return e
+}
+
+// hasCode reports whether err is a server result with one of codes
+func hasCode(err error, codes ...uint16) bool {
+	var le *LDAPError
+	if !errors.As(err, &le) {
+		return false
+	}
+	for _, c := range codes {
+		if le.Code == c {
+			return true
+		}
+	}
+	return false
+}
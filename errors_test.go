@@ -0,0 +1,216 @@
+package ldap
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	ldap "github.com/go-ldap/ldap/v3"
+	"github.com/pkg/errors"
+)
+
+func TestLDAPError(t *testing.T) {
+	const bindMsg = "80090308: LdapErr: DSID-0C09044E, comment: AcceptSecurityContext error, data %s, v4563"
+	tests := []struct {
+		name      string
+		err       error
+		wantSub   string
+		wantCause error
+		wantIs    []error
+	}{
+		{
+			name:      "ad wrong password",
+			err:       ldap.NewError(ldap.LDAPResultInvalidCredentials, errors.Errorf(bindMsg, "52e")),
+			wantSub:   "52e",
+			wantCause: ErrInvalidCredentials,
+			wantIs:    []error{ErrInvalidCredentials},
+		},
+		{
+			name:      "ad unknown user",
+			err:       ldap.NewError(ldap.LDAPResultInvalidCredentials, errors.Errorf(bindMsg, "525")),
+			wantSub:   "525",
+			wantCause: ErrUserNotFound,
+			wantIs:    []error{ErrUserNotFound, ErrInvalidCredentials},
+		},
+		{
+			name:      "ad disabled",
+			err:       ldap.NewError(ldap.LDAPResultInvalidCredentials, errors.Errorf(bindMsg, "533")),
+			wantSub:   "533",
+			wantCause: ErrAccountDisabled,
+			wantIs:    []error{ErrAccountDisabled, ErrInvalidCredentials},
+		},
+		{
+			name:      "ad locked",
+			err:       ldap.NewError(ldap.LDAPResultInvalidCredentials, errors.Errorf(bindMsg, "775")),
+			wantSub:   "775",
+			wantCause: ErrAccountLocked,
+			wantIs:    []error{ErrAccountLocked, ErrInvalidCredentials},
+		},
+		{
+			name:      "ad must change",
+			err:       ldap.NewError(ldap.LDAPResultInvalidCredentials, errors.Errorf(bindMsg, "773")),
+			wantSub:   "773",
+			wantCause: ErrPasswordMustChange,
+			wantIs:    []error{ErrPasswordMustChange, ErrInvalidCredentials},
+		},
+		{
+			name:      "ad logon hours",
+			err:       ldap.NewError(ldap.LDAPResultInvalidCredentials, errors.Errorf(bindMsg, "530")),
+			wantSub:   "530",
+			wantCause: ErrLogonRestricted,
+			wantIs:    []error{ErrLogonRestricted, ErrInvalidCredentials},
+		},
+		{
+			name:      "plain invalid credentials",
+			err:       ldap.NewError(ldap.LDAPResultInvalidCredentials, errors.New("invalid credentials")),
+			wantCause: ErrInvalidCredentials,
+			wantIs:    []error{ErrInvalidCredentials},
+		},
+		{
+			name:   "time limit",
+			err:    ldap.NewError(ldap.LDAPResultTimeLimitExceeded, errors.New("time limit exceeded")),
+			wantIs: []error{ErrTimeout},
+		},
+	}
+	for _, test := range tests {
+		tt := test
+		t.Run(tt.name, func(t *testing.T) {
+			err := errors.Wrap(ldapError(tt.err), "test")
+			var le *LDAPError
+			if !errors.As(err, &le) || le.SubCode != tt.wantSub || le.Code != tt.err.(*ldap.Error).ResultCode {
+				t.Fatalf("ldapError() got = %#v, want sub-code %q", le, tt.wantSub)
+			}
+			want := tt.wantCause
+			if want == nil {
+				want = tt.err
+			}
+			if got := errors.Cause(err); got != want {
+				t.Errorf("errors.Cause() got = %v, want %v", got, want)
+			}
+			for _, target := range tt.wantIs {
+				if !errors.Is(err, target) {
+					t.Errorf("errors.Is(%v) got = false", target)
+				}
+			}
+			if errors.Is(err, ErrClosed) {
+				t.Error("errors.Is(ErrClosed) got = true")
+			}
+			var raw *ldap.Error
+			if !errors.As(err, &raw) || !ldap.IsErrorWithCode(raw, le.Code) {
+				t.Errorf("errors.As(*ldap.Error) got = %v", raw)
+			}
+		})
+	}
+	if err := errors.New("other"); ldapError(err) != err {
+		t.Error("ldapError() changed a non ldap error")
+	}
+}
+
+func TestClient_Errors(t *testing.T) {
+	c, closeAll := writeClient(t, nil)
+	defer closeAll()
+	if _, err := c.Auth("test.1", "wrong"); !errors.Is(err, ErrInvalidCredentials) || !hasCode(err, ldap.LDAPResultInvalidCredentials) {
+		t.Errorf("Auth() wrong password error = %v, want %v", err, ErrInvalidCredentials)
+	}
+	if _, err := c.Auth("nobody", "pass"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Auth() unknown user error = %v, want %v", err, ErrUserNotFound)
+	}
+	if _, err := c.SearchByLogon("nobody"); err != ErrUserNotFound {
+		t.Errorf("SearchByLogon() unknown user error = %v, want %v", err, ErrUserNotFound)
+	}
+	c.Close()
+	if err := c.Ping(); err != ErrClosed {
+		t.Errorf("Ping() closed client error = %v, want %v", err, ErrClosed)
+	}
+	if _, err := c.Auth("test.1", "test1Pass"); !errors.Is(err, ErrClosed) {
+		t.Errorf("Auth() closed client error = %v, want %v", err, ErrClosed)
+	}
+}
+
+// silentServer accepts binds and never answers anything else, requests counts what it did not answer
+func silentServer(t *testing.T) (url string, requests *int32, closeAll func()) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("listen", err)
+	}
+	requests = new(int32)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				for {
+					p, err := ber.ReadPacket(conn)
+					if err != nil || len(p.Children) < 2 {
+						return
+					}
+					if p.Children[1].Tag != ldap.ApplicationBindRequest {
+						atomic.AddInt32(requests, 1)
+						continue
+					}
+					res := ber.NewSequence("LDAP Response")
+					res.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, p.Children[0].Value, "MessageID"))
+					op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationBindResponse, nil, "Bind Response")
+					op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, 0, "Result Code"))
+					op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Matched DN"))
+					op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Diagnostic Message"))
+					res.AppendChild(op)
+					if _, err = conn.Write(res.Bytes()); err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+	return "ldap://" + ln.Addr().String(), requests, func() { _ = ln.Close() }
+}
+
+func TestClient_Timeout(t *testing.T) {
+	url, requests, closeSrv := silentServer(t)
+	defer closeSrv()
+	c, err := New(context.Background(), WithURL(url), WithBaseDN("DC=corp,DC=test,DC=com"),
+		WithAdmin(`corp\test.user`, "testPass"), WithTimeout(200*time.Millisecond))
+	if err != nil {
+		t.Fatal("ldap connect", err)
+	}
+	defer c.Close()
+	tests := []struct {
+		name string
+		op   func() error
+	}{
+		{name: "search", op: func() error {
+			_, err := c.Search("(cn=Test 1)")
+			return err
+		}},
+		{name: "search by logon", op: func() error {
+			_, err := c.SearchByLogon("test.1")
+			return err
+		}},
+		{name: "delete user", op: func() error {
+			return c.DeleteUser("CN=Test 1,OU=TestGroup,OU=Staff,DC=corp,DC=test,DC=com")
+		}},
+		{name: "remove member", op: func() error {
+			return c.RemoveGroupMember("CN=Staff,OU=Staff,DC=corp,DC=test,DC=com",
+				"CN=Test 1,OU=TestGroup,OU=Staff,DC=corp,DC=test,DC=com")
+		}},
+	}
+	for _, test := range tests {
+		tt := test
+		t.Run(tt.name, func(t *testing.T) {
+			before := atomic.LoadInt32(requests)
+			if err := tt.op(); !errors.Is(err, ErrTimeout) {
+				t.Errorf("error = %v, want %v", err, ErrTimeout)
+			}
+			// a timed out request is not sent again, the server may have applied it
+			if sent := atomic.LoadInt32(requests) - before; sent != 1 {
+				t.Errorf("requests sent = %d, want 1", sent)
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package ldap
+
+// noinspection GoRedundantImportAlias
+import (
+	"reflect"
+	"strings"
+
+	ldap "github.com/go-ldap/ldap/v3"
+)
+
+// Filter is an RFC 4515 search filter. Values passed to the constructors
+// are escaped, so caller input can not change the structure of the query.
+type Filter interface {
+	String() string
+}
+
+type filter string
+
+func (f filter) String() string {
+	return string(f)
+}
+
+// RawFilter wraps an already escaped filter string.
+func RawFilter(s string) Filter {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "(") {
+		s = "(" + s + ")"
+	}
+	return filter(s)
+}
+
+// And matches what all of fs match. Nil operands are dropped, without any left it matches every entry.
+func And(fs ...Filter) Filter {
+	s := join(fs)
+	if s == "" {
+		return Present("objectClass")
+	}
+	return filter("(&" + s + ")")
+}
+
+// Or matches what any of fs matches. Nil operands are dropped, without any left it matches nothing.
+func Or(fs ...Filter) Filter {
+	s := join(fs)
+	if s == "" {
+		return Not(nil)
+	}
+	return filter("(|" + s + ")")
+}
+
+// Not matches what f does not, Not(nil) is the negation of And() and matches nothing.
+func Not(f Filter) Filter {
+	if isNil(f) {
+		f = And()
+	}
+	return filter("(!" + f.String() + ")")
+}
+
+func Eq(attr, value string) Filter {
+	return filter("(" + attr + "=" + EscapeFilter(value) + ")")
+}
+
+func Approx(attr, value string) Filter {
+	return filter("(" + attr + "~=" + EscapeFilter(value) + ")")
+}
+
+func GreaterOrEqual(attr, value string) Filter {
+	return filter("(" + attr + ">=" + EscapeFilter(value) + ")")
+}
+
+func LessOrEqual(attr, value string) Filter {
+	return filter("(" + attr + "<=" + EscapeFilter(value) + ")")
+}
+
+func Present(attr string) Filter {
+	return filter("(" + attr + "=*)")
+}
+
+// Substring matches the parts in order with wildcards between them:
+// Substring("cn", "Test", "") is (cn=Test*), Substring("mail", "", "@test.com") is (mail=*@test.com)
+// and a single part is a contains match, Substring("cn", "est") is (cn=*est*).
+// Without any non-empty part it is Present(attr).
+func Substring(attr string, parts ...string) Filter {
+	if strings.Join(parts, "") == "" {
+		return Present(attr)
+	}
+	escaped := make([]string, 0, len(parts))
+	for i, p := range parts {
+		if p == "" && i > 0 && i < len(parts)-1 {
+			continue
+		}
+		escaped = append(escaped, EscapeFilter(p))
+	}
+	if len(escaped) < 2 {
+		escaped = append([]string{""}, append(escaped, "")...)
+	}
+	return filter("(" + attr + "=" + strings.Join(escaped, "*") + ")")
+}
+
+// ExtensibleMatch builds (attr:dn:rule:=value); attr or rule may be empty, but not both.
+func ExtensibleMatch(attr, rule, value string, dnAttrs bool) Filter {
+	b := strings.Builder{}
+	b.WriteString("(" + attr)
+	if dnAttrs {
+		b.WriteString(":dn")
+	}
+	if rule != "" {
+		b.WriteString(":" + rule)
+	}
+	b.WriteString(":=" + EscapeFilter(value) + ")")
+	return filter(b.String())
+}
+
+// EscapeFilter escapes a value for use in a filter assertion per RFC 4515.
+func EscapeFilter(value string) string {
+	return ldap.EscapeFilter(value)
+}
+
+func join(fs []Filter) string {
+	b := strings.Builder{}
+	for _, f := range fs {
+		if !isNil(f) {
+			b.WriteString(f.String())
+		}
+	}
+	return b.String()
+}
+
+// isNil also catches a nil pointer in a Filter interface, its String would panic
+func isNil(f Filter) bool {
+	if f == nil {
+		return true
+	}
+	v := reflect.ValueOf(f)
+	return v.Kind() == reflect.Ptr && v.IsNil()
+}
@@ -0,0 +1,69 @@
+package ldap
+
+import (
+	"testing"
+
+	ldap "github.com/go-ldap/ldap/v3"
+)
+
+// pointerFilter is a Filter of another package, a nil one panics in String
+type pointerFilter struct{ s string }
+
+func (f *pointerFilter) String() string {
+	return f.s
+}
+
+func TestFilter(t *testing.T) {
+	var nilFilter *pointerFilter
+	tests := []struct {
+		name string
+		f    Filter
+		want string
+	}{
+		{name: "eq", f: Eq("cn", "Test User"), want: "(cn=Test User)"},
+		{name: "eq injection", f: Eq("sAMAccountName", "*)(cn=*"), want: `(sAMAccountName=\2a\29\28cn=\2a)`},
+		{name: "eq backslash", f: Eq("memberOf", `CN=Smith\, John,DC=corp`), want: `(memberOf=CN=Smith\5c, John,DC=corp)`},
+		{name: "present", f: Present("mail"), want: "(mail=*)"},
+		{name: "not", f: Not(Present("mail")), want: "(!(mail=*))"},
+		{
+			name: "and or",
+			f:    And(Eq("objectClass", "user"), Or(Eq("cn", "a"), Eq("cn", "b"))),
+			want: "(&(objectClass=user)(|(cn=a)(cn=b)))",
+		},
+		{name: "and skips nil", f: And(Eq("cn", "a"), nil), want: "(&(cn=a))"},
+		{name: "and skips nil pointer", f: And(Eq("cn", "a"), nilFilter), want: "(&(cn=a))"},
+		{name: "and of nil", f: And(nil), want: "(objectClass=*)"},
+		{name: "or of nothing", f: Or(), want: "(!(objectClass=*))"},
+		{name: "or skips nil", f: Or(nil, Eq("cn", "a"), nilFilter), want: "(|(cn=a))"},
+		{name: "not nil", f: Not(nil), want: "(!(objectClass=*))"},
+		{name: "not nil pointer", f: Not(nilFilter), want: "(!(objectClass=*))"},
+		{name: "prefix", f: Substring("cn", "Test", ""), want: "(cn=Test*)"},
+		{name: "suffix", f: Substring("mail", "", "@test.com"), want: "(mail=*@test.com)"},
+		{name: "contains", f: Substring("cn", "es*t"), want: `(cn=*es\2at*)`},
+		{name: "any", f: Substring("cn", "a", "b", "", "c"), want: "(cn=a*b*c)"},
+		{name: "empty part", f: Substring("cn", ""), want: "(cn=*)"},
+		{name: "empty parts", f: Substring("cn", "", "", ""), want: "(cn=*)"},
+		{name: "no parts", f: Substring("cn"), want: "(cn=*)"},
+		{name: "ge", f: GreaterOrEqual("uSNChanged", "100"), want: "(uSNChanged>=100)"},
+		{name: "le", f: LessOrEqual("uSNChanged", "100"), want: "(uSNChanged<=100)"},
+		{name: "approx", f: Approx("cn", "tst"), want: "(cn~=tst)"},
+		{
+			name: "extensible rule",
+			f:    ExtensibleMatch("userAccountControl", "1.2.840.113556.1.4.803", "2", false),
+			want: "(userAccountControl:1.2.840.113556.1.4.803:=2)",
+		},
+		{name: "extensible dn", f: ExtensibleMatch("ou", "", "Staff", true), want: "(ou:dn:=Staff)"},
+		{name: "raw", f: RawFilter("objectClass=*"), want: "(objectClass=*)"},
+	}
+	for _, test := range tests {
+		tt := test
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.f.String(); got != tt.want {
+				t.Errorf("String() got = %v, want %v", got, tt.want)
+			}
+			if _, err := ldap.CompileFilter(tt.f.String()); err != nil {
+				t.Errorf("CompileFilter() error = %v", err)
+			}
+		})
+	}
+}
@@ -3,6 +3,7 @@ module github.com/shubinmi/ldap
 go 1.14
 
 require (
+	github.com/go-asn1-ber/asn1-ber v1.3.1
 	github.com/go-ldap/ldap/v3 v3.1.7
 	github.com/gorilla/websocket v1.4.1
 	github.com/niemeyer/pretty v0.0.0-20200227124842-a10e7caefd8e // indirect
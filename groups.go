@@ -0,0 +1,296 @@
+package ldap
+
+// noinspection GoRedundantImportAlias
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	ldap "github.com/go-ldap/ldap/v3"
+	"github.com/pkg/errors"
+)
+
+const (
+	memberAttr       = "member"
+	uniqueMemberAttr = "uniqueMember"
+	// AD refuses more values than this in one modify request
+	maxModifyValues = 1000
+	// adMemberNotInGroup is the Win32 error of removing a member the AD group does not have
+	adMemberNotInGroup = 0x561
+)
+
+func (c *Client) CreateGroup(g Group, attrs map[string][]string) error {
+	return c.CreateGroupContext(context.Background(), g, attrs)
+}
+
+// CreateGroupContext adds a group built from g, attrs override the derived attributes
+func (c *Client) CreateGroupContext(ctx context.Context, g Group, attrs map[string][]string) error {
+	if c.isClosed() {
+		return ErrClosed
+	}
+	if g.DN == "" {
+		return errors.New("group DN is required")
+	}
+	s, err := c.schema(ctx)
+	if err != nil {
+		return err
+	}
+	cn := g.CN
+	if cn == "" {
+		cn = rdnValue(g.DN)
+	}
+	values := map[string][]string{
+		"objectClass": s.GroupClasses,
+		"cn":          {cn},
+	}
+	if s.GroupLoginAttr != "" {
+		values[s.GroupLoginAttr] = []string{cn}
+	}
+	if g.Name != "" && g.Name != cn {
+		values["displayName"] = []string{g.Name}
+	}
+	if g.Desc != "" {
+		values["description"] = []string{g.Desc}
+	}
+	if g.Member != "" && len(s.MemberAttrs) > 0 {
+		values[s.MemberAttrs[0]] = []string{g.Member}
+	}
+	for attr, vs := range attrs {
+		values[attr] = vs
+	}
+	req := ldap.NewAddRequest(g.DN, nil)
+	for attr, vs := range values {
+		if len(vs) > 0 {
+			req.Attribute(attr, vs)
+		}
+	}
+	err = c.write(ctx, func(con *ldap.Conn) error {
+		return con.Add(req)
+	})
+	return errors.Wrap(err, "ldap create group "+g.DN)
+}
+
+func (c *Client) DeleteGroup(dn string) error {
+	return c.DeleteGroupContext(context.Background(), dn)
+}
+
+func (c *Client) DeleteGroupContext(ctx context.Context, dn string) error {
+	if c.isClosed() {
+		return ErrClosed
+	}
+	err := c.write(ctx, func(con *ldap.Conn) error {
+		return con.Del(ldap.NewDelRequest(dn, nil))
+	})
+	return errors.Wrap(err, "ldap delete group "+dn)
+}
+
+func (c *Client) AddGroupMember(groupDN, memberDN string) error {
+	return c.AddGroupMemberContext(context.Background(), groupDN, memberDN)
+}
+
+// AddGroupMemberContext is idempotent: adding a member that is already there is not an error
+func (c *Client) AddGroupMemberContext(ctx context.Context, groupDN, memberDN string) error {
+	return c.changeMember(ctx, groupDN, memberDN, true)
+}
+
+func (c *Client) RemoveGroupMember(groupDN, memberDN string) error {
+	return c.RemoveGroupMemberContext(context.Background(), groupDN, memberDN)
+}
+
+// RemoveGroupMemberContext is idempotent: removing a member that is not there is not an error
+func (c *Client) RemoveGroupMemberContext(ctx context.Context, groupDN, memberDN string) error {
+	return c.changeMember(ctx, groupDN, memberDN, false)
+}
+
+func (c *Client) SetGroupMembers(groupDN string, memberDNs []string) error {
+	return c.SetGroupMembersContext(context.Background(), groupDN, memberDNs)
+}
+
+// SetGroupMembersContext makes memberDNs the exact member list, only the difference is sent to the server.
+// A difference of more than 1000 values goes out in several requests and is not atomic: when one fails the
+// group is left partly changed and the error says how many values were applied. groupOfNames and
+// groupOfUniqueNames must keep a member, an empty memberDNs is refused for them with ErrGroupNeedsMember.
+func (c *Client) SetGroupMembersContext(ctx context.Context, groupDN string, memberDNs []string) error {
+	if c.isClosed() {
+		return ErrClosed
+	}
+	g, current, err := c.groupMembers(ctx, groupDN)
+	if err != nil {
+		return err
+	}
+	if len(memberDNs) == 0 && needsMember(g) {
+		return errors.Wrap(ErrGroupNeedsMember, groupDN)
+	}
+	want := make(map[string]bool, len(memberDNs))
+	var adds, removes []string
+	for _, m := range memberDNs {
+		k := normalizeDN(m)
+		if want[k] {
+			continue
+		}
+		want[k] = true
+		if _, ok := current[k]; !ok {
+			adds = append(adds, m)
+		}
+	}
+	for k, dn := range current {
+		if !want[k] {
+			removes = append(removes, dn)
+		}
+	}
+	return c.modifyMembers(ctx, groupDN, membersAttr(g), adds, removes)
+}
+
+// changeMember sends the add or the delete of memberDN without reading the member list,
+// the refusal of a member that is already there or already gone is the requested outcome
+func (c *Client) changeMember(ctx context.Context, groupDN, memberDN string, add bool) error {
+	if c.isClosed() {
+		return ErrClosed
+	}
+	g, err := c.entry(ctx, groupDN, "objectClass")
+	if err != nil {
+		return errors.Wrap(err, "ldap read group "+groupDN)
+	}
+	if g == nil {
+		return errors.Errorf("ldap group %s does not exist", groupDN)
+	}
+	req := ldap.NewModifyRequest(groupDN, nil)
+	if add {
+		req.Add(membersAttr(g), []string{memberDN})
+	} else {
+		req.Delete(membersAttr(g), []string{memberDN})
+	}
+	err = c.write(ctx, func(con *ldap.Conn) error {
+		return con.Modify(req)
+	})
+	if add && memberExists(err) || !add && memberMissing(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "ldap modify members of "+groupDN)
+	}
+	return nil
+}
+
+// memberExists is the refusal to add a member twice, AD answers ENTRY_EXISTS instead of attributeOrValueExists
+func memberExists(err error) bool {
+	return hasCode(err, ldap.LDAPResultAttributeOrValueExists, ldap.LDAPResultEntryAlreadyExists)
+}
+
+// memberMissing is the refusal to delete a member that is not there, AD answers WILL_NOT_PERFORM with
+// ERROR_MEMBER_NOT_IN_GROUP instead of noSuchAttribute
+func memberMissing(err error) bool {
+	if hasCode(err, ldap.LDAPResultNoSuchAttribute) {
+		return true
+	}
+	var le *LDAPError
+	return errors.As(err, &le) && le.Code == ldap.LDAPResultUnwillingToPerform && adWin32Error(le.Message) == adMemberNotInGroup
+}
+
+// modifyMembers sends the changes in requests of up to maxModifyValues, the ones sent before a failure stay applied
+func (c *Client) modifyMembers(ctx context.Context, groupDN, attr string, adds, removes []string) error {
+	total, applied := len(adds)+len(removes), 0
+	for len(adds) > 0 || len(removes) > 0 {
+		req := ldap.NewModifyRequest(groupDN, nil)
+		n := minInt(len(adds), maxModifyValues)
+		if n > 0 {
+			req.Add(attr, adds[:n])
+			adds = adds[n:]
+		}
+		if m := minInt(len(removes), maxModifyValues-n); m > 0 {
+			req.Delete(attr, removes[:m])
+			removes = removes[m:]
+		}
+		err := c.write(ctx, func(con *ldap.Conn) error {
+			return con.Modify(req)
+		})
+		if err != nil {
+			return errors.Wrapf(err, "ldap modify members of %s, %d of %d changes applied", groupDN, applied, total)
+		}
+		for _, ch := range req.Changes {
+			applied += len(ch.Modification.Vals)
+		}
+	}
+	return nil
+}
+
+// groupMembers reads the member attribute of a group, following AD ranged retrieval for large groups.
+// It returns the group entry with its objectClass and normalized DN => DN of its members.
+func (c *Client) groupMembers(ctx context.Context, groupDN string) (*ldap.Entry, map[string]string, error) {
+	group, err := c.entry(ctx, groupDN, "objectClass", memberAttr, uniqueMemberAttr)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "ldap read group "+groupDN)
+	}
+	if group == nil {
+		return nil, nil, errors.Errorf("ldap group %s does not exist", groupDN)
+	}
+	g := group
+	attr := membersAttr(g)
+	members := make(map[string]string)
+	for {
+		next := ""
+		for _, a := range g.Attributes {
+			name := strings.ToLower(a.Name)
+			if name != strings.ToLower(attr) && !strings.HasPrefix(name, strings.ToLower(attr)+";range=") {
+				continue
+			}
+			for _, v := range a.Values {
+				members[normalizeDN(v)] = v
+			}
+			next = nextRange(attr, name)
+		}
+		if next == "" {
+			return group, members, nil
+		}
+		if g, err = c.entry(ctx, groupDN, next); err != nil {
+			return nil, nil, errors.Wrap(err, "ldap read group "+groupDN)
+		}
+		if g == nil {
+			return group, members, nil
+		}
+	}
+}
+
+// membersAttr is the attribute the group g keeps its members in
+func membersAttr(g *ldap.Entry) string {
+	if a := attribute(g, "objectClass"); a != nil {
+		for _, v := range a.Values {
+			if strings.EqualFold(v, "groupOfUniqueNames") {
+				return uniqueMemberAttr
+			}
+		}
+	}
+	return memberAttr
+}
+
+// needsMember is a group whose object class makes member a MUST attribute
+func needsMember(g *ldap.Entry) bool {
+	if a := attribute(g, "objectClass"); a != nil {
+		for _, v := range a.Values {
+			if strings.EqualFold(v, "groupOfNames") || strings.EqualFold(v, "groupOfUniqueNames") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// nextRange returns the next ranged attribute to request after member;range=0-1499, or "" after the last one
+func nextRange(attr, name string) string {
+	i := strings.LastIndex(name, "-")
+	if !strings.Contains(name, ";range=") || i < 0 || name[i+1:] == "*" {
+		return ""
+	}
+	hi, err := strconv.Atoi(name[i+1:])
+	if err != nil {
+		return ""
+	}
+	return attr + ";range=" + strconv.Itoa(hi+1) + "-*"
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
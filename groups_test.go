@@ -0,0 +1,158 @@
+package ldap
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestClient_GroupMembers(t *testing.T) {
+	flavours := []struct {
+		name string
+		dse  map[string][]string
+	}{
+		{name: "ldap"},
+		// AD refuses a member twice with ENTRY_EXISTS and a missing one with WILL_NOT_PERFORM
+		{name: "active directory", dse: map[string][]string{"supportedCapabilities": {capActiveDirectory}}},
+	}
+	for _, flavour := range flavours {
+		fl := flavour
+		t.Run(fl.name, func(t *testing.T) {
+			testGroupMembers(t, fl.dse)
+		})
+	}
+}
+
+func testGroupMembers(t *testing.T, dse map[string][]string) {
+	c, closeAll := writeClient(t, dse)
+	defer closeAll()
+	const (
+		groupDN = "CN=Access,OU=Staff,DC=corp,DC=test,DC=com"
+		user    = "CN=Test User,OU=Users,OU=St-Petersburg,OU=Staff,DC=corp,DC=test,DC=com"
+		test1   = "CN=Test 1,OU=TestGroup,OU=Staff,DC=corp,DC=test,DC=com"
+		test2   = "CN=Test 2,OU=TestGroup,OU=Staff,DC=corp,DC=test,DC=com"
+	)
+	members := func() []string {
+		_, current, err := c.groupMembers(context.Background(), groupDN)
+		if err != nil {
+			t.Fatalf("groupMembers() unexpected error = %v", err)
+		}
+		res := make([]string, 0, len(current))
+		for _, dn := range current {
+			res = append(res, dn)
+		}
+		sort.Strings(res)
+		return res
+	}
+	if err := c.CreateGroup(Group{DN: groupDN, Desc: "access request", Member: user}, nil); err != nil {
+		t.Fatalf("CreateGroup() unexpected error = %v", err)
+	}
+	if err := c.CreateGroup(Group{DN: groupDN}, nil); err == nil {
+		t.Error("CreateGroup() expected error for existing group")
+	}
+	tests := []struct {
+		name    string
+		do      func() error
+		want    []string
+		wantErr bool
+	}{
+		{name: "add", do: func() error { return c.AddGroupMember(groupDN, test1) }, want: []string{test1, user}},
+		{name: "add again", do: func() error { return c.AddGroupMember(groupDN, test1) }, want: []string{test1, user}},
+		{name: "remove", do: func() error {
+			return c.RemoveGroupMember(groupDN, "cn=test user,ou=users,ou=st-petersburg,ou=staff,dc=corp,dc=test,dc=com")
+		}, want: []string{test1}},
+		{name: "remove again", do: func() error { return c.RemoveGroupMember(groupDN, user) }, want: []string{test1}},
+		{name: "set", do: func() error { return c.SetGroupMembers(groupDN, []string{test2, user, test2}) }, want: []string{test2, user}},
+		{name: "set same", do: func() error { return c.SetGroupMembers(groupDN, []string{user, test2}) }, want: []string{test2, user}},
+		{name: "set empty", do: func() error { return c.SetGroupMembers(groupDN, nil) }, want: []string{}},
+		{name: "missing group", do: func() error { return c.AddGroupMember("CN=Nope,DC=corp,DC=test,DC=com", user) }, want: []string{}, wantErr: true},
+	}
+	for _, test := range tests {
+		tt := test
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.do(); (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := members(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("members got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	gs, err := c.UserGroups(test2)
+	if err != nil {
+		t.Fatalf("UserGroups() unexpected error = %v", err)
+	}
+	for _, g := range gs {
+		if g.DN == groupDN {
+			t.Errorf("UserGroups() got %s after SetGroupMembers emptied it", groupDN)
+		}
+	}
+	if err = c.DeleteGroup(groupDN); err != nil {
+		t.Fatalf("DeleteGroup() unexpected error = %v", err)
+	}
+	if err = c.DeleteGroup(groupDN); err == nil {
+		t.Error("DeleteGroup() expected error for missing group")
+	}
+}
+
+func TestClient_SetGroupMembersLimits(t *testing.T) {
+	c, closeAll := writeClient(t, nil)
+	defer closeAll()
+	const (
+		groupDN = "CN=Names,OU=Staff,DC=corp,DC=test,DC=com"
+		user    = "CN=Test User,OU=Users,OU=St-Petersburg,OU=Staff,DC=corp,DC=test,DC=com"
+	)
+	count := func() int {
+		_, current, err := c.groupMembers(context.Background(), groupDN)
+		if err != nil {
+			t.Fatalf("groupMembers() unexpected error = %v", err)
+		}
+		return len(current)
+	}
+	err := c.CreateGroup(Group{DN: groupDN, Member: user}, map[string][]string{"objectClass": {"top", "groupOfNames"}})
+	if err != nil {
+		t.Fatalf("CreateGroup() unexpected error = %v", err)
+	}
+	// member is a MUST of groupOfNames
+	if err = c.SetGroupMembers(groupDN, nil); !errors.Is(err, ErrGroupNeedsMember) || count() != 1 {
+		t.Errorf("SetGroupMembers() empty error = %v, want %v", err, ErrGroupNeedsMember)
+	}
+
+	// the second request fails on a member that is already there, the first one stays applied
+	adds := make([]string, 0, maxModifyValues+1)
+	for i := 0; i < maxModifyValues; i++ {
+		adds = append(adds, fmt.Sprintf("CN=Member %d,OU=Staff,DC=corp,DC=test,DC=com", i))
+	}
+	adds = append(adds, user)
+	err = c.modifyMembers(context.Background(), groupDN, memberAttr, adds, nil)
+	if err == nil || !strings.Contains(err.Error(), fmt.Sprintf("%d of %d changes applied", maxModifyValues, len(adds))) {
+		t.Errorf("modifyMembers() error = %v, want the progress", err)
+	}
+	if got := count(); got != maxModifyValues+1 {
+		t.Errorf("modifyMembers() left %d members, want %d", got, maxModifyValues+1)
+	}
+}
+
+func TestNextRange(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "member", want: ""},
+		{name: "member;range=0-1499", want: "member;range=1500-*"},
+		{name: "member;range=1500-*", want: ""},
+	}
+	for _, test := range tests {
+		tt := test
+		t.Run(tt.name, func(t *testing.T) {
+			if got := nextRange(memberAttr, tt.name); got != tt.want {
+				t.Errorf("nextRange() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package ldaptest
+
+// noinspection GoRedundantImportAlias
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	ldap "github.com/go-ldap/ldap/v3"
+)
+
+const (
+	capActiveDirectory = "1.2.840.113556.1.4.800"
+	deletedObjects     = "CN=Deleted Objects"
+	generalizedTime    = "20060102150405Z"
+)
+
+// operationalAttrs are kept by the server on writes and returned only when asked for by name or with "+"
+var operationalAttrs = map[string]bool{
+	"createtimestamp": true, "modifytimestamp": true, "entrycsn": true, "usncreated": true, "usnchanged": true,
+}
+
+// tombstoneAttrs survive a deletion on AD
+var tombstoneAttrs = []string{"objectClass", "objectGUID", "objectSid", "name", "cn", "ou", "sAMAccountName"}
+
+// stamp sets the operational attributes of a write: timestamps and entryCSN like OpenLDAP, USNs like AD
+func (t *tree) stamp(e *entry, created bool) {
+	t.usn++
+	now := time.Now().UTC()
+	usn := strconv.FormatInt(t.usn, 10)
+	if created {
+		e.set("createTimestamp", []string{now.Format(generalizedTime)})
+		e.set("uSNCreated", []string{usn})
+	}
+	e.set("modifyTimestamp", []string{now.Format(generalizedTime)})
+	e.set("entryCSN", []string{fmt.Sprintf("%s#%06x#000#000000", now.Format("20060102150405.000000Z"), t.usn)})
+	e.set("uSNChanged", []string{usn})
+}
+
+// tombstone replaces e with what AD keeps of a deleted object under CN=Deleted Objects of baseDN
+func (t *tree) tombstone(e *entry, baseDN string) *entry {
+	t.remove(e.key())
+	parsed, err := ldap.ParseDN(e.dn)
+	if err != nil || len(parsed.RDNs) == 0 || len(parsed.RDNs[0].Attributes) == 0 {
+		return nil
+	}
+	id := hex.EncodeToString([]byte(strings.Join(e.get("objectGUID"), "")))
+	if id == "" {
+		b := make([]byte, 16)
+		_, _ = rand.Read(b)
+		id = hex.EncodeToString(b)
+	}
+	rdn := parsed.RDNs[0].Attributes[0]
+	parent := make([]string, 0, len(parsed.RDNs)-1)
+	for _, r := range parsed.RDNs[1:] {
+		for _, a := range r.Attributes {
+			parent = append(parent, a.Type+"="+dnEscaper.Replace(a.Value))
+		}
+	}
+	d := newEntry(fmt.Sprintf(`%s=%s\0ADEL:%s,%s,%s`, rdn.Type, dnEscaper.Replace(rdn.Value), id,
+		deletedObjects, baseDN), nil)
+	for _, name := range tombstoneAttrs {
+		d.set(name, e.get(name))
+	}
+	d.set("isDeleted", []string{"TRUE"})
+	d.set("lastKnownParent", []string{strings.Join(parent, ",")})
+	d.set("uSNCreated", e.get("uSNCreated"))
+	d.set("createTimestamp", e.get("createTimestamp"))
+	d.deleted = true
+	t.stamp(d, false)
+	t.add(d)
+	return d
+}
+
+// tombstones are the deleted entries in scope, searches see them with the show deleted control
+func (t *tree) tombstones(base []string, scope int) []*entry {
+	res := make([]*entry, 0)
+	for _, k := range t.order {
+		if e := t.entries[k]; e.deleted && inScope(e.rdns, base, scope) {
+			res = append(res, e)
+		}
+	}
+	return res
+}
+
+func (o *opt) activeDirectory() bool {
+	for _, v := range o.rootDSE["supportedCapabilities"] {
+		if v == capActiveDirectory {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,254 @@
+package ldaptest
+
+// noinspection GoRedundantImportAlias
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+
+	ldap "github.com/go-ldap/ldap/v3"
+)
+
+const memberOfAttr = "memberOf"
+
+var dnEscaper = strings.NewReplacer(`\`, `\\`, `,`, `\,`, `+`, `\+`)
+
+type Entry struct {
+	DN         string
+	Attributes map[string][]string
+}
+
+type attribute struct {
+	name string
+	vals []string
+}
+
+type entry struct {
+	dn    string
+	rdns  []string
+	names []string
+	attrs map[string]*attribute
+	// deleted is an AD tombstone, only searches with the show deleted control find it
+	deleted bool
+}
+
+type page struct {
+	keys  []string
+	attrs []string
+	types bool
+	// owner is the session the cookie was issued to, like OpenLDAP other connections can not continue it
+	owner *session
+}
+
+type tree struct {
+	order   []string
+	entries map[string]*entry
+	pages   map[string]*page
+	watches map[*watch]struct{}
+	// usn counts the writes, the highestCommittedUSN of AD
+	usn int64
+}
+
+type directory struct {
+	ops chan func(*tree)
+}
+
+func newDirectory() *directory {
+	d := &directory{ops: make(chan func(*tree), 1)}
+	go d.serve()
+	return d
+}
+
+func (d *directory) serve() {
+	t := &tree{
+		entries: make(map[string]*entry),
+		pages:   make(map[string]*page),
+		watches: make(map[*watch]struct{}),
+	}
+	for op := range d.ops {
+		op(t)
+	}
+}
+
+func (d *directory) do(f func(t *tree)) {
+	done := make(chan struct{})
+	d.ops <- func(t *tree) {
+		defer close(done)
+		f(t)
+	}
+	<-done
+}
+
+func (d *directory) close() {
+	close(d.ops)
+}
+
+func newEntry(dn string, attrs map[string][]string) *entry {
+	e := &entry{dn: dn, rdns: dnKeys(dn), attrs: make(map[string]*attribute)}
+	for name, vals := range attrs {
+		e.set(name, vals)
+	}
+	return e
+}
+
+func (e *entry) key() string {
+	return strings.Join(e.rdns, ",")
+}
+
+func (e *entry) set(name string, vals []string) {
+	k := strings.ToLower(name)
+	if len(vals) == 0 {
+		if _, ok := e.attrs[k]; !ok {
+			return
+		}
+		delete(e.attrs, k)
+		for i, n := range e.names {
+			if n == k {
+				e.names = append(e.names[:i], e.names[i+1:]...)
+				break
+			}
+		}
+		return
+	}
+	a, ok := e.attrs[k]
+	if !ok {
+		a = &attribute{name: name}
+		e.attrs[k] = a
+		e.names = append(e.names, k)
+	}
+	a.vals = append([]string(nil), vals...)
+}
+
+func (e *entry) get(name string) []string {
+	a, ok := e.attrs[strings.ToLower(name)]
+	if !ok {
+		return nil
+	}
+	return a.vals
+}
+
+func (t *tree) add(e *entry) {
+	k := e.key()
+	if _, ok := t.entries[k]; !ok {
+		t.order = append(t.order, k)
+	}
+	t.entries[k] = e
+}
+
+func (t *tree) lookup(dn string) (*entry, bool) {
+	e, ok := t.entries[strings.Join(dnKeys(dn), ",")]
+	return e, ok
+}
+
+func (t *tree) values(e *entry, name string) []string {
+	if strings.EqualFold(name, "entryDN") || strings.EqualFold(name, "distinguishedName") {
+		// the DN is matched like OpenLDAP entryDN and AD distinguishedName do
+		if vals := e.get(name); len(vals) > 0 {
+			return vals
+		}
+		return []string{e.dn}
+	}
+	if !strings.EqualFold(name, memberOfAttr) {
+		return e.get(name)
+	}
+	vals := append([]string(nil), e.get(memberOfAttr)...)
+	seen := make(map[string]bool, len(vals))
+	for _, v := range vals {
+		seen[normDN(v)] = true
+	}
+	key := e.key()
+	for _, k := range t.order {
+		g := t.entries[k]
+		if seen[k] || g.deleted || !isMember(g, key) {
+			continue
+		}
+		seen[k] = true
+		vals = append(vals, g.dn)
+	}
+	return vals
+}
+
+func (t *tree) find(attr, value string) (*entry, bool) {
+	for _, k := range t.order {
+		e := t.entries[k]
+		if e.deleted {
+			continue
+		}
+		for _, v := range e.get(attr) {
+			if strings.EqualFold(v, value) {
+				return e, true
+			}
+		}
+	}
+	return nil, false
+}
+
+func (t *tree) scope(base []string, scope int) []*entry {
+	res := make([]*entry, 0)
+	for _, k := range t.order {
+		e := t.entries[k]
+		if !e.deleted && inScope(e.rdns, base, scope) {
+			res = append(res, e)
+		}
+	}
+	return res
+}
+
+func (t *tree) newPage(p *page) string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	cookie := hex.EncodeToString(b)
+	t.pages[cookie] = p
+	return cookie
+}
+
+func isMember(g *entry, key string) bool {
+	for _, attr := range [2]string{"member", "uniqueMember"} {
+		for _, v := range g.get(attr) {
+			if normDN(v) == key {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func inScope(rdns, base []string, scope int) bool {
+	if len(rdns) < len(base) {
+		return false
+	}
+	tail := rdns[len(rdns)-len(base):]
+	for i := range base {
+		if tail[i] != base[i] {
+			return false
+		}
+	}
+	switch scope {
+	case ldap.ScopeBaseObject:
+		return len(rdns) == len(base)
+	case ldap.ScopeSingleLevel:
+		return len(rdns) == len(base)+1
+	default:
+		return true
+	}
+}
+
+func dnKeys(dn string) []string {
+	parsed, err := ldap.ParseDN(dn)
+	if err != nil {
+		return []string{strings.ToLower(strings.TrimSpace(dn))}
+	}
+	keys := make([]string, 0, len(parsed.RDNs))
+	for _, rdn := range parsed.RDNs {
+		parts := make([]string, 0, len(rdn.Attributes))
+		for _, a := range rdn.Attributes {
+			parts = append(parts, strings.ToLower(a.Type)+"="+dnEscaper.Replace(strings.ToLower(a.Value)))
+		}
+		keys = append(keys, strings.Join(parts, "+"))
+	}
+	return keys
+}
+
+func normDN(dn string) string {
+	return strings.Join(dnKeys(dn), ",")
+}
@@ -0,0 +1,193 @@
+package ldaptest
+
+// noinspection GoRedundantImportAlias
+import (
+	"strconv"
+	"strings"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	ldap "github.com/go-ldap/ldap/v3"
+)
+
+const (
+	ruleBitAnd = "1.2.840.113556.1.4.803"
+	ruleBitOr  = "1.2.840.113556.1.4.804"
+	ruleChain  = "1.2.840.113556.1.4.1941"
+)
+
+func (t *tree) match(f *ber.Packet, e *entry) bool {
+	switch f.Tag {
+	case ldap.FilterAnd:
+		for _, c := range f.Children {
+			if !t.match(c, e) {
+				return false
+			}
+		}
+		return true
+	case ldap.FilterOr:
+		for _, c := range f.Children {
+			if t.match(c, e) {
+				return true
+			}
+		}
+		return false
+	case ldap.FilterNot:
+		return len(f.Children) == 1 && !t.match(f.Children[0], e)
+	case ldap.FilterPresent:
+		return len(t.values(e, f.Data.String())) > 0
+	case ldap.FilterEqualityMatch, ldap.FilterApproxMatch:
+		attr, val := assertion(f)
+		return t.any(e, attr, func(v string) bool { return equal(v, val) })
+	case ldap.FilterGreaterOrEqual:
+		attr, val := assertion(f)
+		return t.any(e, attr, func(v string) bool { return compare(v, val) >= 0 })
+	case ldap.FilterLessOrEqual:
+		attr, val := assertion(f)
+		return t.any(e, attr, func(v string) bool { return compare(v, val) <= 0 })
+	case ldap.FilterSubstrings:
+		return t.substrings(f, e)
+	case ldap.FilterExtensibleMatch:
+		return t.extensible(f, e)
+	}
+	return false
+}
+
+func (t *tree) any(e *entry, attr string, f func(v string) bool) bool {
+	for _, v := range t.values(e, attr) {
+		if f(v) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *tree) substrings(f *ber.Packet, e *entry) bool {
+	if len(f.Children) != 2 {
+		return false
+	}
+	attr := packetString(f.Children[0])
+	return t.any(e, attr, func(v string) bool {
+		v = strings.ToLower(v)
+		for _, part := range f.Children[1].Children {
+			sub := strings.ToLower(part.Data.String())
+			switch part.Tag {
+			case ldap.FilterSubstringsInitial:
+				if !strings.HasPrefix(v, sub) {
+					return false
+				}
+				v = v[len(sub):]
+			case ldap.FilterSubstringsAny:
+				i := strings.Index(v, sub)
+				if i < 0 {
+					return false
+				}
+				v = v[i+len(sub):]
+			case ldap.FilterSubstringsFinal:
+				if !strings.HasSuffix(v, sub) {
+					return false
+				}
+				v = ""
+			}
+		}
+		return true
+	})
+}
+
+func (t *tree) extensible(f *ber.Packet, e *entry) bool {
+	var rule, attr, val string
+	for _, c := range f.Children {
+		switch c.Tag {
+		case ldap.MatchingRuleAssertionMatchingRule:
+			rule = c.Data.String()
+		case ldap.MatchingRuleAssertionType:
+			attr = c.Data.String()
+		case ldap.MatchingRuleAssertionMatchValue:
+			val = c.Data.String()
+		}
+	}
+	switch rule {
+	case ruleBitAnd, ruleBitOr:
+		mask, err := strconv.ParseInt(val, 10, 64)
+		if err != nil {
+			return false
+		}
+		return t.any(e, attr, func(v string) bool {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return false
+			}
+			if rule == ruleBitAnd {
+				return n&mask == mask
+			}
+			return n&mask != 0
+		})
+	case ruleChain:
+		return t.chain(e, attr, val)
+	default:
+		return t.any(e, attr, func(v string) bool { return equal(v, val) })
+	}
+}
+
+// chain follows DN values of attr from e, so memberOf and member match through nested groups
+func (t *tree) chain(e *entry, attr, dn string) bool {
+	want := normDN(dn)
+	seen := map[string]bool{e.key(): true}
+	queue := []*entry{e}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for _, v := range t.values(cur, attr) {
+			k := normDN(v)
+			if k == want {
+				return true
+			}
+			if seen[k] {
+				continue
+			}
+			seen[k] = true
+			if next, ok := t.lookup(v); ok {
+				queue = append(queue, next)
+			}
+		}
+	}
+	return false
+}
+
+func assertion(f *ber.Packet) (attr, val string) {
+	if len(f.Children) != 2 {
+		return "", ""
+	}
+	return packetString(f.Children[0]), packetString(f.Children[1])
+}
+
+func packetString(p *ber.Packet) string {
+	if s, ok := p.Value.(string); ok {
+		return s
+	}
+	return p.Data.String()
+}
+
+func equal(a, b string) bool {
+	if strings.EqualFold(a, b) {
+		return true
+	}
+	if strings.Contains(a, "=") && strings.Contains(b, "=") {
+		return normDN(a) == normDN(b)
+	}
+	return false
+}
+
+func compare(a, b string) int {
+	x, errX := strconv.ParseInt(a, 10, 64)
+	y, errY := strconv.ParseInt(b, 10, 64)
+	if errX == nil && errY == nil {
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(strings.ToLower(a), strings.ToLower(b))
+}
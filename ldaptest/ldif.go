@@ -0,0 +1,89 @@
+package ldaptest
+
+import (
+	"bufio"
+	"encoding/base64"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+func ParseLDIF(r io.Reader) ([]Entry, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]Entry, 0)
+	var cur *Entry
+	flush := func() {
+		if cur != nil {
+			res = append(res, *cur)
+			cur = nil
+		}
+	}
+	for i, line := range lines {
+		if line == "" {
+			flush()
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, val, err := attrValue(line)
+		if err != nil {
+			return nil, errors.Wrapf(err, "ldif line %d", i+1)
+		}
+		switch {
+		case strings.EqualFold(name, "version") && cur == nil:
+		case strings.EqualFold(name, "dn"):
+			flush()
+			cur = &Entry{DN: val, Attributes: make(map[string][]string)}
+		case cur == nil:
+			return nil, errors.Errorf("ldif line %d: attribute %s before dn", i+1, name)
+		case strings.EqualFold(name, "changetype"):
+			if !strings.EqualFold(val, "add") {
+				return nil, errors.Errorf("ldif line %d: unsupported changetype %s", i+1, val)
+			}
+		default:
+			cur.Attributes[name] = append(cur.Attributes[name], val)
+		}
+	}
+	flush()
+	return res, nil
+}
+
+func unfold(r io.Reader) ([]string, error) {
+	sc := bufio.NewScanner(r)
+	lines := make([]string, 0)
+	for sc.Scan() {
+		line := strings.TrimRight(sc.Text(), "\r")
+		if strings.HasPrefix(line, " ") && len(lines) > 0 && lines[len(lines)-1] != "" {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, sc.Err()
+}
+
+func attrValue(line string) (name, val string, err error) {
+	i := strings.Index(line, ":")
+	if i <= 0 {
+		return "", "", errors.New("missing attribute separator")
+	}
+	name, val = line[:i], line[i+1:]
+	switch {
+	case strings.HasPrefix(val, ":"):
+		bt, e := base64.StdEncoding.DecodeString(strings.TrimSpace(val[1:]))
+		if e != nil {
+			return "", "", errors.Wrapf(e, "base64 value of %s", name)
+		}
+		val = string(bt)
+	case strings.HasPrefix(val, "<"):
+		return "", "", errors.Errorf("url value of %s is not supported", name)
+	default:
+		val = strings.TrimLeft(val, " ")
+	}
+	return name, val, nil
+}
@@ -0,0 +1,610 @@
+// Package ldaptest runs an in-memory LDAP server on localhost so the ldap
+// client and the agent can be tested without a real directory.
+package ldaptest
+
+// noinspection GoRedundantImportAlias
+import (
+	"crypto/tls"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	ldap "github.com/go-ldap/ldap/v3"
+	"github.com/pkg/errors"
+)
+
+const (
+	vendorName   = "ldaptest"
+	controlsTag  = 0
+	simpleAuth   = 0
+	passwordAttr = "userPassword"
+	startTLSOID  = "1.3.6.1.4.1.1466.20037"
+	passwdModOID = "1.3.6.1.4.1.4203.1.11.1"
+	responseName = 10
+)
+
+type Server struct {
+	opt      *opt
+	ln       net.Listener
+	dir      *directory
+	mtx      *sync.Mutex
+	wg       *sync.WaitGroup
+	sessions map[*session]struct{}
+	closed   bool
+}
+
+type session struct {
+	srv   *Server
+	raw   net.Conn
+	conn  net.Conn
+	tls   bool
+	mtx   *sync.Mutex
+	bound string
+}
+
+type request struct {
+	id       int64
+	op       *ber.Packet
+	controls []ldap.Control
+}
+
+func NewServer(fs ...Option) (*Server, error) {
+	o, err := newOpt(fs...)
+	if err != nil {
+		return nil, errors.Wrap(err, "wrong ldaptest Server options")
+	}
+	ln, err := net.Listen("tcp", o.addr)
+	if err != nil {
+		return nil, errors.Wrap(err, "ldaptest listen")
+	}
+	if o.tls != nil {
+		ln = tls.NewListener(ln, o.tls)
+	}
+	s := &Server{
+		opt:      o,
+		ln:       ln,
+		dir:      newDirectory(),
+		mtx:      &sync.Mutex{},
+		wg:       &sync.WaitGroup{},
+		sessions: make(map[*session]struct{}),
+	}
+	s.dir.do(func(t *tree) {
+		for _, e := range o.entries {
+			t.add(newEntry(e.DN, e.Attributes))
+		}
+	})
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+func (s *Server) URL() string {
+	if s.opt.tls != nil {
+		return "ldaps://" + s.ln.Addr().String()
+	}
+	return "ldap://" + s.ln.Addr().String()
+}
+
+func (s *Server) Addr() string {
+	return s.ln.Addr().String()
+}
+
+func (s *Server) BaseDN() string {
+	return s.opt.baseDN
+}
+
+func (s *Server) Sessions() int {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return len(s.sessions)
+}
+
+// DropConnections closes the open connections and their watches like a restarted server would,
+// new ones are still accepted
+func (s *Server) DropConnections() {
+	s.mtx.Lock()
+	for ss := range s.sessions {
+		_ = ss.raw.Close()
+	}
+	s.mtx.Unlock()
+	s.dir.do(func(t *tree) { t.watches = make(map[*watch]struct{}) })
+}
+
+// Watches counts the open persistent searches and AD notification searches
+func (s *Server) Watches() int {
+	n := 0
+	s.dir.do(func(t *tree) { n = len(t.watches) })
+	return n
+}
+
+func (s *Server) Close() {
+	s.mtx.Lock()
+	if s.closed {
+		s.mtx.Unlock()
+		return
+	}
+	s.closed = true
+	_ = s.ln.Close()
+	for ss := range s.sessions {
+		_ = ss.raw.Close()
+	}
+	s.mtx.Unlock()
+	s.wg.Wait()
+	s.dir.close()
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		ss := &session{srv: s, raw: conn, conn: conn, tls: s.opt.tls != nil, mtx: &sync.Mutex{}}
+		s.mtx.Lock()
+		if s.closed {
+			s.mtx.Unlock()
+			_ = conn.Close()
+			return
+		}
+		s.sessions[ss] = struct{}{}
+		s.wg.Add(1)
+		s.mtx.Unlock()
+		go ss.serve()
+	}
+}
+
+func (ss *session) serve() {
+	defer ss.srv.wg.Done()
+	defer func() {
+		ss.srv.mtx.Lock()
+		delete(ss.srv.sessions, ss)
+		ss.srv.mtx.Unlock()
+		ss.srv.dir.do(func(t *tree) { t.unwatch(ss, 0) })
+		_ = ss.conn.Close()
+		_ = ss.raw.Close()
+	}()
+	defer func() {
+		if e := recover(); e != nil {
+			log.Println("ldaptest session recover", e)
+		}
+	}()
+	for {
+		p, err := ber.ReadPacket(ss.conn)
+		if err != nil {
+			return
+		}
+		req, err := parseRequest(p)
+		if err != nil {
+			log.Println("ldaptest wrong request", err)
+			return
+		}
+		if !ss.handle(req) {
+			return
+		}
+	}
+}
+
+func (ss *session) handle(req request) bool {
+	switch req.op.Tag {
+	case ldap.ApplicationUnbindRequest:
+		return false
+	case ldap.ApplicationAbandonRequest:
+		if id, err := ber.ParseInt64(req.op.Data.Bytes()); err == nil && id != 0 {
+			ss.srv.dir.do(func(t *tree) { t.unwatch(ss, id) })
+		}
+	case ldap.ApplicationBindRequest:
+		ss.bind(req)
+	case ldap.ApplicationSearchRequest:
+		ss.search(req)
+	case ldap.ApplicationAddRequest:
+		ss.add(req)
+	case ldap.ApplicationModifyRequest:
+		ss.modify(req)
+	case ldap.ApplicationDelRequest:
+		ss.del(req)
+	case ldap.ApplicationExtendedRequest:
+		return ss.extended(req)
+	default:
+		ss.reply(req, result(req.op.Tag+1, ldap.LDAPResultUnwillingToPerform, "operation is not supported"))
+	}
+	return true
+}
+
+func (ss *session) bind(req request) {
+	op := req.op
+	if len(op.Children) < 3 || op.Children[2].Tag != simpleAuth {
+		ss.reply(req, result(ldap.ApplicationBindResponse,
+			ldap.LDAPResultAuthMethodNotSupported, "only simple bind is supported"))
+		return
+	}
+	name, pass := packetString(op.Children[1]), op.Children[2].Data.String()
+	ss.bound = ""
+	if pass != "" && ss.srv.opt.requireTLS && !ss.tls {
+		ss.reply(req, result(ldap.ApplicationBindResponse,
+			ldap.LDAPResultConfidentialityRequired, "confidentiality required"))
+		return
+	}
+	if name == "" && pass == "" {
+		ss.reply(req, result(ldap.ApplicationBindResponse, ldap.LDAPResultSuccess, ""))
+		return
+	}
+	if pass == "" {
+		ss.reply(req, result(ldap.ApplicationBindResponse,
+			ldap.LDAPResultUnwillingToPerform, "unauthenticated bind is not allowed"))
+		return
+	}
+	var (
+		dn string
+		ok bool
+	)
+	ss.srv.dir.do(func(t *tree) {
+		e, found := t.principal(name)
+		if !found {
+			return
+		}
+		for _, v := range e.get(passwordAttr) {
+			if v == pass {
+				dn, ok = e.dn, true
+				return
+			}
+		}
+	})
+	if !ok {
+		ss.reply(req, result(ldap.ApplicationBindResponse, ldap.LDAPResultInvalidCredentials, "invalid credentials"))
+		return
+	}
+	ss.bound = dn
+	ss.reply(req, result(ldap.ApplicationBindResponse, ldap.LDAPResultSuccess, ""))
+}
+
+func (ss *session) extended(req request) bool {
+	name := ""
+	if len(req.op.Children) > 0 {
+		name = packetString(req.op.Children[0])
+	}
+	if name == passwdModOID {
+		ss.passwordModify(req)
+		return true
+	}
+	if name != startTLSOID || ss.srv.opt.startTLS == nil {
+		ss.reply(req, result(ldap.ApplicationExtendedResponse,
+			ldap.LDAPResultProtocolError, "unsupported extended operation"))
+		return true
+	}
+	if ss.tls {
+		ss.reply(req, result(ldap.ApplicationExtendedResponse,
+			ldap.LDAPResultOperationsError, "tls is already established"))
+		return true
+	}
+	res := result(ldap.ApplicationExtendedResponse, ldap.LDAPResultSuccess, "")
+	res.AppendChild(ber.NewString(ber.ClassContext, ber.TypePrimitive, responseName, startTLSOID, "Response Name"))
+	ss.reply(req, res)
+	conn := tls.Server(ss.raw, ss.srv.opt.startTLS)
+	if err := conn.Handshake(); err != nil {
+		log.Println("ldaptest starttls handshake", err)
+		return false
+	}
+	ss.mtx.Lock()
+	ss.conn, ss.tls = conn, true
+	ss.mtx.Unlock()
+	return true
+}
+
+func (ss *session) search(req request) {
+	op := req.op
+	if len(op.Children) < 8 {
+		ss.reply(req, result(ldap.ApplicationSearchResultDone, ldap.LDAPResultProtocolError, "wrong search request"))
+		return
+	}
+	time.Sleep(ss.srv.opt.latency)
+	base := packetString(op.Children[0])
+	scope := int(op.Children[1].Value.(int64))
+	sizeLimit := int(op.Children[3].Value.(int64))
+	types := op.Children[5].Value.(bool)
+	filter := op.Children[6]
+	attrs := make([]string, 0, len(op.Children[7].Children))
+	for _, a := range op.Children[7].Children {
+		attrs = append(attrs, packetString(a))
+	}
+	if base == "" && scope == ldap.ScopeBaseObject {
+		ss.rootDSE(req, filter, attrs, types)
+		return
+	}
+	if ss.bound == "" {
+		ss.reply(req, result(ldap.ApplicationSearchResultDone,
+			ldap.LDAPResultOperationsError, "a successful bind must be completed on the connection"))
+		return
+	}
+	w, failed, err := ss.watchControl(req)
+	if err != nil {
+		ss.reply(req, result(ldap.ApplicationSearchResultDone, failed, err.Error()))
+		return
+	}
+	if w != nil {
+		ss.watch(req, w, base, scope, filter, attrs, types)
+		return
+	}
+	var paging *ldap.ControlPaging
+	if c, ok := ldap.FindControl(req.controls, ldap.ControlTypePaging).(*ldap.ControlPaging); ok {
+		paging = c
+	}
+	sortKeys, err := sortControl(req.controls)
+	if err != nil {
+		ss.reply(req, result(ldap.ApplicationSearchResultDone, ldap.LDAPResultProtocolError, err.Error()))
+		return
+	}
+	view, err := vlvControl(req.controls)
+	if err != nil {
+		ss.reply(req, result(ldap.ApplicationSearchResultDone, ldap.LDAPResultProtocolError, err.Error()))
+		return
+	}
+	var controls []*ber.Packet
+	if sortKeys != nil {
+		controls = append(controls, sortResult(ldap.LDAPResultSuccess))
+	}
+
+	var (
+		entries []*ber.Packet
+		code    uint16
+		msg     string
+		cookie  string
+	)
+	ss.srv.dir.do(func(t *tree) {
+		var p *page
+		if paging != nil && len(paging.Cookie) > 0 {
+			var ok bool
+			p, ok = t.pages[string(paging.Cookie)]
+			if ok && p.owner != ss {
+				code, msg = ldap.LDAPResultUnwillingToPerform, "paged results cookie belongs to another connection"
+				return
+			}
+			delete(t.pages, string(paging.Cookie))
+			if !ok {
+				code, msg = ldap.LDAPResultUnwillingToPerform, "paged results cookie is invalid"
+				return
+			}
+			if paging.PagingSize == 0 {
+				return
+			}
+		} else {
+			baseKeys := dnKeys(base)
+			if _, ok := t.lookup(base); !ok && len(baseKeys) > 0 && baseKeys[0] != "" {
+				code, msg = ldap.LDAPResultNoSuchObject, "no such object"
+				return
+			}
+			p = &page{attrs: attrs, types: types}
+			candidates := t.scope(baseKeys, scope)
+			if ldap.FindControl(req.controls, ldap.ControlTypeMicrosoftShowDeleted) != nil {
+				candidates = append(candidates, t.tombstones(baseKeys, scope)...)
+			}
+			for _, e := range candidates {
+				if t.match(filter, e) {
+					p.keys = append(p.keys, e.key())
+				}
+			}
+			if len(sortKeys) > 0 {
+				t.sort(p.keys, sortKeys)
+			}
+		}
+		keys := p.keys
+		if view != nil {
+			if len(sortKeys) == 0 {
+				code, msg = sortControlMissing, "virtual list view needs a sort control"
+				controls = append(controls, vlvResponse(0, 0, sortControlMissing))
+				return
+			}
+			var pos int
+			keys, pos = t.window(keys, sortKeys[0], view)
+			controls = append(controls, vlvResponse(pos, len(p.keys), ldap.LDAPResultSuccess))
+		}
+		if sizeLimit > 0 && len(keys) > sizeLimit {
+			keys, code, msg = keys[:sizeLimit], ldap.LDAPResultSizeLimitExceeded, "size limit exceeded"
+		}
+		if paging == nil && len(keys) > ss.srv.opt.maxPageSize {
+			// like AD's MaxPageSize the page size limits a search without paging too
+			keys, code, msg = keys[:ss.srv.opt.maxPageSize], ldap.LDAPResultSizeLimitExceeded, "size limit exceeded"
+		}
+		if paging != nil && code == ldap.LDAPResultSuccess {
+			size := int(paging.PagingSize)
+			if size <= 0 || size > ss.srv.opt.maxPageSize {
+				size = ss.srv.opt.maxPageSize
+			}
+			if len(keys) > size {
+				cookie = t.newPage(&page{keys: keys[size:], attrs: p.attrs, types: p.types, owner: ss})
+				keys = keys[:size]
+			}
+		}
+		for _, k := range keys {
+			if e, ok := t.entries[k]; ok {
+				entries = append(entries, t.render(e, p.attrs, p.types))
+			}
+		}
+	})
+	for _, e := range entries {
+		ss.reply(req, e)
+	}
+	if paging != nil {
+		ctrl := ldap.NewControlPaging(0)
+		ctrl.SetCookie([]byte(cookie))
+		controls = append(controls, ctrl.Encode())
+	}
+	ss.reply(req, result(ldap.ApplicationSearchResultDone, code, msg), controls...)
+}
+
+// watch keeps the search open, the changes are sent by the writes until the session ends or abandons it
+func (ss *session) watch(req request, w *watch, base string, scope int, filter *ber.Packet, attrs []string, types bool) {
+	if w.changeTypes == 0 && !adNotificationFilter(filter) {
+		ss.reply(req, result(ldap.ApplicationSearchResultDone, ldap.LDAPResultUnwillingToPerform,
+			"change notifications take the (objectClass=*) filter only"))
+		return
+	}
+	w.ss, w.req, w.base, w.scope, w.filter, w.attrs, w.types = ss, req, dnKeys(base), scope, filter, attrs, types
+	code := uint16(ldap.LDAPResultSuccess)
+	ss.srv.dir.do(func(t *tree) {
+		if _, ok := t.lookup(base); !ok && len(w.base) > 0 && w.base[0] != "" {
+			code = ldap.LDAPResultNoSuchObject
+			return
+		}
+		t.watches[w] = struct{}{}
+	})
+	if code != ldap.LDAPResultSuccess {
+		ss.reply(req, result(ldap.ApplicationSearchResultDone, code, "no such object"))
+	}
+}
+
+func (ss *session) rootDSE(req request, filter *ber.Packet, attrs []string, types bool) {
+	var pkt *ber.Packet
+	attributes := map[string][]string{
+		"objectClass":          {"top"},
+		"namingContexts":       {ss.srv.opt.baseDN},
+		"defaultNamingContext": {ss.srv.opt.baseDN},
+		"supportedLDAPVersion": {"3"},
+		"supportedControl":     {ldap.ControlTypePaging, sortOID, vlvOID, psearchOID},
+		"vendorName":           {vendorName},
+		"dsServiceName": {"CN=NTDS Settings,CN=" + vendorName + ",CN=Servers,CN=Default-First-Site-Name,CN=Sites," +
+			"CN=Configuration," + ss.srv.opt.baseDN},
+	}
+	attributes["supportedExtension"] = []string{passwdModOID}
+	if ss.srv.opt.startTLS != nil {
+		attributes["supportedExtension"] = append(attributes["supportedExtension"], startTLSOID)
+	}
+	if ss.srv.opt.activeDirectory() {
+		attributes["supportedControl"] = []string{ldap.ControlTypePaging, sortOID, vlvOID,
+			ldap.ControlTypeMicrosoftNotification, ldap.ControlTypeMicrosoftShowDeleted}
+	}
+	for k, v := range ss.srv.opt.rootDSE {
+		attributes[k] = v
+	}
+	ss.srv.dir.do(func(t *tree) {
+		attributes["highestCommittedUSN"] = []string{strconv.FormatInt(t.usn, 10)}
+		e := newEntry("", attributes)
+		if t.match(filter, e) {
+			pkt = t.render(e, attrs, types)
+		}
+	})
+	if pkt != nil {
+		ss.reply(req, pkt)
+	}
+	ss.reply(req, result(ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess, ""))
+}
+
+func (ss *session) reply(req request, op *ber.Packet, controls ...*ber.Packet) {
+	p := ber.NewSequence("LDAP Response")
+	p.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, req.id, "MessageID"))
+	p.AppendChild(op)
+	if len(controls) > 0 {
+		cs := ber.Encode(ber.ClassContext, ber.TypeConstructed, controlsTag, nil, "Controls")
+		for _, c := range controls {
+			cs.AppendChild(c)
+		}
+		p.AppendChild(cs)
+	}
+	ss.mtx.Lock()
+	defer ss.mtx.Unlock()
+	if _, err := ss.conn.Write(p.Bytes()); err != nil {
+		_ = ss.conn.Close()
+	}
+}
+
+func (t *tree) principal(name string) (*entry, bool) {
+	if e, ok := t.lookup(name); ok && strings.Contains(name, "=") {
+		return e, true
+	}
+	if i := strings.LastIndex(name, `\`); i >= 0 {
+		return t.find("sAMAccountName", name[i+1:])
+	}
+	if strings.Contains(name, "@") {
+		return t.find("userPrincipalName", name)
+	}
+	if e, ok := t.find("sAMAccountName", name); ok {
+		return e, true
+	}
+	return t.find("uid", name)
+}
+
+func (t *tree) render(e *entry, attrs []string, types bool) *ber.Packet {
+	all := len(attrs) == 0
+	operational := false
+	want := make(map[string]bool, len(attrs))
+	for _, a := range attrs {
+		switch a {
+		case "*":
+			all = true
+		case "+":
+			operational = true
+		default:
+			want[strings.ToLower(a)] = true
+		}
+	}
+	list := ber.NewSequence("Attributes")
+	add := func(name string, vals []string) {
+		a := ber.NewSequence("Attribute")
+		a.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "Type"))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Values")
+		if !types {
+			for _, v := range vals {
+				set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, v, "Value"))
+			}
+		}
+		a.AppendChild(set)
+		list.AppendChild(a)
+	}
+	memberOf := strings.ToLower(memberOfAttr)
+	for _, k := range e.names {
+		if k == memberOf || k == strings.ToLower(passwordAttr) || !all && !want[k] ||
+			operationalAttrs[k] && !operational && !want[k] {
+			continue
+		}
+		a := e.attrs[k]
+		add(a.name, a.vals)
+	}
+	if all || operational || want[memberOf] {
+		if vals := t.values(e, memberOfAttr); len(vals) > 0 {
+			add(memberOfAttr, vals)
+		}
+	}
+	pkt := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "Search Result Entry")
+	pkt.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, e.dn, "Object Name"))
+	pkt.AppendChild(list)
+	return pkt
+}
+
+func parseRequest(p *ber.Packet) (req request, err error) {
+	if len(p.Children) < 2 {
+		return req, errors.New("ldap message must have id and operation")
+	}
+	id, ok := p.Children[0].Value.(int64)
+	if !ok {
+		return req, errors.New("wrong ldap message id")
+	}
+	req.id, req.op = id, p.Children[1]
+	if len(p.Children) < 3 || p.Children[2].Tag != controlsTag {
+		return req, nil
+	}
+	for _, c := range p.Children[2].Children {
+		if len(c.Children) > 0 && c.Children[0].Data.String() == ldap.ControlTypeBeheraPasswordPolicy {
+			// go-ldap can not decode the request control, it has no value
+			req.controls = append(req.controls, ldap.NewControlBeheraPasswordPolicy())
+			continue
+		}
+		ctrl, e := ldap.DecodeControl(c)
+		if e != nil {
+			return req, errors.Wrap(e, "decode control")
+		}
+		req.controls = append(req.controls, ctrl)
+	}
+	return req, nil
+}
+
+func result(tag ber.Tag, code uint16, msg string) *ber.Packet {
+	p := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Result")
+	p.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, uint64(code), "Result Code"))
+	p.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Matched DN"))
+	p.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, msg, "Diagnostic Message"))
+	return p
+}
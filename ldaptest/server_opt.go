@@ -0,0 +1,147 @@
+package ldaptest
+
+import (
+	"crypto/tls"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const defaultMaxPageSize = 1000
+
+type opt struct {
+	addr        string
+	baseDN      string
+	entries     []Entry
+	maxPageSize int
+	tls         *tls.Config
+	startTLS    *tls.Config
+	requireTLS  bool
+	rootDSE     map[string][]string
+	latency     time.Duration
+}
+
+// Option configures a Server, see the With functions
+type Option func(*opt) error
+
+func newOpt(fs ...Option) (*opt, error) {
+	o := &opt{
+		addr:        "127.0.0.1:0",
+		maxPageSize: defaultMaxPageSize,
+	}
+	for _, f := range fs {
+		if e := f(o); e != nil {
+			return nil, e
+		}
+	}
+	if o.baseDN == "" && len(o.entries) > 0 {
+		o.baseDN = o.entries[0].DN
+	}
+	return o, nil
+}
+
+func WithAddr(addr string) func(*opt) error {
+	return func(o *opt) error {
+		o.addr = addr
+		return nil
+	}
+}
+
+func WithBaseDN(dn string) func(*opt) error {
+	return func(o *opt) error {
+		o.baseDN = dn
+		return nil
+	}
+}
+
+// WithMaxPageSize caps the entries of a response like AD's MaxPageSize: a page is cut to n,
+// a search without paging fails with sizeLimitExceeded beyond it
+func WithMaxPageSize(n int) func(*opt) error {
+	return func(o *opt) error {
+		o.maxPageSize = n
+		return nil
+	}
+}
+
+// WithLatency delays every search response by d like a slow directory does
+func WithLatency(d time.Duration) func(*opt) error {
+	return func(o *opt) error {
+		o.latency = d
+		return nil
+	}
+}
+
+func WithEntries(es ...Entry) func(*opt) error {
+	return func(o *opt) error {
+		o.entries = append(o.entries, es...)
+		return nil
+	}
+}
+
+func WithLDIF(ldif string) func(*opt) error {
+	return func(o *opt) error {
+		es, err := ParseLDIF(strings.NewReader(ldif))
+		if err != nil {
+			return err
+		}
+		o.entries = append(o.entries, es...)
+		return nil
+	}
+}
+
+func WithLDIFFile(path string) func(*opt) error {
+	return func(o *opt) error {
+		f, err := os.Open(path)
+		if err != nil {
+			return errors.Wrap(err, "open ldif")
+		}
+		defer f.Close()
+		es, err := ParseLDIF(f)
+		if err != nil {
+			return errors.Wrap(err, path)
+		}
+		o.entries = append(o.entries, es...)
+		return nil
+	}
+}
+
+func WithTLS(cfg *tls.Config) func(*opt) error {
+	return func(o *opt) error {
+		if cfg == nil {
+			return errors.New("tls config is required")
+		}
+		o.tls = cfg
+		return nil
+	}
+}
+
+func WithStartTLS(cfg *tls.Config) func(*opt) error {
+	return func(o *opt) error {
+		if cfg == nil {
+			return errors.New("tls config is required")
+		}
+		o.startTLS = cfg
+		return nil
+	}
+}
+
+func WithRequireTLS() func(*opt) error {
+	return func(o *opt) error {
+		o.requireTLS = true
+		return nil
+	}
+}
+
+func WithRootDSE(attrs map[string][]string) func(*opt) error {
+	return func(o *opt) error {
+		if o.rootDSE == nil {
+			o.rootDSE = make(map[string][]string, len(attrs))
+		}
+		for k, v := range attrs {
+			o.rootDSE[k] = v
+		}
+		return nil
+	}
+}
@@ -0,0 +1,398 @@
+package ldaptest
+
+// noinspection GoRedundantImportAlias
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	ldap "github.com/go-ldap/ldap/v3"
+)
+
+const testLDIF = `version: 1
+
+dn: dc=example,dc=org
+objectClass: domain
+dc: example
+
+dn: ou=people,dc=example,dc=org
+objectClass: organizationalUnit
+ou: people
+
+dn: uid=alice,ou=people,dc=example,dc=org
+objectClass: inetOrgPerson
+uid: alice
+cn: Alice
+sn: Liddell
+mail: alice@example.org
+userAccountControl: 512
+userPassword: alicePass
+
+dn: uid=bob,ou=people,dc=example,dc=org
+objectClass: inetOrgPerson
+uid: bob
+cn:: Qm9i
+sn: Builder
+mail: bob@example.org
+userAccountControl: 514
+userPassword: bobPass
+
+dn: cn=admins,dc=example,dc=org
+objectClass: groupOfNames
+cn: admins
+description: long description
+  folded
+member: uid=alice,ou=people,dc=example,dc=org
+`
+
+func server(t *testing.T) *Server {
+	srv, err := NewServer(WithLDIF(testLDIF), WithMaxPageSize(1))
+	if err != nil {
+		t.Fatal("ldaptest start", err)
+	}
+	return srv
+}
+
+func conn(t *testing.T, srv *Server) *ldap.Conn {
+	con, err := ldap.DialURL(srv.URL())
+	if err != nil {
+		t.Fatal("ldaptest dial", err)
+	}
+	if err = con.Bind("uid=alice,ou=people,dc=example,dc=org", "alicePass"); err != nil {
+		t.Fatal("ldaptest bind", err)
+	}
+	return con
+}
+
+func TestParseLDIF(t *testing.T) {
+	es, err := ParseLDIF(strings.NewReader(testLDIF))
+	if err != nil {
+		t.Fatalf("ParseLDIF() unexpected error = %v", err)
+	}
+	if len(es) != 5 {
+		t.Fatalf("ParseLDIF() got %d entries, want 5", len(es))
+	}
+	if got := es[3].Attributes["cn"]; !reflect.DeepEqual(got, []string{"Bob"}) {
+		t.Errorf("ParseLDIF() base64 value = %v", got)
+	}
+	if got := es[4].Attributes["description"]; !reflect.DeepEqual(got, []string{"long description folded"}) {
+		t.Errorf("ParseLDIF() folded value = %v", got)
+	}
+	if _, err = ParseLDIF(strings.NewReader("cn: orphan\n")); err == nil {
+		t.Error("ParseLDIF() expected error for attribute before dn")
+	}
+}
+
+func TestServer_Bind(t *testing.T) {
+	srv := server(t)
+	defer srv.Close()
+	tests := []struct {
+		name    string
+		usr     string
+		pass    string
+		wantErr bool
+	}{
+		{name: "dn", usr: "uid=alice,ou=people,dc=example,dc=org", pass: "alicePass"},
+		{name: "uid", usr: "bob", pass: "bobPass"},
+		{name: "wrong pass", usr: "bob", pass: "alicePass", wantErr: true},
+		{name: "unknown", usr: "carol", pass: "carolPass", wantErr: true},
+	}
+	for _, test := range tests {
+		tt := test
+		t.Run(tt.name, func(t *testing.T) {
+			con, err := ldap.DialURL(srv.URL())
+			if err != nil {
+				t.Fatal("dial", err)
+			}
+			defer con.Close()
+			err = con.Bind(tt.usr, tt.pass)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Bind() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestServer_Search(t *testing.T) {
+	srv := server(t)
+	defer srv.Close()
+	con := conn(t, srv)
+	defer con.Close()
+	tests := []struct {
+		name   string
+		base   string
+		scope  int
+		filter string
+		attrs  []string
+		want   []string
+	}{
+		{
+			name:   "subtree equality",
+			base:   "dc=example,dc=org",
+			scope:  ldap.ScopeWholeSubtree,
+			filter: "(objectClass=inetOrgPerson)",
+			want:   []string{"uid=alice,ou=people,dc=example,dc=org", "uid=bob,ou=people,dc=example,dc=org"},
+		},
+		{
+			name:   "one level",
+			base:   "dc=example,dc=org",
+			scope:  ldap.ScopeSingleLevel,
+			filter: "(objectClass=*)",
+			want:   []string{"ou=people,dc=example,dc=org", "cn=admins,dc=example,dc=org"},
+		},
+		{
+			name:   "substring and not",
+			base:   "dc=example,dc=org",
+			scope:  ldap.ScopeWholeSubtree,
+			filter: "(&(mail=*@example.org)(!(uid=al*)))",
+			want:   []string{"uid=bob,ou=people,dc=example,dc=org"},
+		},
+		{
+			name:   "memberOf",
+			base:   "dc=example,dc=org",
+			scope:  ldap.ScopeWholeSubtree,
+			filter: "(memberOf=CN=Admins,DC=example,DC=org)",
+			want:   []string{"uid=alice,ou=people,dc=example,dc=org"},
+		},
+		{
+			name:   "extensible bit and",
+			base:   "dc=example,dc=org",
+			scope:  ldap.ScopeWholeSubtree,
+			filter: "(userAccountControl:1.2.840.113556.1.4.803:=2)",
+			want:   []string{"uid=bob,ou=people,dc=example,dc=org"},
+		},
+		{
+			name:   "extensible in chain",
+			base:   "dc=example,dc=org",
+			scope:  ldap.ScopeWholeSubtree,
+			filter: "(memberOf:1.2.840.113556.1.4.1941:=cn=admins,dc=example,dc=org)",
+			want:   []string{"uid=alice,ou=people,dc=example,dc=org"},
+		},
+		{
+			name:   "extensible equality",
+			base:   "dc=example,dc=org",
+			scope:  ldap.ScopeWholeSubtree,
+			filter: "(uid:=BOB)",
+			want:   []string{"uid=bob,ou=people,dc=example,dc=org"},
+		},
+	}
+	for _, test := range tests {
+		tt := test
+		t.Run(tt.name, func(t *testing.T) {
+			sr, err := con.SearchWithPaging(ldap.NewSearchRequest(tt.base, tt.scope, ldap.NeverDerefAliases,
+				0, 0, false, tt.filter, tt.attrs, nil), 1)
+			if err != nil {
+				t.Fatalf("Search() unexpected error = %v", err)
+			}
+			got := make([]string, 0, len(sr.Entries))
+			for _, e := range sr.Entries {
+				got = append(got, e.DN)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Search() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServer_SearchAttributes(t *testing.T) {
+	srv := server(t)
+	defer srv.Close()
+	con := conn(t, srv)
+	defer con.Close()
+	sr, err := con.Search(ldap.NewSearchRequest("uid=alice,ou=people,dc=example,dc=org", ldap.ScopeBaseObject,
+		ldap.NeverDerefAliases, 0, 0, false, "(objectClass=*)", []string{"cn", "memberOf"}, nil))
+	if err != nil {
+		t.Fatalf("Search() unexpected error = %v", err)
+	}
+	if len(sr.Entries) != 1 {
+		t.Fatalf("Search() got %d entries", len(sr.Entries))
+	}
+	e := sr.Entries[0]
+	if len(e.Attributes) != 2 || e.GetAttributeValue("cn") != "Alice" ||
+		e.GetAttributeValue("memberOf") != "cn=admins,dc=example,dc=org" {
+		t.Errorf("Search() got attributes = %+v", e.Attributes)
+	}
+	sr, err = con.Search(ldap.NewSearchRequest("uid=alice,ou=people,dc=example,dc=org", ldap.ScopeBaseObject,
+		ldap.NeverDerefAliases, 0, 0, false, "(objectClass=*)", []string{"+"}, nil))
+	if err != nil || len(sr.Entries) != 1 || len(sr.Entries[0].Attributes) != 1 ||
+		sr.Entries[0].GetAttributeValue("memberOf") != "cn=admins,dc=example,dc=org" {
+		t.Errorf("Search() operational attributes got = %+v, err %v", sr, err)
+	}
+	_, err = con.Search(ldap.NewSearchRequest("ou=nobody,dc=example,dc=org", ldap.ScopeWholeSubtree,
+		ldap.NeverDerefAliases, 0, 0, false, "(objectClass=*)", nil, nil))
+	if !ldap.IsErrorWithCode(err, ldap.LDAPResultNoSuchObject) {
+		t.Errorf("Search() for missing base error = %v", err)
+	}
+}
+
+func TestServer_Write(t *testing.T) {
+	srv := server(t)
+	defer srv.Close()
+	con := conn(t, srv)
+	defer con.Close()
+	dn := "uid=carol,ou=people,dc=example,dc=org"
+	add := ldap.NewAddRequest(dn, nil)
+	add.Attribute("objectClass", []string{"inetOrgPerson"})
+	add.Attribute("uid", []string{"carol"})
+	add.Attribute("unicodePwd", []string{"\"\x00c\x00P\x00\"\x00"})
+	if err := con.Add(add); err != nil {
+		t.Fatalf("Add() unexpected error = %v", err)
+	}
+	if err := con.Add(add); !ldap.IsErrorWithCode(err, ldap.LDAPResultEntryAlreadyExists) {
+		t.Errorf("Add() existing entry error = %v", err)
+	}
+	orphan := ldap.NewAddRequest("uid=x,ou=nobody,dc=example,dc=org", nil)
+	orphan.Attribute("uid", []string{"x"})
+	if err := con.Add(orphan); !ldap.IsErrorWithCode(err, ldap.LDAPResultNoSuchObject) {
+		t.Errorf("Add() without parent error = %v", err)
+	}
+	if err := con.Bind("carol", "cP"); err != nil {
+		t.Fatalf("Bind() with unicodePwd unexpected error = %v", err)
+	}
+	if _, err := con.PasswordModify(ldap.NewPasswordModifyRequest("", "wrong", "cP2")); !ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+		t.Errorf("PasswordModify() wrong old password error = %v", err)
+	}
+	if _, err := con.PasswordModify(ldap.NewPasswordModifyRequest("", "cP", "cP2")); err != nil {
+		t.Fatalf("PasswordModify() unexpected error = %v", err)
+	}
+	if err := con.Bind("carol", "cP2"); err != nil {
+		t.Fatalf("Bind() after PasswordModify unexpected error = %v", err)
+	}
+
+	mod := ldap.NewModifyRequest(dn, nil)
+	mod.Add("mail", []string{"carol@example.org"})
+	mod.Delete("sn", nil)
+	if err := con.Modify(mod); !ldap.IsErrorWithCode(err, ldap.LDAPResultNoSuchAttribute) {
+		t.Errorf("Modify() missing attribute error = %v", err)
+	}
+	mod = ldap.NewModifyRequest(dn, nil)
+	mod.Add("mail", []string{"carol@example.org"})
+	mod.Replace("cn", []string{"Carol"})
+	if err := con.Modify(mod); err != nil {
+		t.Fatalf("Modify() unexpected error = %v", err)
+	}
+	sr, err := con.Search(ldap.NewSearchRequest(dn, ldap.ScopeBaseObject, ldap.NeverDerefAliases,
+		0, 0, false, "(objectClass=*)", []string{"mail", "cn"}, nil))
+	if err != nil || len(sr.Entries) != 1 || sr.Entries[0].GetAttributeValue("mail") != "carol@example.org" ||
+		sr.Entries[0].GetAttributeValue("cn") != "Carol" {
+		t.Errorf("Modify() result = %+v, err %v", sr, err)
+	}
+
+	if err = con.Del(ldap.NewDelRequest("ou=people,dc=example,dc=org", nil)); !ldap.IsErrorWithCode(err, ldap.LDAPResultNotAllowedOnNonLeaf) {
+		t.Errorf("Del() non leaf error = %v", err)
+	}
+	if err = con.Del(ldap.NewDelRequest(dn, nil)); err != nil {
+		t.Fatalf("Del() unexpected error = %v", err)
+	}
+	if err = con.Del(ldap.NewDelRequest(dn, nil)); !ldap.IsErrorWithCode(err, ldap.LDAPResultNoSuchObject) {
+		t.Errorf("Del() missing entry error = %v", err)
+	}
+}
+
+func TestServer_PagingConnection(t *testing.T) {
+	srv := server(t)
+	defer srv.Close()
+	con, other := conn(t, srv), conn(t, srv)
+	defer con.Close()
+	defer other.Close()
+	paging := ldap.NewControlPaging(1)
+	req := ldap.NewSearchRequest("dc=example,dc=org", ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		0, 0, false, "(objectClass=inetOrgPerson)", nil, []ldap.Control{paging})
+	sr, err := con.Search(req)
+	if err != nil {
+		t.Fatalf("Search() unexpected error = %v", err)
+	}
+	ctrl, ok := ldap.FindControl(sr.Controls, ldap.ControlTypePaging).(*ldap.ControlPaging)
+	if !ok || len(ctrl.Cookie) == 0 {
+		t.Fatalf("Search() got no paging cookie, controls %v", sr.Controls)
+	}
+	paging.SetCookie(ctrl.Cookie)
+	if _, err = other.Search(req); !ldap.IsErrorWithCode(err, ldap.LDAPResultUnwillingToPerform) {
+		t.Errorf("Search() with the cookie of another connection error = %v", err)
+	}
+	if sr, err = con.Search(req); err != nil || len(sr.Entries) != 1 {
+		t.Errorf("Search() next page got = %v, err %v", sr, err)
+	}
+}
+
+func TestServer_Tombstones(t *testing.T) {
+	srv, err := NewServer(WithLDIF(testLDIF), WithRootDSE(map[string][]string{"supportedCapabilities": {capActiveDirectory}}))
+	if err != nil {
+		t.Fatal("ldaptest start", err)
+	}
+	defer srv.Close()
+	con := conn(t, srv)
+	defer con.Close()
+	highest := func() string {
+		sr, err := con.Search(ldap.NewSearchRequest("", ldap.ScopeBaseObject, ldap.NeverDerefAliases, 0, 0, false,
+			"(objectClass=*)", []string{"highestCommittedUSN"}, nil))
+		if err != nil || len(sr.Entries) != 1 {
+			t.Fatalf("Search() root dse got = %v, err %v", sr, err)
+		}
+		return sr.Entries[0].GetAttributeValue("highestCommittedUSN")
+	}
+	if got := highest(); got != "0" {
+		t.Errorf("highestCommittedUSN = %s before writes", got)
+	}
+	if err = con.Del(ldap.NewDelRequest("uid=bob,ou=people,dc=example,dc=org", nil)); err != nil {
+		t.Fatalf("Del() unexpected error = %v", err)
+	}
+	if got := highest(); got != "1" {
+		t.Errorf("highestCommittedUSN = %s after a delete", got)
+	}
+	search := func(controls ...ldap.Control) []*ldap.Entry {
+		sr, err := con.Search(ldap.NewSearchRequest("dc=example,dc=org", ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+			0, 0, false, "(cn=Bob)", []string{"isDeleted", "lastKnownParent", "uSNChanged"}, controls))
+		if err != nil {
+			t.Fatalf("Search() unexpected error = %v", err)
+		}
+		return sr.Entries
+	}
+	if got := search(); len(got) != 0 {
+		t.Errorf("Search() found the deleted entry %v", got[0].DN)
+	}
+	got := search(ldap.NewControlMicrosoftShowDeleted())
+	if len(got) != 1 || !strings.Contains(got[0].DN, "DEL:") || got[0].GetAttributeValue("isDeleted") != "TRUE" ||
+		got[0].GetAttributeValue("lastKnownParent") != "ou=people,dc=example,dc=org" ||
+		got[0].GetAttributeValue("uSNChanged") != "1" {
+		t.Errorf("Search() with show deleted got = %v", got)
+	}
+}
+
+func TestServer_WatchRefused(t *testing.T) {
+	ad := map[string][]string{"supportedCapabilities": {capActiveDirectory}}
+	// every change type, changes only, with entry change controls
+	psearch := ldap.NewControlString(psearchOID, true, string([]byte{0x30, 0x09, 0x02, 0x01, 0x0f, 0x01, 0x01, 0xff, 0x01, 0x01, 0xff}))
+	tests := []struct {
+		name    string
+		dse     map[string][]string
+		filter  string
+		control ldap.Control
+		want    uint16
+	}{
+		{name: "notification without ad", filter: "(objectClass=*)", control: ldap.NewControlMicrosoftNotification(),
+			want: unavailableCriticalExtension},
+		{name: "notification filter", dse: ad, filter: "(cn=Alice)", control: ldap.NewControlMicrosoftNotification(),
+			want: ldap.LDAPResultUnwillingToPerform},
+		{name: "persistent search on ad", dse: ad, filter: "(cn=Alice)", control: psearch,
+			want: unavailableCriticalExtension},
+	}
+	for _, test := range tests {
+		tt := test
+		t.Run(tt.name, func(t *testing.T) {
+			srv, err := NewServer(WithLDIF(testLDIF), WithRootDSE(tt.dse))
+			if err != nil {
+				t.Fatal("ldaptest start", err)
+			}
+			defer srv.Close()
+			con := conn(t, srv)
+			defer con.Close()
+			_, err = con.Search(ldap.NewSearchRequest("dc=example,dc=org", ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+				0, 0, false, tt.filter, nil, []ldap.Control{tt.control}))
+			if !ldap.IsErrorWithCode(err, tt.want) {
+				t.Errorf("Search() error = %v, want code %d", err, tt.want)
+			}
+		})
+	}
+}
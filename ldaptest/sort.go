@@ -0,0 +1,182 @@
+package ldaptest
+
+// noinspection GoRedundantImportAlias
+import (
+	"sort"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	ldap "github.com/go-ldap/ldap/v3"
+	"github.com/pkg/errors"
+)
+
+const (
+	sortOID        = "1.2.840.113556.1.4.473"
+	sortResultOID  = "1.2.840.113556.1.4.474"
+	vlvOID         = "2.16.840.1.113730.3.4.9"
+	vlvResponseOID = "2.16.840.1.113730.3.4.10"
+	// sortControlMissing is the result of a virtual list view without a sort control
+	sortControlMissing = 60
+)
+
+type sortKey struct {
+	attr    string
+	reverse bool
+}
+
+type vlv struct {
+	before, after int
+	offset, count int
+	// from is the greaterThanOrEqual target, set picks it over the offset
+	from string
+	set  bool
+}
+
+// controlValue decodes the value of a control go-ldap does not know, nil when the request has none
+func controlValue(controls []ldap.Control, oid string) (*ber.Packet, error) {
+	c, ok := ldap.FindControl(controls, oid).(*ldap.ControlString)
+	if !ok {
+		return nil, nil
+	}
+	p, err := ber.DecodePacketErr([]byte(c.ControlValue))
+	if err != nil {
+		return nil, errors.Wrap(err, "decode control "+oid)
+	}
+	return p, nil
+}
+
+func sortControl(controls []ldap.Control) ([]sortKey, error) {
+	p, err := controlValue(controls, sortOID)
+	if p == nil || err != nil {
+		return nil, err
+	}
+	keys := make([]sortKey, 0, len(p.Children))
+	for _, k := range p.Children {
+		if len(k.Children) == 0 {
+			return nil, errors.New("wrong sort key")
+		}
+		key := sortKey{attr: packetString(k.Children[0])}
+		for _, o := range k.Children[1:] {
+			if o.Tag == 1 {
+				key.reverse = len(o.Data.Bytes()) > 0 && o.Data.Bytes()[0] != 0
+			}
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func vlvControl(controls []ldap.Control) (*vlv, error) {
+	p, err := controlValue(controls, vlvOID)
+	if p == nil || err != nil {
+		return nil, err
+	}
+	if len(p.Children) < 3 {
+		return nil, errors.New("wrong virtual list view")
+	}
+	v := &vlv{before: int(intValue(p.Children[0])), after: int(intValue(p.Children[1]))}
+	switch target := p.Children[2]; {
+	case target.Tag == 1:
+		v.from, v.set = target.Data.String(), true
+	case len(target.Children) == 2:
+		v.offset, v.count = int(intValue(target.Children[0])), int(intValue(target.Children[1]))
+	default:
+		return nil, errors.New("wrong virtual list view target")
+	}
+	return v, nil
+}
+
+func intValue(p *ber.Packet) int64 {
+	v, _ := p.Value.(int64)
+	return v
+}
+
+// sort orders keys like servers do, entries missing an attribute after the others
+func (t *tree) sort(keys []string, by []sortKey) {
+	first := func(k, attr string) (string, bool) {
+		if vals := t.values(t.entries[k], attr); len(vals) > 0 {
+			return vals[0], true
+		}
+		return "", false
+	}
+	sort.SliceStable(keys, func(i, j int) bool {
+		for _, s := range by {
+			a, okA := first(keys[i], s.attr)
+			b, okB := first(keys[j], s.attr)
+			r := 0
+			switch {
+			case okA && okB:
+				r = compare(a, b)
+			case okA:
+				r = -1
+			case okB:
+				r = 1
+			}
+			if r != 0 {
+				return (r < 0) != s.reverse
+			}
+		}
+		return false
+	})
+}
+
+// window cuts the list view of sorted keys, returning the 1-based target position
+func (t *tree) window(keys []string, by sortKey, v *vlv) ([]string, int) {
+	count := len(keys)
+	pos := v.offset
+	if pos < 1 {
+		pos = 1
+	}
+	if v.count > 0 {
+		pos = 1 + (pos-1)*count/v.count
+		if v.offset >= v.count {
+			pos = count
+		}
+	}
+	if pos > count {
+		pos = count
+	}
+	if v.set {
+		pos = 1 + sort.Search(count, func(i int) bool {
+			vals := t.values(t.entries[keys[i]], by.attr)
+			if len(vals) == 0 {
+				return !by.reverse
+			}
+			r := compare(vals[0], v.from)
+			return r == 0 || (r > 0) != by.reverse
+		})
+	}
+	start, end := pos-1-v.before, pos+v.after
+	if start < 0 {
+		start = 0
+	}
+	if end > count {
+		end = count
+	}
+	if start > end {
+		start = end
+	}
+	return keys[start:end], pos
+}
+
+func control(oid string, value *ber.Packet) *ber.Packet {
+	p := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Control")
+	p.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, oid, "Control Type"))
+	v := ber.Encode(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, nil, "Control Value")
+	v.AppendChild(value)
+	p.AppendChild(v)
+	return p
+}
+
+func sortResult(code uint16) *ber.Packet {
+	seq := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Sort Result")
+	seq.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, uint64(code), "Sort Result"))
+	return control(sortResultOID, seq)
+}
+
+func vlvResponse(pos, count int, code uint16) *ber.Packet {
+	seq := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Virtual List View Response")
+	seq.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, pos, "Target Position"))
+	seq.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, count, "Content Count"))
+	seq.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, uint64(code), "Result"))
+	return control(vlvResponseOID, seq)
+}
@@ -0,0 +1,107 @@
+package ldaptest
+
+// noinspection GoRedundantImportAlias
+import (
+	"strings"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	ldap "github.com/go-ldap/ldap/v3"
+	"github.com/pkg/errors"
+)
+
+const (
+	psearchOID     = "2.16.840.1.113730.3.4.3"
+	entryChangeOID = "2.16.840.1.113730.3.4.7"
+	psearchAdd     = 1
+	psearchDelete  = 2
+	psearchModify  = 4
+	// unavailableCriticalExtension is the result of a critical control the server does not know
+	unavailableCriticalExtension = 12
+)
+
+// watch is a search kept open by a persistent search or an AD notification control
+type watch struct {
+	ss     *session
+	req    request
+	base   []string
+	scope  int
+	filter *ber.Packet
+	attrs  []string
+	types  bool
+	// changeTypes is the persistent search mask, 0 for AD notifications
+	changeTypes int
+	returnECs   bool
+	// deleted is the AD show deleted control, tombstones are notified only with it
+	deleted bool
+}
+
+type notification struct {
+	w        *watch
+	entry    *ber.Packet
+	controls []*ber.Packet
+}
+
+// watchControl reads the persistent search or the AD notification control of a search, nil when there is none
+func (ss *session) watchControl(req request) (*watch, uint16, error) {
+	if ldap.FindControl(req.controls, ldap.ControlTypeMicrosoftNotification) != nil {
+		if !ss.srv.opt.activeDirectory() {
+			return nil, unavailableCriticalExtension, errors.New("change notifications are not supported")
+		}
+		return &watch{deleted: ldap.FindControl(req.controls, ldap.ControlTypeMicrosoftShowDeleted) != nil}, 0, nil
+	}
+	p, err := controlValue(req.controls, psearchOID)
+	if p == nil || err != nil {
+		return nil, ldap.LDAPResultProtocolError, err
+	}
+	if ss.srv.opt.activeDirectory() {
+		return nil, unavailableCriticalExtension, errors.New("persistent search is not supported")
+	}
+	if len(p.Children) < 3 {
+		return nil, ldap.LDAPResultProtocolError, errors.New("wrong persistent search")
+	}
+	if changesOnly, _ := p.Children[1].Value.(bool); !changesOnly {
+		return nil, ldap.LDAPResultUnwillingToPerform, errors.New("persistent search sends changes only")
+	}
+	returnECs, _ := p.Children[2].Value.(bool)
+	return &watch{changeTypes: int(intValue(p.Children[0])), returnECs: returnECs}, 0, nil
+}
+
+// notify renders e for the watches of change, rdns is where e is seen by them. Send the result once the
+// directory is released.
+func (t *tree) notify(e *entry, rdns []string, change int) []notification {
+	res := make([]notification, 0)
+	for w := range t.watches {
+		if w.changeTypes != 0 && w.changeTypes&change == 0 || w.changeTypes == 0 && e.deleted && !w.deleted ||
+			!inScope(rdns, w.base, w.scope) || !t.match(w.filter, e) {
+			continue
+		}
+		n := notification{w: w, entry: t.render(e, w.attrs, w.types)}
+		if w.returnECs {
+			seq := ber.NewSequence("Entry Change Notification")
+			seq.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, uint64(change), "Change Type"))
+			n.controls = append(n.controls, control(entryChangeOID, seq))
+		}
+		res = append(res, n)
+	}
+	return res
+}
+
+// unwatch drops the watches of ss, only the one of the message id when it is not 0
+func (t *tree) unwatch(ss *session, id int64) {
+	for w := range t.watches {
+		if w.ss == ss && (id == 0 || w.req.id == id) {
+			delete(t.watches, w)
+		}
+	}
+}
+
+func send(ns []notification) {
+	for _, n := range ns {
+		n.w.ss.reply(n.w.req, n.entry, n.controls...)
+	}
+}
+
+// adNotificationFilter is the only filter AD takes with the notification control
+func adNotificationFilter(f *ber.Packet) bool {
+	return f.Tag == ldap.FilterPresent && strings.EqualFold(f.Data.String(), "objectClass")
+}
@@ -0,0 +1,385 @@
+package ldaptest
+
+// noinspection GoRedundantImportAlias
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	ldap "github.com/go-ldap/ldap/v3"
+)
+
+const (
+	unicodePwdAttr = "unicodePwd"
+	modAdd         = 0
+	modDelete      = 1
+	modReplace     = 2
+	// password policy errors the password modify operation answers with, it refuses passwords shorter than ppolicyMinLength
+	ppolicyTooShort  = 6
+	ppolicyInHistory = 8
+	ppolicyMinLength = 3
+)
+
+type change struct {
+	op   int64
+	attr string
+	vals []string
+}
+
+func (ss *session) add(req request) {
+	op := req.op
+	if ss.bound == "" {
+		ss.reply(req, result(ldap.ApplicationAddResponse, ldap.LDAPResultInsufficientAccessRights, "bind required"))
+		return
+	}
+	if len(op.Children) < 2 {
+		ss.reply(req, result(ldap.ApplicationAddResponse, ldap.LDAPResultProtocolError, "wrong add request"))
+		return
+	}
+	dn := packetString(op.Children[0])
+	attrs := make(map[string][]string)
+	for _, a := range op.Children[1].Children {
+		name, vals := partialAttribute(a)
+		if strings.EqualFold(name, unicodePwdAttr) {
+			name, vals = passwordAttr, decodePasswords(vals)
+		}
+		attrs[name] = append(attrs[name], vals...)
+	}
+	var (
+		code uint16
+		msg  string
+		sent []notification
+	)
+	ss.srv.dir.do(func(t *tree) {
+		e := newEntry(dn, attrs)
+		if _, ok := t.entries[e.key()]; ok {
+			code, msg = ldap.LDAPResultEntryAlreadyExists, "entry already exists"
+			return
+		}
+		if len(e.rdns) > 1 && inScope(e.rdns[1:], dnKeys(ss.srv.opt.baseDN), ldap.ScopeWholeSubtree) {
+			if _, ok := t.entries[strings.Join(e.rdns[1:], ",")]; !ok {
+				code, msg = ldap.LDAPResultNoSuchObject, "parent does not exist"
+				return
+			}
+		}
+		if len(e.get("objectCategory")) == 0 {
+			e.set("objectCategory", defaultCategory(e.get("objectClass")))
+		}
+		t.stamp(e, true)
+		t.add(e)
+		sent = t.notify(e, e.rdns, psearchAdd)
+	})
+	ss.reply(req, result(ldap.ApplicationAddResponse, code, msg))
+	send(sent)
+}
+
+func (ss *session) modify(req request) {
+	op := req.op
+	if ss.bound == "" {
+		ss.reply(req, result(ldap.ApplicationModifyResponse, ldap.LDAPResultInsufficientAccessRights, "bind required"))
+		return
+	}
+	if len(op.Children) < 2 {
+		ss.reply(req, result(ldap.ApplicationModifyResponse, ldap.LDAPResultProtocolError, "wrong modify request"))
+		return
+	}
+	dn := packetString(op.Children[0])
+	changes := make([]change, 0, len(op.Children[1].Children))
+	for _, c := range op.Children[1].Children {
+		if len(c.Children) < 2 {
+			continue
+		}
+		kind, _ := c.Children[0].Value.(int64)
+		name, vals := partialAttribute(c.Children[1])
+		changes = append(changes, change{op: kind, attr: name, vals: vals})
+	}
+	var (
+		code uint16
+		msg  string
+		sent []notification
+	)
+	ss.srv.dir.do(func(t *tree) {
+		e, ok := t.lookup(dn)
+		if !ok {
+			code, msg = ldap.LDAPResultNoSuchObject, "no such object"
+			return
+		}
+		// changes are applied to a copy, so a failed request leaves the entry untouched
+		cp := newEntry(e.dn, nil)
+		for _, k := range e.names {
+			cp.set(e.attrs[k].name, e.attrs[k].vals)
+		}
+		for _, c := range changes {
+			if reused(e, c) {
+				// AD refuses a password change back to the current password like any other history hit
+				code, msg = ldap.LDAPResultConstraintViolation, adAttrError(0x52d)
+				return
+			}
+			if code, msg = apply(cp, c); code != ldap.LDAPResultSuccess {
+				if ss.srv.opt.activeDirectory() && strings.EqualFold(c.attr, "member") {
+					code, msg = adMemberError(code, msg)
+				}
+				return
+			}
+		}
+		t.stamp(cp, false)
+		t.entries[e.key()] = cp
+		sent = t.notify(cp, cp.rdns, psearchModify)
+	})
+	ss.reply(req, result(ldap.ApplicationModifyResponse, code, msg))
+	send(sent)
+}
+
+func (ss *session) del(req request) {
+	if ss.bound == "" {
+		ss.reply(req, result(ldap.ApplicationDelResponse, ldap.LDAPResultInsufficientAccessRights, "bind required"))
+		return
+	}
+	dn := req.op.Data.String()
+	var (
+		code uint16
+		msg  string
+		sent []notification
+	)
+	ss.srv.dir.do(func(t *tree) {
+		e, ok := t.lookup(dn)
+		if !ok {
+			code, msg = ldap.LDAPResultNoSuchObject, "no such object"
+			return
+		}
+		if len(t.scope(e.rdns, ldap.ScopeSingleLevel)) > 0 {
+			code, msg = ldap.LDAPResultNotAllowedOnNonLeaf, "entry has children"
+			return
+		}
+		if ss.srv.opt.activeDirectory() {
+			if d := t.tombstone(e, ss.srv.opt.baseDN); d != nil {
+				sent = t.notify(d, e.rdns, psearchDelete)
+			}
+			return
+		}
+		sent = t.notify(e, e.rdns, psearchDelete)
+		t.remove(e.key())
+	})
+	ss.reply(req, result(ldap.ApplicationDelResponse, code, msg))
+	send(sent)
+}
+
+// passwordModify implements the RFC 3062 password modify extended operation, an empty identity is the bound user
+func (ss *session) passwordModify(req request) {
+	if ss.bound == "" {
+		ss.reply(req, result(ldap.ApplicationExtendedResponse, ldap.LDAPResultInsufficientAccessRights, "bind required"))
+		return
+	}
+	id, old, pass := ss.bound, "", ""
+	if len(req.op.Children) > 1 {
+		for _, c := range ber.DecodePacket(req.op.Children[1].Data.Bytes()).Children {
+			switch c.Tag {
+			case 0:
+				id = c.Data.String()
+			case 1:
+				old = c.Data.String()
+			case 2:
+				pass = c.Data.String()
+			}
+		}
+	}
+	if pass == "" {
+		ss.reply(req, result(ldap.ApplicationExtendedResponse, ldap.LDAPResultUnwillingToPerform, "password generation is not supported"))
+		return
+	}
+	var (
+		code uint16
+		msg  string
+		sent []notification
+		// policy is the error of the password policy response control, -1 for none
+		policy = -1
+	)
+	ss.srv.dir.do(func(t *tree) {
+		e, ok := t.principal(id)
+		if !ok {
+			code, msg = ldap.LDAPResultNoSuchObject, "no such object"
+			return
+		}
+		cur := e.get(passwordAttr)
+		if old != "" && !containsExact(cur, old) {
+			code, msg = ldap.LDAPResultInvalidCredentials, "old password does not match"
+			return
+		}
+		if containsExact(cur, pass) {
+			code, msg, policy = ldap.LDAPResultConstraintViolation, "Password is in history of old passwords", ppolicyInHistory
+			return
+		}
+		if len(pass) < ppolicyMinLength {
+			code, msg, policy = ldap.LDAPResultConstraintViolation, "Password fails quality checking policy", ppolicyTooShort
+			return
+		}
+		e.set(passwordAttr, []string{pass})
+		t.stamp(e, false)
+		sent = t.notify(e, e.rdns, psearchModify)
+	})
+	var controls []*ber.Packet
+	if policy >= 0 && ldap.FindControl(req.controls, ldap.ControlTypeBeheraPasswordPolicy) != nil {
+		controls = append(controls, ppolicyResponse(policy))
+	}
+	ss.reply(req, result(ldap.ApplicationExtendedResponse, code, msg), controls...)
+	send(sent)
+}
+
+// ppolicyResponse is the password policy response control of draft-behera-ldap-password-policy with error
+func ppolicyResponse(code int) *ber.Packet {
+	seq := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Password Policy Response")
+	seq.AppendChild(ber.NewInteger(ber.ClassContext, ber.TypePrimitive, 1, uint64(code), "Error"))
+	return control(ldap.ControlTypeBeheraPasswordPolicy, seq)
+}
+
+// defaultCategory is the objectCategory AD gives a new object of its classes
+func defaultCategory(classes []string) []string {
+	category := ""
+	for _, c := range classes {
+		switch {
+		case strings.EqualFold(c, "computer"):
+			return []string{"computer"}
+		case strings.EqualFold(c, "user"):
+			category = "person"
+		case strings.EqualFold(c, "group") && category == "":
+			category = "group"
+		}
+	}
+	if category == "" {
+		return nil
+	}
+	return []string{category}
+}
+
+// adMemberError is the answer of AD to adding a member twice or deleting one the group does not have
+func adMemberError(code uint16, msg string) (uint16, string) {
+	switch code {
+	case ldap.LDAPResultAttributeOrValueExists:
+		return ldap.LDAPResultEntryAlreadyExists, "00000562: UpdErr: DSID-031A11C4, problem 6005 (ENTRY_EXISTS), data 0\n"
+	case ldap.LDAPResultNoSuchAttribute:
+		return ldap.LDAPResultUnwillingToPerform, "00000561: SvcErr: DSID-031A1021, problem 5003 (WILL_NOT_PERFORM), data 0\n"
+	}
+	return code, msg
+}
+
+// adAttrError is the diagnostic message AD sends with a unicodePwd refusal of the Win32 error code
+func adAttrError(code int) string {
+	return fmt.Sprintf("%08X: AtrErr: DSID-03191083, #1:\n\t0: %08X: DSID-03191083, problem 1005 (CONSTRAINT_ATT_TYPE), "+
+		"data 0, Att 9005a (unicodePwd)\n", code, code)
+}
+
+func reused(e *entry, c change) bool {
+	if c.op != modAdd || !strings.EqualFold(c.attr, unicodePwdAttr) {
+		return false
+	}
+	cur := e.get(passwordAttr)
+	for _, v := range decodePasswords(c.vals) {
+		if containsExact(cur, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsExact(vals []string, v string) bool {
+	for _, x := range vals {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+func apply(e *entry, c change) (uint16, string) {
+	name, vals := c.attr, c.vals
+	if strings.EqualFold(name, unicodePwdAttr) {
+		name, vals = passwordAttr, decodePasswords(vals)
+	}
+	cur := e.get(name)
+	contains := func(vals []string, v string) bool {
+		for _, x := range vals {
+			if x == v || !strings.EqualFold(name, passwordAttr) && strings.EqualFold(x, v) {
+				return true
+			}
+		}
+		return false
+	}
+	switch c.op {
+	case modAdd:
+		for _, v := range vals {
+			if contains(cur, v) {
+				return ldap.LDAPResultAttributeOrValueExists, "value already exists: " + name
+			}
+			cur = append(cur, v)
+		}
+		e.set(name, cur)
+	case modDelete:
+		if len(cur) == 0 {
+			return ldap.LDAPResultNoSuchAttribute, "no such attribute: " + name
+		}
+		if len(vals) == 0 {
+			e.set(name, nil)
+			break
+		}
+		rest := make([]string, 0, len(cur))
+		for _, v := range cur {
+			if !contains(vals, v) {
+				rest = append(rest, v)
+			}
+		}
+		if len(rest) == len(cur) {
+			if strings.EqualFold(c.attr, unicodePwdAttr) {
+				return ldap.LDAPResultConstraintViolation, adAttrError(0x56)
+			}
+			if strings.EqualFold(name, passwordAttr) {
+				return ldap.LDAPResultConstraintViolation, "old password does not match"
+			}
+			return ldap.LDAPResultNoSuchAttribute, "no such value: " + name
+		}
+		e.set(name, rest)
+	case modReplace:
+		e.set(name, vals)
+	default:
+		return ldap.LDAPResultProtocolError, "unsupported modify operation"
+	}
+	return ldap.LDAPResultSuccess, ""
+}
+
+func (t *tree) remove(key string) {
+	delete(t.entries, key)
+	for i, k := range t.order {
+		if k == key {
+			t.order = append(t.order[:i], t.order[i+1:]...)
+			break
+		}
+	}
+}
+
+func partialAttribute(p *ber.Packet) (name string, vals []string) {
+	if len(p.Children) < 1 {
+		return "", nil
+	}
+	name = packetString(p.Children[0])
+	if len(p.Children) > 1 {
+		for _, v := range p.Children[1].Children {
+			vals = append(vals, packetString(v))
+		}
+	}
+	return
+}
+
+// decodePasswords turns AD unicodePwd values, quoted UTF-16LE strings, into plain passwords
+func decodePasswords(vals []string) []string {
+	res := make([]string, 0, len(vals))
+	for _, v := range vals {
+		b := []byte(v)
+		u := make([]uint16, 0, len(b)/2)
+		for i := 0; i+1 < len(b); i += 2 {
+			u = append(u, binary.LittleEndian.Uint16(b[i:]))
+		}
+		res = append(res, strings.TrimSuffix(strings.TrimPrefix(string(utf16.Decode(u)), `"`), `"`))
+	}
+	return res
+}
@@ -0,0 +1,162 @@
+package ldap
+
+// noinspection GoRedundantImportAlias
+import (
+	"context"
+	"reflect"
+	"strings"
+
+	ldap "github.com/go-ldap/ldap/v3"
+	"github.com/pkg/errors"
+)
+
+// upnAttributes hold user@REALM names: AD userPrincipalName and Kerberos principals of FreeIPA
+var upnAttributes = []string{"userPrincipalName", "krbPrincipalName"}
+
+func (c *Client) GetByGUID(guid GUID) (interface{}, error) {
+	return c.GetByGUIDContext(context.Background(), guid)
+}
+
+// GetByGUIDContext returns the User, Group or Unit with objectGUID (entryUUID, nsUniqueId, ipaUniqueID) guid
+func (c *Client) GetByGUIDContext(ctx context.Context, guid GUID) (interface{}, error) {
+	return c.getByID(ctx, "GUID", string(guid))
+}
+
+func (c *Client) GetBySID(sid SID) (interface{}, error) {
+	return c.GetBySIDContext(context.Background(), sid)
+}
+
+// GetBySIDContext returns the User, Group or Unit with objectSid sid
+func (c *Client) GetBySIDContext(ctx context.Context, sid SID) (interface{}, error) {
+	return c.getByID(ctx, "SID", string(sid))
+}
+
+func (c *Client) GetByDN(dn string) (interface{}, error) {
+	return c.GetByDNContext(context.Background(), dn)
+}
+
+// GetByDNContext reads the entry dn itself and returns it as a Group, Unit or User
+func (c *Client) GetByDNContext(ctx context.Context, dn string) (interface{}, error) {
+	if c.isClosed() {
+		return nil, ErrClosed
+	}
+	s, err := c.schema(ctx)
+	if err != nil {
+		return nil, err
+	}
+	e, err := c.entry(ctx, dn, c.objectAttributes(s)...)
+	if err != nil {
+		return nil, errors.Wrap(err, "ldap get "+dn)
+	}
+	if e == nil {
+		return nil, ErrNotFound
+	}
+	return mapToObject(s, e), nil
+}
+
+func (c *Client) GetByEmail(email string) (User, error) {
+	return c.GetByEmailContext(context.Background(), email)
+}
+
+func (c *Client) GetByEmailContext(ctx context.Context, email string) (User, error) {
+	return c.getUser(ctx, func(s *Schema) []string {
+		return fieldAttributes(reflect.TypeOf(User{}), s.UserFields, "Mail")
+	}, email)
+}
+
+func (c *Client) GetByUPN(upn string) (User, error) {
+	return c.GetByUPNContext(context.Background(), upn)
+}
+
+func (c *Client) GetByUPNContext(ctx context.Context, upn string) (User, error) {
+	return c.getUser(ctx, func(*Schema) []string {
+		return upnAttributes
+	}, upn)
+}
+
+func (c *Client) getUser(ctx context.Context, attrs func(s *Schema) []string, value string) (User, error) {
+	if c.isClosed() {
+		return User{}, ErrClosed
+	}
+	s, err := c.schema(ctx)
+	if err != nil {
+		return User{}, err
+	}
+	fs := make([]Filter, 0, 2)
+	for _, a := range attrs(s) {
+		fs = append(fs, Eq(a, value))
+	}
+	entries, err := c.searchEntries(ctx, And(Eq("objectClass", "organizationalPerson"), Or(fs...)), c.userAttributes(s))
+	if err != nil {
+		return User{}, err
+	}
+	if len(entries) == 0 {
+		return User{}, ErrUserNotFound
+	}
+	return mapToUser(s, entries[0]), nil
+}
+
+// getByID searches users and groups by the attributes the schema binds to field, GUID or SID
+func (c *Client) getByID(ctx context.Context, field, id string) (interface{}, error) {
+	if c.isClosed() {
+		return nil, ErrClosed
+	}
+	s, err := c.schema(ctx)
+	if err != nil {
+		return nil, err
+	}
+	attrs := uniqueAttributes(append(fieldAttributes(reflect.TypeOf(User{}), s.UserFields, field),
+		fieldAttributes(reflect.TypeOf(Group{}), s.GroupFields, field)...))
+	fs := make([]Filter, 0, len(attrs))
+	for _, a := range attrs {
+		v, err := idValue(a, id)
+		if err != nil {
+			return nil, err
+		}
+		fs = append(fs, Eq(a, v))
+	}
+	entries, err := c.searchEntries(ctx, Or(fs...), c.objectAttributes(s))
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, ErrNotFound
+	}
+	return mapToObject(s, entries[0]), nil
+}
+
+// idValue encodes id for a filter on attr: AD keeps objectGUID and objectSid binary, other servers as text
+func idValue(attr, id string) (string, error) {
+	var (
+		b   []byte
+		err error
+	)
+	switch strings.ToLower(attr) {
+	case "objectguid":
+		b, err = GUID(id).Bytes()
+	case "objectsid":
+		b, err = SID(id).Bytes()
+	default:
+		return id, nil
+	}
+	return string(b), err
+}
+
+// objectAttributes are read to map an entry of unknown kind by mapToObject
+func (c *Client) objectAttributes(s *Schema) []string {
+	return uniqueAttributes(append(append([]string{"objectClass"}, c.userAttributes(s)...), c.groupAttributes(s)...))
+}
+
+func mapToObject(s *Schema, e *ldap.Entry) interface{} {
+	if isGroup(e) {
+		return mapToGroup(s, e)
+	}
+	if a := attribute(e, "objectClass"); a != nil {
+		for _, v := range a.Values {
+			if strings.EqualFold(v, "organizationalUnit") {
+				return mapToUnit(s, e)
+			}
+		}
+	}
+	return mapToUser(s, e)
+}
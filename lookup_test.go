@@ -0,0 +1,112 @@
+package ldap
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/shubinmi/ldap/ldaptest"
+)
+
+func TestClient_Lookup(t *testing.T) {
+	guid, _ := hex.DecodeString("ff19966f868b11d0b42d00c04fc964ff")
+	sid, _ := hex.DecodeString("010500000000000515000000a065cf7e784b9b5fe77c8770f4010000")
+	srv := testServer(t, ldaptest.WithLDIF(openLDAPLDIF), ldaptest.WithEntries(
+		ldaptest.Entry{
+			DN: "uid=carol,ou=people,dc=example,dc=org",
+			Attributes: map[string][]string{
+				"objectClass":       {"organizationalPerson", "inetOrgPerson"},
+				"uid":               {"carol"},
+				"cn":                {"Carol"},
+				"mail":              {"carol@example.org"},
+				"userPrincipalName": {"carol@example.org"},
+				"objectGUID":        {string(guid)},
+			},
+		},
+		ldaptest.Entry{
+			DN: "uid=carol,dc=example,dc=org",
+			Attributes: map[string][]string{
+				"objectClass":       {"organizationalPerson", "inetOrgPerson"},
+				"uid":               {"carol"},
+				"cn":                {"Other Carol"},
+				"userPrincipalName": {"carol@other.org"},
+			},
+		},
+		ldaptest.Entry{
+			DN: "cn=staff,dc=example,dc=org",
+			Attributes: map[string][]string{
+				"objectClass": {"group"},
+				"cn":          {"staff"},
+				"objectSid":   {string(sid)},
+			},
+		},
+	))
+	defer srv.Close()
+	c := testClient(t, srv, WithBaseDN("dc=example,dc=org"), WithAdmin("admin", "adminPass"), WithSchema(SchemaActiveDirectory))
+	defer c.Close()
+	const carol = "uid=carol,ou=people,dc=example,dc=org"
+	tests := []struct {
+		name    string
+		get     func() (interface{}, error)
+		wantDN  string
+		wantErr error
+	}{
+		{name: "guid", get: func() (interface{}, error) {
+			return c.GetByGUID("6F9619FF-8B86-D011-B42D-00C04FC964FF")
+		}, wantDN: carol},
+		{name: "missing guid", get: func() (interface{}, error) {
+			return c.GetByGUID("00000000-8b86-d011-b42d-00c04fc964ff")
+		}, wantErr: ErrNotFound},
+		{name: "sid", get: func() (interface{}, error) {
+			return c.GetBySID("S-1-5-21-2127521184-1604012920-1887927527-500")
+		}, wantDN: "cn=staff,dc=example,dc=org"},
+		{name: "dn", get: func() (interface{}, error) {
+			return c.GetByDN("ou=people,dc=example,dc=org")
+		}, wantDN: "ou=people,dc=example,dc=org"},
+		{name: "missing dn", get: func() (interface{}, error) {
+			return c.GetByDN("ou=nobody,dc=example,dc=org")
+		}, wantErr: ErrNotFound},
+		{name: "email", get: func() (interface{}, error) {
+			return c.GetByEmail("carol@example.org")
+		}, wantDN: carol},
+		{name: "upn", get: func() (interface{}, error) {
+			return c.GetByUPN("carol@other.org")
+		}, wantDN: "uid=carol,dc=example,dc=org"},
+		{name: "missing upn", get: func() (interface{}, error) {
+			return c.GetByUPN("dave@example.org")
+		}, wantErr: ErrUserNotFound},
+		{name: "logon upn", get: func() (interface{}, error) {
+			return c.SearchByLogon("carol@other.org")
+		}, wantDN: "uid=carol,dc=example,dc=org"},
+	}
+	for _, test := range tests {
+		tt := test
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.get()
+			if err != tt.wantErr {
+				t.Fatalf("get error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			var dn string
+			switch v := got.(type) {
+			case User:
+				dn = v.DN
+			case Group:
+				dn = v.DN
+			case Unit:
+				dn = v.DN
+			}
+			if dn != tt.wantDN {
+				t.Errorf("get got = %+v, want DN %v", got, tt.wantDN)
+			}
+		})
+	}
+	if u, err := c.GetByGUID("6f9619ff-8b86-d011-b42d-00c04fc964ff"); err != nil ||
+		u.(User).GUID != "6f9619ff-8b86-d011-b42d-00c04fc964ff" {
+		t.Errorf("GetByGUID() got = %+v, err %v", u, err)
+	}
+	if _, err := c.GetByGUID("not a guid"); err == nil {
+		t.Error("GetByGUID() expected error for a wrong GUID")
+	}
+}
@@ -2,85 +2,49 @@ package ldap
 
 // noinspection GoRedundantImportAlias
 import (
-	"encoding/json"
+	"log"
+	"reflect"
+	"strings"
+	"time"
 
 	ldap "github.com/go-ldap/ldap/v3"
-	"github.com/shubinmi/util/exec"
 )
 
-func mapToGroup(ent *ldap.Entry) (g Group) {
-	fs := make([]func() bool, 0, 10)
-	for _, v := range [4]string{"name", "sAMAccountName", "userPrincipalName", "cn"} {
-		pr := v
-		fs = append(fs, func() bool {
-			g.Name = ent.GetAttributeValue(pr)
-			return g.Name != ""
-		})
+func mapToGroup(s *Schema, ent *ldap.Entry) (g Group) {
+	if err := unmarshal(ent, &g, s.GroupFields); err != nil {
+		log.Println("ldap map group", err)
 	}
-	exec.UntilSuccess(fs...)
-	g.DN = ent.DN
-	g.CN = ent.GetAttributeValue("cn")
-	g.Desc = ent.GetAttributeValue("description")
-	g.Member = ent.GetAttributeValue("member")
 	return
 }
 
-func mapToUnit(ent *ldap.Entry) (u Unit) {
-	fs := make([]func() bool, 0, 10)
-	for _, v := range [4]string{"ou", "name"} {
-		pr := v
-		fs = append(fs, func() bool {
-			u.Name = ent.GetAttributeValue(pr)
-			return u.Name != ""
-		})
+func mapToUnit(s *Schema, ent *ldap.Entry) (u Unit) {
+	if err := unmarshal(ent, &u, s.UnitFields); err != nil {
+		log.Println("ldap map unit", err)
 	}
-	exec.UntilSuccess(fs...)
-	u.DN = ent.DN
 	return
 }
 
-func mapToUser(ent *ldap.Entry) (u User) {
-	fs := make([]func() bool, 0, 5)
-	for _, v := range [5]string{"name", "displayName", "cn", "sAMAccountName", "userPrincipalName"} {
-		pr := v
-		fs = append(fs, func() bool {
-			u.Name = ent.GetAttributeValue(pr)
-			return u.Name != ""
-		})
+func mapToUser(s *Schema, ent *ldap.Entry) (u User) {
+	if err := unmarshal(ent, &u, s.UserFields); err != nil {
+		log.Println("ldap map user", err)
 	}
-	exec.UntilSuccess(fs...)
-	fs = fs[:0]
-	for _, v := range [2]string{"sAMAccountName", "userPrincipalName"} {
-		pr := v
-		fs = append(fs, func() bool {
-			u.Logon = ent.GetAttributeValue(pr)
-			return u.Logon != ""
-		})
+	u.MemberOf = []string{}
+	if a := attribute(ent, s.MemberOfAttr); a != nil && s.MemberOfAttr != "" {
+		u.MemberOf = a.Values
 	}
-	exec.UntilSuccess(fs...)
-	fs = fs[:0]
-	for _, v := range [3]string{"telephoneNumber", "mobile", "phone"} {
-		pr := v
-		fs = append(fs, func() bool {
-			u.Phone = ent.GetAttributeValue(pr)
-			return u.Phone != ""
-		})
+	u.Status = DecodeAccountStatus(ent, time.Now())
+	bound := map[string]bool{strings.ToLower(s.MemberOfAttr): true}
+	for _, a := range tagAttributes(reflect.TypeOf(u), s.UserFields) {
+		bound[strings.ToLower(a)] = true
 	}
-	exec.UntilSuccess(fs...)
-	fs = fs[:0]
-	for _, v := range [2]string{"mail", "email"} {
-		pr := v
-		fs = append(fs, func() bool {
-			u.Mail = ent.GetAttributeValue(pr)
-			return u.Mail != ""
-		})
-	}
-	exec.UntilSuccess(fs...)
-	u.DN = ent.DN
-	u.CN = ent.GetAttributeValue("cn")
-	bt, err := json.Marshal(ent.GetAttributeValues("memberOf"))
-	if err == nil {
-		u.MemberOf = string(bt)
+	for _, a := range ent.Attributes {
+		if bound[strings.ToLower(a.Name)] {
+			continue
+		}
+		if u.Attributes == nil {
+			u.Attributes = make(map[string][]string)
+		}
+		u.Attributes[a.Name] = a.Values
 	}
 	return
 }
@@ -0,0 +1,261 @@
+package ldap
+
+// noinspection GoRedundantImportAlias
+import (
+	"context"
+	"strings"
+
+	ldap "github.com/go-ldap/ldap/v3"
+	"github.com/pkg/errors"
+	"github.com/shubinmi/util/errs"
+)
+
+type MembershipMode int
+
+const (
+	// Direct takes only groups the entry is listed in
+	Direct MembershipMode = iota
+	// Transitive follows nested groups: AD resolves it with LDAP_MATCHING_RULE_IN_CHAIN,
+	// other servers are walked breadth-first by the client
+	Transitive
+)
+
+const (
+	ruleInChain = "1.2.840.113556.1.4.1941"
+	// memberBatch is how many DNs one search of members or of the groups listing them asks about
+	memberBatch = 100
+)
+
+var groupClasses = [3]string{"group", "groupOfNames", "groupOfUniqueNames"}
+
+func membership(mode []MembershipMode) MembershipMode {
+	if len(mode) == 0 {
+		return Direct
+	}
+	return mode[0]
+}
+
+func (c *Client) UserGroups(dn string, mode ...MembershipMode) ([]Group, error) {
+	return c.UserGroupsContext(context.Background(), dn, mode...)
+}
+
+func (c *Client) UserGroupsContext(ctx context.Context, dn string, mode ...MembershipMode) ([]Group, error) {
+	if c.isClosed() {
+		return nil, ErrClosed
+	}
+	s, err := c.schema(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var entries []*ldap.Entry
+	if membership(mode) == Transitive {
+		dse, err := c.rootDSE(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if dse.activeDirectory {
+			entries, err = c.searchEntries(ctx, And(s.Groups, ExtensibleMatch(memberAttr, ruleInChain, dn, false)), c.groupAttributes(s))
+		} else {
+			entries, err = c.nestedGroups(ctx, s, dn, c.groupAttributes(s))
+		}
+		if err != nil {
+			return nil, err
+		}
+	} else if entries, err = c.searchEntries(ctx, And(s.Groups, s.memberFilter(dn)), c.groupAttributes(s)); err != nil {
+		return nil, err
+	}
+	groups := make([]Group, 0, len(entries))
+	for _, e := range entries {
+		groups = append(groups, mapToGroup(s, e))
+	}
+	return groups, nil
+}
+
+// members reads the member list of groupDN and returns every non-group member once,
+// transitive walks the lists of nested groups down breadth-first
+func (c *Client) members(ctx context.Context, s *Schema, groupDN string, transitive bool) ([]*ldap.Entry, error) {
+	seen := map[string]bool{normalizeDN(groupDN): true}
+	queue := []string{groupDN}
+	var users []*ldap.Entry
+	attrs := append([]string{"objectClass"}, c.userAttributes(s)...)
+	for len(queue) > 0 {
+		dn := queue[0]
+		queue = queue[1:]
+		g, err := c.entry(ctx, dn, s.MemberAttrs...)
+		if err != nil {
+			return nil, errors.Wrap(err, "ldap members of "+dn)
+		}
+		if g == nil {
+			continue
+		}
+		var members []string
+		for _, a := range s.MemberAttrs {
+			if v := attribute(g, a); v != nil {
+				for _, m := range v.Values {
+					if k := normalizeDN(m); !seen[k] {
+						seen[k] = true
+						members = append(members, m)
+					}
+				}
+			}
+		}
+		entries, err := c.entriesByDN(ctx, s, members, attrs)
+		if err != nil {
+			return nil, errors.Wrap(err, "ldap members of "+dn)
+		}
+		for _, m := range members {
+			e, ok := entries[normalizeDN(m)]
+			if !ok {
+				continue
+			}
+			if isGroup(e) {
+				if transitive {
+					queue = append(queue, m)
+				}
+				continue
+			}
+			users = append(users, e)
+		}
+	}
+	return users, nil
+}
+
+// entriesByDN reads the entries of dns by normalized DN, missing ones are left out. The schema DNAttr
+// finds them with one search per memberBatch, without it each one is read on its own.
+func (c *Client) entriesByDN(ctx context.Context, s *Schema, dns []string, attrs []string) (map[string]*ldap.Entry, error) {
+	res := make(map[string]*ldap.Entry, len(dns))
+	if s.DNAttr == "" {
+		for _, dn := range dns {
+			e, err := c.entry(ctx, dn, attrs...)
+			if err != nil {
+				return nil, err
+			}
+			if e != nil {
+				res[normalizeDN(dn)] = e
+			}
+		}
+		return res, nil
+	}
+	for len(dns) > 0 {
+		n := minInt(len(dns), memberBatch)
+		fs := make([]Filter, 0, n)
+		for _, dn := range dns[:n] {
+			fs = append(fs, Eq(s.DNAttr, dn))
+		}
+		dns = dns[n:]
+		entries, err := c.searchEntries(ctx, Or(fs...), attrs)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			res[normalizeDN(e.DN)] = e
+		}
+	}
+	return res, nil
+}
+
+// nestedGroups walks up from dn through the groups listing it and returns each group once,
+// the groups of one level are asked about memberBatch at a time
+func (c *Client) nestedGroups(ctx context.Context, s *Schema, dn string, attrs []string) ([]*ldap.Entry, error) {
+	seen := map[string]bool{normalizeDN(dn): true}
+	level := []string{dn}
+	var groups []*ldap.Entry
+	for len(level) > 0 {
+		n := minInt(len(level), memberBatch)
+		fs := make([]Filter, 0, n)
+		for _, cur := range level[:n] {
+			fs = append(fs, s.memberFilter(cur))
+		}
+		level = level[n:]
+		entries, err := c.searchEntries(ctx, And(s.Groups, Or(fs...)), attrs)
+		if err != nil {
+			return nil, errors.Wrap(err, "ldap nested groups of "+dn)
+		}
+		for _, e := range entries {
+			k := normalizeDN(e.DN)
+			if seen[k] {
+				continue
+			}
+			seen[k] = true
+			groups = append(groups, e)
+			level = append(level, e.DN)
+		}
+	}
+	return groups, nil
+}
+
+// searchEntries pages through the search, AD refuses more entries than its MaxPageSize to an unpaged one
+func (c *Client) searchEntries(ctx context.Context, f Filter, attrs []string) ([]*ldap.Entry, error) {
+	entries, _, _, err := c.limitedSearch(ctx, c.searchRequest(f.String(), attrs), 0)
+	if err != nil {
+		return nil, errors.Wrap(err, "ldap search")
+	}
+	return entries, nil
+}
+
+// entry reads one entry by DN, a missing entry is not an error
+func (c *Client) entry(ctx context.Context, dn string, attrs ...string) (*ldap.Entry, error) {
+	sr, err := c.search(ctx, ldap.NewSearchRequest(dn, ldap.ScopeBaseObject, ldap.NeverDerefAliases,
+		0, 0, false, Present("objectClass").String(), attrs, nil))
+	if hasCode(err, ldap.LDAPResultNoSuchObject) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(sr.Entries) == 0 {
+		return nil, nil
+	}
+	return sr.Entries[0], nil
+}
+
+func entriesRetriever(entries []*ldap.Entry, pageSize uint32,
+	mapper func(entry *ldap.Entry) interface{}) func() (interface{}, error) {
+	if pageSize == 0 {
+		pageSize = uint32(len(entries))
+	}
+	return func() (interface{}, error) {
+		n := int(pageSize)
+		if n > len(entries) {
+			n = len(entries)
+		}
+		items := make([]interface{}, 0, n)
+		for _, e := range entries[:n] {
+			items = append(items, scanItem{value: mapper(e), entry: e})
+		}
+		entries = entries[n:]
+		if len(entries) == 0 {
+			return items, errs.NothingToDo{}
+		}
+		return items, nil
+	}
+}
+
+func isGroup(e *ldap.Entry) bool {
+	if a := attribute(e, "objectClass"); a != nil {
+		for _, v := range a.Values {
+			for _, g := range groupClasses {
+				if strings.EqualFold(v, g) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func normalizeDN(dn string) string {
+	parsed, err := ldap.ParseDN(dn)
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(dn))
+	}
+	rdns := make([]string, 0, len(parsed.RDNs))
+	for _, rdn := range parsed.RDNs {
+		parts := make([]string, 0, len(rdn.Attributes))
+		for _, a := range rdn.Attributes {
+			parts = append(parts, strings.ToLower(a.Type)+"="+strings.ToLower(a.Value))
+		}
+		rdns = append(rdns, strings.Join(parts, "+"))
+	}
+	return strings.Join(rdns, ",")
+}
@@ -0,0 +1,140 @@
+package ldap
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/shubinmi/ldap/ldaptest"
+)
+
+const nestedLDIF = `dn: dc=nested,dc=test
+objectClass: domain
+dc: nested
+
+dn: cn=admin,dc=nested,dc=test
+objectClass: inetOrgPerson
+cn: admin
+uid: admin
+userPassword: adminPass
+
+dn: cn=alice,dc=nested,dc=test
+objectClass: inetOrgPerson
+objectClass: user
+objectCategory: person
+cn: alice
+uid: alice
+
+dn: cn=bob,dc=nested,dc=test
+objectClass: inetOrgPerson
+objectClass: user
+objectCategory: person
+cn: bob
+uid: bob
+
+dn: cn=carol,dc=nested,dc=test
+objectClass: inetOrgPerson
+objectClass: user
+objectCategory: person
+cn: carol
+uid: carol
+
+dn: cn=all,dc=nested,dc=test
+objectClass: groupOfNames
+cn: all
+member: cn=alice,dc=nested,dc=test
+member: cn=dev,dc=nested,dc=test
+
+dn: cn=dev,dc=nested,dc=test
+objectClass: groupOfNames
+cn: dev
+member: cn=bob,dc=nested,dc=test
+member: cn=backend,dc=nested,dc=test
+
+dn: cn=backend,dc=nested,dc=test
+objectClass: groupOfNames
+cn: backend
+member: cn=carol,dc=nested,dc=test
+member: cn=all,dc=nested,dc=test
+`
+
+func TestClient_Membership(t *testing.T) {
+	ad := map[string][]string{"supportedCapabilities": {capActiveDirectory}}
+	noDN := SchemaOpenLDAP
+	noDN.DNAttr = ""
+	tests := []struct {
+		name   string
+		dse    map[string][]string
+		schema *Schema
+		// pageSize is the server limit, searches of more entries have to be paged
+		pageSize int
+	}{
+		{name: "client side"},
+		{name: "active directory", dse: ad},
+		{name: "active directory paged", dse: ad, pageSize: 1},
+		{name: "member lists by entryDN", schema: &SchemaOpenLDAP, pageSize: 1},
+		{name: "member lists one by one", schema: &noDN},
+	}
+	for _, test := range tests {
+		tt := test
+		t.Run(tt.name, func(t *testing.T) {
+			fs := []ldaptest.Option{ldaptest.WithLDIF(nestedLDIF), ldaptest.WithRootDSE(tt.dse)}
+			if tt.pageSize > 0 {
+				fs = append(fs, ldaptest.WithMaxPageSize(tt.pageSize))
+			}
+			srv := testServer(t, fs...)
+			defer srv.Close()
+			opts := []optF{WithAdmin("admin", "adminPass")}
+			if tt.schema != nil {
+				opts = append(opts, WithSchema(*tt.schema))
+			}
+			c := testClient(t, srv, opts...)
+			defer c.Close()
+
+			users := func(mode ...MembershipMode) []string {
+				sc, err := c.GroupUsers("CN=All,DC=nested,DC=test", 2, mode...)
+				if err != nil {
+					t.Fatalf("GroupUsers() unexpected error = %v", err)
+				}
+				var us []User
+				for sc.Next() {
+					sc.Scan(UsersSetter(&us))
+				}
+				if sc.LastErr() != nil {
+					t.Fatalf("GroupUsers() scan error = %v", sc.LastErr())
+				}
+				names := make([]string, 0, len(us))
+				for _, u := range us {
+					names = append(names, u.Name)
+				}
+				sort.Strings(names)
+				return names
+			}
+			if got, want := users(), []string{"alice"}; !reflect.DeepEqual(got, want) {
+				t.Errorf("GroupUsers(Direct) got = %v, want %v", got, want)
+			}
+			if got, want := users(Transitive), []string{"alice", "bob", "carol"}; !reflect.DeepEqual(got, want) {
+				t.Errorf("GroupUsers(Transitive) got = %v, want %v", got, want)
+			}
+
+			groups := func(mode ...MembershipMode) []string {
+				gs, err := c.UserGroups("cn=carol,dc=nested,dc=test", mode...)
+				if err != nil {
+					t.Fatalf("UserGroups() unexpected error = %v", err)
+				}
+				names := make([]string, 0, len(gs))
+				for _, g := range gs {
+					names = append(names, g.Name)
+				}
+				sort.Strings(names)
+				return names
+			}
+			if got, want := groups(Direct), []string{"backend"}; !reflect.DeepEqual(got, want) {
+				t.Errorf("UserGroups(Direct) got = %v, want %v", got, want)
+			}
+			if got, want := groups(Transitive), []string{"all", "backend", "dev"}; !reflect.DeepEqual(got, want) {
+				t.Errorf("UserGroups(Transitive) got = %v, want %v", got, want)
+			}
+		})
+	}
+}
@@ -1,24 +1,49 @@
 package ldap
 
+import "time"
+
 type Group struct {
-	Name   string
-	Desc   string
-	DN     string
-	CN     string
-	Member string
+	Name   string `ldap:"name,sAMAccountName,userPrincipalName,cn"`
+	Desc   string `ldap:"description"`
+	DN     string `ldap:"dn"`
+	CN     string `ldap:"cn"`
+	Member string `ldap:"member"`
+	GUID   GUID   `ldap:"objectGUID"`
+	SID    SID    `ldap:"objectSid"`
 }
 
 type Unit struct {
-	Name string
-	DN   string
+	Name string `ldap:"ou,name"`
+	DN   string `ldap:"dn"`
 }
 
 type User struct {
-	Name     string
-	DN       string
-	CN       string
-	Mail     string
-	Phone    string
-	Logon    string
-	MemberOf string
+	Name  string `ldap:"name,displayName,cn,sAMAccountName,userPrincipalName"`
+	DN    string `ldap:"dn"`
+	CN    string `ldap:"cn"`
+	Mail  string `ldap:"mail,email"`
+	Phone string `ldap:"telephoneNumber,mobile,phone"`
+	Logon string `ldap:"sAMAccountName,userPrincipalName"`
+	// GUID and SID are stable across renames and moves, unlike DN
+	GUID       GUID   `ldap:"objectGUID"`
+	SID        SID    `ldap:"objectSid"`
+	Title      string `ldap:"title"`
+	Department string `ldap:"department,departmentNumber"`
+	Company    string `ldap:"company,o"`
+	// Manager is the DN of the manager entry
+	Manager    string `ldap:"manager"`
+	EmployeeID string `ldap:"employeeID,employeeNumber"`
+	GivenName  string `ldap:"givenName"`
+	Surname    string `ldap:"sn"`
+	// times are UTC, zero when the server does not keep them
+	WhenCreated time.Time `ldap:"whenCreated,createTimestamp"`
+	WhenChanged time.Time `ldap:"whenChanged,modifyTimestamp"`
+	// LastLogon is replicated by AD with a lag of up to two weeks
+	LastLogon time.Time `ldap:"lastLogonTimestamp,lastLogon,authTimestamp"`
+	// MemberOf lists the DNs of the groups the user is a direct member of
+	MemberOf []string `ldap:"-"`
+	// Status is decoded from the account control attributes by DecodeAccountStatus
+	Status AccountStatus `ldap:"-"`
+	// Attributes holds the values read for the user that no field is bound to, like those of WithExtraAttributes
+	Attributes map[string][]string `ldap:"-"`
 }
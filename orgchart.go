@@ -0,0 +1,178 @@
+package ldap
+
+// noinspection GoRedundantImportAlias
+import (
+	"context"
+
+	"github.com/pkg/errors"
+)
+
+// managerBatch is how many managers one search for their reports asks about
+const managerBatch = 100
+
+var ErrNoManager = errors.New("ldap user has no manager")
+
+// OrgNode is a user with the tree of people reporting to them
+type OrgNode struct {
+	User    User
+	Reports []OrgNode
+}
+
+func (c *Client) Manager(userDN string) (User, error) {
+	return c.ManagerContext(context.Background(), userDN)
+}
+
+// ManagerContext returns the manager of userDN, ErrNoManager when the user has none
+func (c *Client) ManagerContext(ctx context.Context, userDN string) (User, error) {
+	if c.isClosed() {
+		return User{}, ErrClosed
+	}
+	s, err := c.schema(ctx)
+	if err != nil {
+		return User{}, err
+	}
+	return c.manager(ctx, s, userDN)
+}
+
+func (c *Client) DirectReports(userDN string) ([]User, error) {
+	return c.DirectReportsContext(context.Background(), userDN)
+}
+
+// DirectReportsContext returns the users whose manager is userDN
+func (c *Client) DirectReportsContext(ctx context.Context, userDN string) ([]User, error) {
+	if c.isClosed() {
+		return nil, ErrClosed
+	}
+	s, err := c.schema(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return c.reports(ctx, s, []string{userDN})
+}
+
+func (c *Client) ReportingChain(userDN string) ([]User, error) {
+	return c.ReportingChainContext(context.Background(), userDN)
+}
+
+// ReportingChainContext returns the manager of userDN, their manager and so on up to the top,
+// a manager met twice ends the chain
+func (c *Client) ReportingChainContext(ctx context.Context, userDN string) ([]User, error) {
+	if c.isClosed() {
+		return nil, ErrClosed
+	}
+	s, err := c.schema(ctx)
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{normalizeDN(userDN): true}
+	var chain []User
+	for dn := userDN; ; {
+		m, err := c.manager(ctx, s, dn)
+		if err == ErrNoManager {
+			return chain, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if seen[normalizeDN(m.DN)] {
+			return chain, nil
+		}
+		seen[normalizeDN(m.DN)] = true
+		chain = append(chain, m)
+		dn = m.DN
+	}
+}
+
+func (c *Client) Subordinates(userDN string, depth int) ([]OrgNode, error) {
+	return c.SubordinatesContext(context.Background(), userDN, depth)
+}
+
+// SubordinatesContext returns the reports of userDN and theirs down to depth levels, depth 0 is no limit.
+// Every user appears in the tree once, so management cycles do not loop.
+func (c *Client) SubordinatesContext(ctx context.Context, userDN string, depth int) ([]OrgNode, error) {
+	if c.isClosed() {
+		return nil, ErrClosed
+	}
+	s, err := c.schema(ctx)
+	if err != nil {
+		return nil, err
+	}
+	root := &OrgNode{User: User{DN: userDN}}
+	seen := map[string]bool{normalizeDN(userDN): true}
+	level := []*OrgNode{root}
+	for d := 0; len(level) > 0 && (depth <= 0 || d < depth); d++ {
+		byDN := make(map[string]*OrgNode, len(level))
+		dns := make([]string, 0, len(level))
+		for _, n := range level {
+			byDN[normalizeDN(n.User.DN)] = n
+			dns = append(dns, n.User.DN)
+		}
+		users, err := c.reports(ctx, s, dns)
+		if err != nil {
+			return nil, err
+		}
+		for _, u := range users {
+			k := normalizeDN(u.DN)
+			m := byDN[normalizeDN(u.Manager)]
+			if seen[k] || m == nil {
+				continue
+			}
+			seen[k] = true
+			m.Reports = append(m.Reports, OrgNode{User: u})
+		}
+		// the children are addressed after the appends above, which may move them
+		next := make([]*OrgNode, 0, len(users))
+		for _, n := range level {
+			for i := range n.Reports {
+				next = append(next, &n.Reports[i])
+			}
+		}
+		level = next
+	}
+	return root.Reports, nil
+}
+
+func (c *Client) manager(ctx context.Context, s *Schema, userDN string) (User, error) {
+	e, err := c.entry(ctx, userDN, "manager")
+	if err != nil {
+		return User{}, errors.Wrap(err, "ldap manager of "+userDN)
+	}
+	if e == nil {
+		return User{}, ErrUserNotFound
+	}
+	a := attribute(e, "manager")
+	if a == nil || len(a.Values) == 0 {
+		return User{}, ErrNoManager
+	}
+	m, err := c.entry(ctx, a.Values[0], c.userAttributes(s)...)
+	if err != nil {
+		return User{}, errors.Wrap(err, "ldap manager of "+userDN)
+	}
+	if m == nil {
+		// the manager was deleted and the link is left dangling
+		return User{}, ErrNoManager
+	}
+	return mapToUser(s, m), nil
+}
+
+// reports searches the users managed by any of managerDNs, paged as a batch may have more than a page of them
+func (c *Client) reports(ctx context.Context, s *Schema, managerDNs []string) ([]User, error) {
+	var users []User
+	for len(managerDNs) > 0 {
+		n := minInt(len(managerDNs), managerBatch)
+		fs := make([]Filter, 0, n)
+		for _, dn := range managerDNs[:n] {
+			fs = append(fs, Eq("manager", dn))
+		}
+		managerDNs = managerDNs[n:]
+		f := And(Eq("objectClass", "organizationalPerson"), Or(fs...))
+		entries, _, _, err := c.limitedSearch(ctx, c.searchRequest(f.String(), c.userAttributes(s)), 0)
+		if err != nil {
+			return nil, errors.Wrap(err, "ldap direct reports")
+		}
+		for _, e := range entries {
+			users = append(users, mapToUser(s, e))
+		}
+	}
+	return users, nil
+}
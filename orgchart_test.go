@@ -0,0 +1,135 @@
+package ldap
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/shubinmi/ldap/ldaptest"
+)
+
+const orgLDIF = openLDAPLDIF + `
+dn: uid=ceo,ou=people,dc=example,dc=org
+objectClass: organizationalPerson
+objectClass: inetOrgPerson
+uid: ceo
+cn: ceo
+
+dn: uid=cto,ou=people,dc=example,dc=org
+objectClass: organizationalPerson
+objectClass: inetOrgPerson
+uid: cto
+cn: cto
+manager: uid=ceo,ou=people,dc=example,dc=org
+
+dn: uid=cfo,ou=people,dc=example,dc=org
+objectClass: organizationalPerson
+objectClass: inetOrgPerson
+uid: cfo
+cn: cfo
+manager: UID=CEO,OU=People,DC=example,DC=org
+
+dn: uid=dev,ou=people,dc=example,dc=org
+objectClass: organizationalPerson
+objectClass: inetOrgPerson
+uid: dev
+cn: dev
+manager: uid=cto,ou=people,dc=example,dc=org
+
+dn: uid=x,ou=people,dc=example,dc=org
+objectClass: organizationalPerson
+objectClass: inetOrgPerson
+uid: x
+cn: x
+manager: uid=y,ou=people,dc=example,dc=org
+
+dn: uid=y,ou=people,dc=example,dc=org
+objectClass: organizationalPerson
+objectClass: inetOrgPerson
+uid: y
+cn: y
+manager: uid=x,ou=people,dc=example,dc=org
+
+dn: uid=orphan,ou=people,dc=example,dc=org
+objectClass: organizationalPerson
+objectClass: inetOrgPerson
+uid: orphan
+cn: orphan
+manager: uid=gone,ou=people,dc=example,dc=org
+`
+
+func TestClient_OrgChart(t *testing.T) {
+	srv := testServer(t, ldaptest.WithLDIF(orgLDIF))
+	defer srv.Close()
+	c := testClient(t, srv, WithBaseDN("dc=example,dc=org"), WithAdmin("admin", "adminPass"), WithSchema(SchemaOpenLDAP))
+	defer c.Close()
+	dn := func(uid string) string {
+		return "uid=" + uid + ",ou=people,dc=example,dc=org"
+	}
+	cns := func(us []User) []string {
+		res := make([]string, 0, len(us))
+		for _, u := range us {
+			res = append(res, u.CN)
+		}
+		return res
+	}
+
+	tests := []struct {
+		name    string
+		user    string
+		manager string
+		wantErr error
+		reports []string
+		chain   []string
+	}{
+		{name: "top", user: "ceo", wantErr: ErrNoManager, reports: []string{"cto", "cfo"}, chain: []string{}},
+		{name: "middle", user: "cto", manager: "ceo", reports: []string{"dev"}, chain: []string{"ceo"}},
+		{name: "bottom", user: "dev", manager: "cto", reports: []string{}, chain: []string{"cto", "ceo"}},
+		{name: "cycle", user: "x", manager: "y", reports: []string{"y"}, chain: []string{"y"}},
+		{name: "dangling", user: "orphan", wantErr: ErrNoManager, reports: []string{}, chain: []string{}},
+		{name: "missing", user: "nobody", wantErr: ErrUserNotFound, reports: []string{}},
+	}
+	for _, test := range tests {
+		tt := test
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := c.Manager(dn(tt.user))
+			if err != tt.wantErr || m.CN != tt.manager {
+				t.Errorf("Manager() got = %v, err %v, want %v, %v", m.CN, err, tt.manager, tt.wantErr)
+			}
+			rs, err := c.DirectReports(dn(tt.user))
+			if got := cns(rs); err != nil || !reflect.DeepEqual(got, tt.reports) {
+				t.Errorf("DirectReports() got = %v, err %v, want %v", got, err, tt.reports)
+			}
+			if tt.chain == nil {
+				return
+			}
+			chain, err := c.ReportingChain(dn(tt.user))
+			if got := cns(chain); err != nil || !reflect.DeepEqual(got, tt.chain) {
+				t.Errorf("ReportingChain() got = %v, err %v, want %v", got, err, tt.chain)
+			}
+		})
+	}
+
+	tree, err := c.Subordinates(dn("ceo"), 0)
+	if err != nil {
+		t.Fatalf("Subordinates() unexpected error = %v", err)
+	}
+	if len(tree) != 2 || tree[0].User.CN != "cto" || len(tree[0].Reports) != 1 || tree[0].Reports[0].User.CN != "dev" ||
+		tree[1].User.CN != "cfo" || len(tree[1].Reports) != 0 {
+		t.Errorf("Subordinates() got = %+v", tree)
+	}
+	if tree, err = c.Subordinates(dn("ceo"), 1); err != nil || len(tree) != 2 || len(tree[0].Reports) != 0 {
+		t.Errorf("Subordinates() depth 1 got = %+v, err %v", tree, err)
+	}
+	if tree, err = c.Subordinates(dn("x"), 0); err != nil || len(tree) != 1 || len(tree[0].Reports) != 0 {
+		t.Errorf("Subordinates() of a cycle got = %+v, err %v", tree, err)
+	}
+
+	// more reports than a page, like over a thousand on AD
+	small := testServer(t, ldaptest.WithLDIF(orgLDIF), ldaptest.WithMaxPageSize(1))
+	defer small.Close()
+	sc := testClient(t, small, WithBaseDN("dc=example,dc=org"), WithAdmin("admin", "adminPass"), WithSchema(SchemaOpenLDAP))
+	defer sc.Close()
+	if rs, err := sc.DirectReports(dn("ceo")); err != nil || !reflect.DeepEqual(cns(rs), []string{"cto", "cfo"}) {
+		t.Errorf("DirectReports() over a page got = %v, err %v", cns(rs), err)
+	}
+}
@@ -0,0 +1,102 @@
+package ldap
+
+// noinspection GoRedundantImportAlias
+import (
+	"context"
+	"strings"
+
+	ldap "github.com/go-ldap/ldap/v3"
+	"github.com/pkg/errors"
+	"github.com/shubinmi/util/errs"
+)
+
+// resolveOUs turns OU names and DNs into search bases, dropping bases already covered by a subtree search
+func (c *Client) resolveOUs(ctx context.Context, s *Schema, scope Scope, ous []string) ([]string, error) {
+	bases := make([]string, 0, len(ous))
+	keys := make([]string, 0, len(ous))
+	add := func(dn string) {
+		k := normalizeDN(dn)
+		for _, known := range keys {
+			if known == k {
+				return
+			}
+		}
+		bases, keys = append(bases, dn), append(keys, k)
+	}
+	for _, ou := range ous {
+		ou = strings.TrimSpace(ou)
+		if ou == "" {
+			continue
+		}
+		if isDN(ou) {
+			add(ou)
+			continue
+		}
+		entries, err := c.searchEntries(ctx, And(
+			Or(Eq("objectClass", "organizationalUnit"), s.Units),
+			Eq("ou", ou),
+		), []string{NoAttributes})
+		if err != nil {
+			return nil, errors.Wrap(err, "ldap resolve organizational unit "+ou)
+		}
+		if len(entries) == 0 {
+			return nil, errors.Errorf("organizational unit %s not found", ou)
+		}
+		for _, e := range entries {
+			add(e.DN)
+		}
+	}
+	if scope.ldapScope() != ldap.ScopeWholeSubtree {
+		return bases, nil
+	}
+	res := make([]string, 0, len(bases))
+	for i, b := range bases {
+		covered := false
+		for j, parent := range keys {
+			if i != j && strings.HasSuffix(keys[i], ","+parent) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			res = append(res, b)
+		}
+	}
+	return res, nil
+}
+
+// chainRetriever reads retrievers one after another and regroups their results into pages of pageSize
+func chainRetriever(pageSize uint32, fs ...func() (interface{}, error)) func() (interface{}, error) {
+	var rest []interface{}
+	return func() (interface{}, error) {
+		items := rest
+		rest = nil
+		for len(fs) > 0 && (pageSize == 0 || len(items) < int(pageSize)) {
+			res, err := fs[0]()
+			if err != nil && !errs.IsNothingToDo(err) {
+				return nil, err
+			}
+			if res != nil {
+				items = append(items, res.([]interface{})...)
+			}
+			if err != nil {
+				fs = fs[1:]
+			}
+		}
+		if pageSize > 0 && len(items) > int(pageSize) {
+			items, rest = items[:pageSize], items[pageSize:]
+		}
+		if len(fs) == 0 && len(rest) == 0 {
+			return items, errs.NothingToDo{}
+		}
+		return items, nil
+	}
+}
+
+func isDN(s string) bool {
+	if !strings.Contains(s, "=") {
+		return false
+	}
+	_, err := ldap.ParseDN(s)
+	return err == nil
+}
@@ -0,0 +1,91 @@
+package ldap
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/shubinmi/ldap/ldaptest"
+)
+
+const salesLDIF = `dn: OU=Sales,DC=corp,DC=test,DC=com
+objectClass: organizationalUnit
+objectCategory: organizationalUnit
+ou: Sales
+
+dn: OU=PreSales,DC=corp,DC=test,DC=com
+objectClass: organizationalUnit
+objectCategory: organizationalUnit
+ou: PreSales
+
+dn: CN=Seller,OU=Sales,DC=corp,DC=test,DC=com
+objectClass: user
+objectCategory: person
+cn: Seller
+
+dn: CN=Presale,OU=PreSales,DC=corp,DC=test,DC=com
+objectClass: user
+objectCategory: person
+cn: Presale
+`
+
+func TestClient_OUUsersScope(t *testing.T) {
+	srv := testServer(t, ldaptest.WithLDIFFile(testDirectory), ldaptest.WithLDIF(salesLDIF))
+	defer srv.Close()
+	c := testClient(t, srv)
+	defer c.Close()
+	tests := []struct {
+		name    string
+		scope   Scope
+		ous     []string
+		want    []string
+		wantErr bool
+	}{
+		{name: "exact name", scope: ScopeSubtree, ous: []string{"Sales"}, want: []string{"Seller"}},
+		{name: "subtree", scope: ScopeSubtree, ous: []string{"Staff"}, want: []string{"Test 1", "Test 2", "Test User"}},
+		{name: "one level", scope: ScopeOneLevel, ous: []string{"Staff"}, want: []string{}},
+		{
+			name:  "dn",
+			scope: ScopeOneLevel,
+			ous:   []string{"OU=TestGroup,OU=Staff,DC=corp,DC=test,DC=com"},
+			want:  []string{"Test 1", "Test 2"},
+		},
+		{
+			name:  "nested bases once",
+			scope: ScopeSubtree,
+			ous:   []string{"TestGroup", "Staff", "Sales", "Users"},
+			want:  []string{"Seller", "Test 1", "Test 2", "Test User"},
+		},
+		{name: "unknown", scope: ScopeSubtree, ous: []string{"Nowhere"}, wantErr: true},
+	}
+	for _, test := range tests {
+		tt := test
+		t.Run(tt.name, func(t *testing.T) {
+			sc, err := c.OUUsersScope(1, tt.scope, tt.ous...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("OUUsersScope() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			got := make([]string, 0, len(tt.want))
+			for sc.Next() {
+				var us []User
+				sc.Scan(UsersSetter(&us))
+				if len(us) > 1 {
+					t.Errorf("OUUsersScope() page size = %d, want 1", len(us))
+				}
+				for _, u := range us {
+					got = append(got, u.Name)
+				}
+			}
+			if sc.LastErr() != nil {
+				t.Fatalf("OUUsersScope() scan error = %v", sc.LastErr())
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("OUUsersScope() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,252 @@
+package ldap
+
+// noinspection GoRedundantImportAlias
+import (
+	"context"
+	"net"
+	"regexp"
+	"strconv"
+	"time"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	ldap "github.com/go-ldap/ldap/v3"
+	"github.com/pkg/errors"
+)
+
+const passwordModifyOID = "1.3.6.1.4.1.4203.1.11.1"
+
+// Win32 errors AD puts in front of the diagnostic message: "0000052D: AtrErr: DSID-03191083, ... data 0, Att 9005a (unicodePwd)"
+const (
+	adInvalidPassword     = 0x56
+	adPasswordRestriction = 0x52d
+)
+
+var adWin32Re = regexp.MustCompile(`^([0-9a-fA-F]{8}):`)
+
+// Password policy violations, errors.Is and errors.Cause of a ChangePassword or ResetPassword error match them
+var (
+	ErrPasswordMismatch   = errors.New("ldap current password does not match")
+	ErrPasswordHistory    = errors.New("ldap password was used before")
+	ErrPasswordComplexity = errors.New("ldap password does not meet complexity requirements")
+	ErrPasswordTooYoung   = errors.New("ldap password is too young to change")
+	// ErrPasswordPolicy is a refusal without the reason: AD answers 0000052D to every policy violation
+	// and servers without the password policy control say constraint violation
+	ErrPasswordPolicy = errors.New("ldap password is refused by the password policy")
+)
+
+// ppolicyReasons are the errors of the password policy response control of draft-behera-ldap-password-policy
+var ppolicyReasons = map[int64]error{
+	5: ErrPasswordComplexity, // insufficientPasswordQuality
+	6: ErrPasswordComplexity, // passwordTooShort
+	7: ErrPasswordTooYoung,   // passwordTooYoung
+	8: ErrPasswordHistory,    // passwordInHistory
+}
+
+func (c *Client) ChangePassword(login, oldPass, newPass string) error {
+	return c.ChangePasswordContext(context.Background(), login, oldPass, newPass)
+}
+
+// ChangePasswordContext is the self-service change: the current password is verified and the policy applies.
+// AD gets the unicodePwd delete/add pair, other servers the RFC 3062 password modify operation as the user.
+func (c *Client) ChangePasswordContext(ctx context.Context, login, oldPass, newPass string) error {
+	if c.isClosed() {
+		return ErrClosed
+	}
+	user, err := c.SearchByLogonContext(ctx, login)
+	if err != nil {
+		return err
+	}
+	dse, err := c.rootDSE(ctx)
+	if err != nil {
+		return err
+	}
+	switch {
+	case dse.activeDirectory:
+		req := ldap.NewModifyRequest(user.DN, nil)
+		req.Delete("unicodePwd", []string{encodePassword(oldPass)})
+		req.Add("unicodePwd", []string{encodePassword(newPass)})
+		err = c.write(ctx, func(con *ldap.Conn) error {
+			return con.Modify(req)
+		})
+	case dse.passwordModify:
+		err = c.policyCall(ctx, user.DN, oldPass, passwordModifyOp("", oldPass, newPass))
+	default:
+		return errors.New("ldap server supports neither unicodePwd nor the password modify operation")
+	}
+	return passwordError(err, "ldap change password of "+login)
+}
+
+func (c *Client) ResetPassword(dn, newPass string, mustChangeAtNextLogon bool) error {
+	return c.ResetPasswordContext(context.Background(), dn, newPass, mustChangeAtNextLogon)
+}
+
+// ResetPasswordContext is the administrative reset, it needs no current password.
+// mustChangeAtNextLogon sets pwdLastSet to 0 on AD and pwdReset on servers with the password policy overlay.
+func (c *Client) ResetPasswordContext(ctx context.Context, dn, newPass string, mustChangeAtNextLogon bool) error {
+	if c.isClosed() {
+		return ErrClosed
+	}
+	dse, err := c.rootDSE(ctx)
+	if err != nil {
+		return err
+	}
+	switch {
+	case dse.activeDirectory:
+		req := ldap.NewModifyRequest(dn, nil)
+		req.Replace("unicodePwd", []string{encodePassword(newPass)})
+		if mustChangeAtNextLogon {
+			req.Replace("pwdLastSet", []string{"0"})
+		}
+		err = c.write(ctx, func(con *ldap.Conn) error {
+			return con.Modify(req)
+		})
+	case dse.passwordModify:
+		ops := []*ber.Packet{passwordModifyOp(dn, "", newPass)}
+		if mustChangeAtNextLogon {
+			ops = append(ops, replaceOp(dn, "pwdReset", "TRUE"))
+		}
+		err = c.policyCall(ctx, c.opt.usr, c.opt.pass, ops...)
+	default:
+		return errors.New("ldap server supports neither unicodePwd nor the password modify operation")
+	}
+	return passwordError(err, "ldap reset password of "+dn)
+}
+
+// policyCall sends ops with the password policy request control on a connection of its own bound as usr,
+// go-ldap does not return the response control that tells why the policy refused a password
+func (c *Client) policyCall(ctx context.Context, usr, pass string, ops ...*ber.Packet) error {
+	con, err := c.dialRaw(ctx, usr, pass)
+	if err != nil {
+		return rawError(ctx, err)
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-stop:
+		}
+		con.close()
+	}()
+	if err = con.conn.SetDeadline(time.Now().Add(c.opt.timeout)); err != nil {
+		return rawError(ctx, err)
+	}
+	for _, op := range ops {
+		p, err := con.exchange(op, ldap.NewControlBeheraPasswordPolicy())
+		if err != nil {
+			return rawError(ctx, err)
+		}
+		if err = resultError(p.Children[1]); err != nil {
+			var le *LDAPError
+			if reason := ppolicyReasons[ppolicyError(p)]; reason != nil && errors.As(err, &le) {
+				le.reason = reason
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// rawError tells a timeout or a done ctx from the connection error they cause
+func rawError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		return errors.Wrap(ErrTimeout, err.Error())
+	}
+	return err
+}
+
+// ppolicyError reads the error of the password policy response control of message p, -1 when there is none.
+// go-ldap can not decode it: it takes the bare enumerated value for a whole BER element.
+func ppolicyError(p *ber.Packet) int64 {
+	if len(p.Children) < 3 || p.Children[2].Tag != 0 {
+		return -1
+	}
+	for _, ctrl := range p.Children[2].Children {
+		if len(ctrl.Children) < 2 || ctrl.Children[0].Data.String() != ldap.ControlTypeBeheraPasswordPolicy {
+			continue
+		}
+		value, err := ber.DecodePacketErr(ctrl.Children[len(ctrl.Children)-1].Data.Bytes())
+		if err != nil {
+			return -1
+		}
+		for _, f := range value.Children {
+			if f.ClassType == ber.ClassContext && f.Tag == 1 {
+				var code int64
+				for _, b := range f.Data.Bytes() {
+					code = code<<8 | int64(b)
+				}
+				return code
+			}
+		}
+	}
+	return -1
+}
+
+func passwordModifyOp(id, oldPass, newPass string) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationExtendedRequest, nil, "Password Modify")
+	op.AppendChild(ber.NewString(ber.ClassContext, ber.TypePrimitive, 0, passwordModifyOID, "Request Name"))
+	value := ber.Encode(ber.ClassContext, ber.TypePrimitive, 1, nil, "Request Value")
+	seq := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Password Modify Request")
+	for i, v := range []string{id, oldPass, newPass} {
+		if v != "" {
+			seq.AppendChild(ber.NewString(ber.ClassContext, ber.TypePrimitive, ber.Tag(i), v, "Field"))
+		}
+	}
+	value.AppendChild(seq)
+	op.AppendChild(value)
+	return op
+}
+
+func replaceOp(dn, attr string, vals ...string) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationModifyRequest, nil, "Modify Request")
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, dn, "DN"))
+	changes := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Changes")
+	change := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Change")
+	change.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, uint64(ldap.ReplaceAttribute), "Operation"))
+	pa := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Modification")
+	pa.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, attr, "Type"))
+	set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Values")
+	for _, v := range vals {
+		set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, v, "Value"))
+	}
+	pa.AppendChild(set)
+	change.AppendChild(pa)
+	changes.AppendChild(change)
+	op.AppendChild(changes)
+	return op
+}
+
+// passwordError sets the ErrPassword* reason of a refusal: the password policy response control tells it,
+// otherwise the result code and the AD Win32 error tell a mismatch from a policy violation
+func passwordError(err error, msg string) error {
+	if err == nil {
+		return nil
+	}
+	err = ldapError(err)
+	var le *LDAPError
+	if !errors.As(err, &le) {
+		return errors.Wrap(err, msg)
+	}
+	switch code := adWin32Error(le.Message); {
+	case le.reason == ErrPasswordHistory || le.reason == ErrPasswordComplexity || le.reason == ErrPasswordTooYoung:
+	case le.Code == ldap.LDAPResultInvalidCredentials || code == adInvalidPassword:
+		le.reason = ErrPasswordMismatch
+	case le.Code == ldap.LDAPResultConstraintViolation || code == adPasswordRestriction:
+		le.reason = ErrPasswordPolicy
+	}
+	return errors.Wrap(err, msg)
+}
+
+// adWin32Error reads the Win32 error AD leads the diagnostic message with, 0 when there is none
+func adWin32Error(diag string) uint64 {
+	m := adWin32Re.FindStringSubmatch(diag)
+	if m == nil {
+		return 0
+	}
+	code, _ := strconv.ParseUint(m[1], 16, 32)
+	return code
+}
@@ -0,0 +1,191 @@
+package ldap
+
+import (
+	"context"
+	"testing"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	ldap "github.com/go-ldap/ldap/v3"
+	"github.com/pkg/errors"
+)
+
+func TestClient_Password(t *testing.T) {
+	const dn = "CN=Test 1,OU=TestGroup,OU=Staff,DC=corp,DC=test,DC=com"
+	// the password policy control tells the reason, AD answers 0000052D to every violation
+	flavours := []struct {
+		name     string
+		dse      map[string][]string
+		mustAttr string
+		history  error
+	}{
+		{name: "password modify", mustAttr: "pwdReset", history: ErrPasswordHistory},
+		{name: "active directory", dse: map[string][]string{"supportedCapabilities": {capActiveDirectory}},
+			mustAttr: "pwdLastSet", history: ErrPasswordPolicy},
+	}
+	for _, flavour := range flavours {
+		fl := flavour
+		t.Run(fl.name, func(t *testing.T) {
+			c, closeAll := writeClient(t, fl.dse)
+			defer closeAll()
+			tests := []struct {
+				name    string
+				do      func() error
+				login   string
+				pass    string
+				wantErr error
+			}{
+				{
+					name:    "wrong current",
+					do:      func() error { return c.ChangePassword("test.1", "wrong", "newPass1") },
+					login:   "test.1",
+					pass:    "test1Pass",
+					wantErr: ErrPasswordMismatch,
+				},
+				{
+					name:    "history",
+					do:      func() error { return c.ChangePassword("test.1", "test1Pass", "test1Pass") },
+					login:   "test.1",
+					pass:    "test1Pass",
+					wantErr: fl.history,
+				},
+				{
+					name:  "change",
+					do:    func() error { return c.ChangePassword("test.1", "test1Pass", "newPass1") },
+					login: "test.1",
+					pass:  "newPass1",
+				},
+				{
+					name:  "reset",
+					do:    func() error { return c.ResetPassword(dn, "resetPass1", true) },
+					login: "test.1",
+					pass:  "resetPass1",
+				},
+			}
+			for _, test := range tests {
+				tt := test
+				t.Run(tt.name, func(t *testing.T) {
+					if err := tt.do(); errors.Cause(err) != tt.wantErr {
+						t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+					}
+					if _, err := c.Auth(tt.login, tt.pass); err != nil {
+						t.Errorf("Auth() with %s unexpected error = %v", tt.pass, err)
+					}
+				})
+			}
+			ent, err := c.entry(context.Background(), dn, fl.mustAttr)
+			if err != nil || ent == nil || attribute(ent, fl.mustAttr) == nil {
+				t.Errorf("ResetPassword() did not set %s, entry %v, err %v", fl.mustAttr, ent, err)
+			}
+			if fl.dse == nil {
+				if err = c.ResetPassword(dn, "ab", false); errors.Cause(err) != ErrPasswordComplexity {
+					t.Errorf("ResetPassword() of a short password error = %v, want %v", err, ErrPasswordComplexity)
+				}
+			}
+			if err = c.ChangePassword("nobody", "a", "b"); err == nil {
+				t.Error("ChangePassword() expected error for unknown login")
+			}
+		})
+	}
+}
+
+func TestPasswordError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{
+			name: "ad wrong password",
+			err: ldap.NewError(ldap.LDAPResultConstraintViolation,
+				errors.New("00000056: AtrErr: DSID-03190F80, #1:\n\t0: 00000056: DSID-03190F80, problem 1005 (CONSTRAINT_ATT_TYPE), data 0, Att 9005a (unicodePwd)")),
+			want: ErrPasswordMismatch,
+		},
+		{
+			name: "ad restriction",
+			err: ldap.NewError(ldap.LDAPResultConstraintViolation,
+				errors.New("0000052D: AtrErr: DSID-03191083, #1:\n\t0: 0000052D: DSID-03191083, problem 1005 (CONSTRAINT_ATT_TYPE), data 0, Att 9005a (unicodePwd)\n")),
+			want: ErrPasswordPolicy,
+		},
+		{
+			name: "ad unwilling",
+			err: ldap.NewError(ldap.LDAPResultUnwillingToPerform,
+				errors.New("0000052D: SvcErr: DSID-031A12D2, problem 5003 (WILL_NOT_PERFORM), data 0")),
+			want: ErrPasswordPolicy,
+		},
+		{
+			name: "constraint",
+			err:  ldap.NewError(ldap.LDAPResultConstraintViolation, errors.New("Password is in history of old passwords")),
+			want: ErrPasswordPolicy,
+		},
+		{
+			name: "bind",
+			err:  ldap.NewError(ldap.LDAPResultInvalidCredentials, errors.New("invalid credentials")),
+			want: ErrPasswordMismatch,
+		},
+	}
+	for _, test := range tests {
+		tt := test
+		t.Run(tt.name, func(t *testing.T) {
+			if got := errors.Cause(passwordError(tt.err, "test")); got != tt.want {
+				t.Errorf("passwordError() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	for _, other := range []error{
+		ldap.NewError(ldap.LDAPResultNoSuchObject, errors.New("no such object")),
+		// the wording is not a reason
+		ldap.NewError(ldap.LDAPResultUnwillingToPerform, errors.New("password history is not available")),
+	} {
+		if got := errors.Cause(passwordError(other, "test")); got != other {
+			t.Errorf("passwordError() got = %v, want %v", got, other)
+		}
+	}
+}
+
+func TestPPolicyError(t *testing.T) {
+	message := func(controls ...*ber.Packet) *ber.Packet {
+		p := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+		p.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, 1, "MessageID"))
+		p.AppendChild(ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationExtendedResponse, nil, "Result"))
+		if len(controls) > 0 {
+			cs := ber.Encode(ber.ClassContext, ber.TypeConstructed, 0, nil, "Controls")
+			for _, c := range controls {
+				cs.AppendChild(c)
+			}
+			p.AppendChild(cs)
+		}
+		// as read from the wire
+		return ber.DecodePacket(p.Bytes())
+	}
+	policy := func(fields ...*ber.Packet) *ber.Packet {
+		seq := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Password Policy Response")
+		for _, f := range fields {
+			seq.AppendChild(f)
+		}
+		return encodeControl(ldap.ControlTypeBeheraPasswordPolicy, false, seq)
+	}
+	warning := ber.Encode(ber.ClassContext, ber.TypeConstructed, 0, nil, "Warning")
+	warning.AppendChild(ber.NewInteger(ber.ClassContext, ber.TypePrimitive, 0, 3600, "Time Before Expiration"))
+	tests := []struct {
+		name string
+		p    *ber.Packet
+		want int64
+	}{
+		{name: "no controls", p: message(), want: -1},
+		{name: "in history", p: message(policy(ber.NewInteger(ber.ClassContext, ber.TypePrimitive, 1, 8, "Error"))), want: 8},
+		{name: "warning only", p: message(policy(warning)), want: -1},
+		{
+			name: "after a warning",
+			p:    message(policy(warning, ber.NewInteger(ber.ClassContext, ber.TypePrimitive, 1, 7, "Error"))),
+			want: 7,
+		},
+	}
+	for _, test := range tests {
+		tt := test
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ppolicyError(tt.p); got != tt.want {
+				t.Errorf("ppolicyError() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,251 @@
+package ldap
+
+// noinspection GoRedundantImportAlias
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	ldap "github.com/go-ldap/ldap/v3"
+	"github.com/pkg/errors"
+)
+
+type poolConn struct {
+	con   *ldap.Conn
+	used  time.Time
+	dirty bool
+}
+
+type pool struct {
+	min         int
+	idleTimeout time.Duration
+	healthCheck time.Duration
+	dial        func(ctx context.Context) (*ldap.Conn, error)
+	check       func(ctx context.Context, con *ldap.Conn) error
+	idle        chan *poolConn
+	slots       chan struct{}
+	done        chan struct{}
+	mtx         *sync.Mutex
+	closed      bool
+}
+
+func newPool(ctx context.Context, o *opt,
+	dial func(ctx context.Context) (*ldap.Conn, error),
+	check func(ctx context.Context, con *ldap.Conn) error) (*pool, error) {
+	p := &pool{
+		min:         o.poolMin,
+		idleTimeout: o.poolIdleTimeout,
+		healthCheck: o.poolHealthCheck,
+		dial:        dial,
+		check:       check,
+		idle:        make(chan *poolConn, o.poolMax),
+		slots:       make(chan struct{}, o.poolMax),
+		done:        make(chan struct{}),
+		mtx:         &sync.Mutex{},
+	}
+	for i := 0; i < p.min; i++ {
+		p.slots <- struct{}{}
+		pc, err := p.open(ctx)
+		if err != nil {
+			p.close()
+			return nil, err
+		}
+		p.idle <- pc
+	}
+	go p.evict()
+	return p, nil
+}
+
+func (p *pool) get(ctx context.Context, timeout time.Duration) (*poolConn, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		if p.isClosed() {
+			return nil, ErrClosed
+		}
+		select {
+		case pc := <-p.idle:
+			if p.healthy(ctx, pc) {
+				return pc, nil
+			}
+			p.discard(pc)
+			continue
+		default:
+		}
+		select {
+		case p.slots <- struct{}{}:
+			return p.open(ctx)
+		case pc := <-p.idle:
+			if p.healthy(ctx, pc) {
+				return pc, nil
+			}
+			p.discard(pc)
+		case <-timer.C:
+			return nil, errors.Wrap(ErrTimeout, "ldap pool get")
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-p.done:
+		}
+	}
+}
+
+func (p *pool) put(pc *poolConn, broken bool) {
+	if broken || p.isClosed() {
+		p.discard(pc)
+		return
+	}
+	pc.used = time.Now()
+	select {
+	case p.idle <- pc:
+	default:
+		p.discard(pc)
+	}
+}
+
+func (p *pool) open(ctx context.Context) (*poolConn, error) {
+	con, err := p.dial(ctx)
+	if err != nil {
+		<-p.slots
+		return nil, err
+	}
+	return &poolConn{con: con, used: time.Now()}, nil
+}
+
+func (p *pool) healthy(ctx context.Context, pc *poolConn) bool {
+	if pc.con.IsClosing() {
+		return false
+	}
+	if !pc.dirty && time.Since(pc.used) < p.healthCheck {
+		return true
+	}
+	if err := p.check(ctx, pc.con); err != nil {
+		log.Println("ldap pool health check", err)
+		return false
+	}
+	pc.dirty = false
+	return true
+}
+
+func (p *pool) discard(pc *poolConn) {
+	defer func() {
+		if e := recover(); e != nil {
+			log.Println("recover on pool discard()", e)
+		}
+	}()
+	defer func() { <-p.slots }()
+	pc.con.Close()
+}
+
+func (p *pool) evict() {
+	tick := time.NewTicker(p.idleTimeout / 2)
+	defer tick.Stop()
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-tick.C:
+		}
+		for n := len(p.idle); n > 0; n-- {
+			var pc *poolConn
+			select {
+			case pc = <-p.idle:
+			default:
+			}
+			if pc == nil {
+				break
+			}
+			if len(p.slots) > p.min && time.Since(pc.used) > p.idleTimeout {
+				p.discard(pc)
+				continue
+			}
+			select {
+			case p.idle <- pc:
+			default:
+				p.discard(pc)
+			}
+		}
+	}
+}
+
+func (p *pool) isClosed() bool {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	return p.closed
+}
+
+func (p *pool) close() {
+	p.mtx.Lock()
+	if p.closed {
+		p.mtx.Unlock()
+		return
+	}
+	p.closed = true
+	close(p.done)
+	p.mtx.Unlock()
+	for {
+		select {
+		case pc := <-p.idle:
+			p.discard(pc)
+		default:
+			return
+		}
+	}
+}
+
+// pinnedConn keeps the connection of a paged search between pages. A scan that is not advanced
+// within the client timeout gives the connection back, its next page goes to any connection.
+type pinnedConn struct {
+	c     *Client
+	mtx   sync.Mutex
+	pc    *poolConn
+	timer *time.Timer
+}
+
+func (p *pinnedConn) do(ctx context.Context, f concurrentFunc) (err error) {
+	var i int32
+	for {
+		if p.c.isClosed() {
+			return ErrClosed
+		}
+		pc := p.take()
+		if pc == nil {
+			if pc, err = p.c.pool.get(ctx, p.c.opt.timeout); err != nil {
+				return err
+			}
+		}
+		broken, _, e := p.c.run(ctx, pc, f)
+		if !broken {
+			p.hold(pc)
+			return e
+		}
+		p.c.pool.put(pc, true)
+		if e != nil || ctx.Err() != nil || !p.c.needRetry(true, &i) {
+			return e
+		}
+	}
+}
+
+func (p *pinnedConn) take() *poolConn {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	if p.timer != nil {
+		p.timer.Stop()
+	}
+	pc := p.pc
+	p.pc = nil
+	return pc
+}
+
+func (p *pinnedConn) hold(pc *poolConn) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.pc = pc
+	p.timer = time.AfterFunc(p.c.opt.timeout, p.release)
+}
+
+func (p *pinnedConn) release() {
+	if pc := p.take(); pc != nil {
+		p.c.pool.put(pc, false)
+	}
+}
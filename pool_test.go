@@ -0,0 +1,59 @@
+package ldap
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/shubinmi/ldap/ldaptest"
+)
+
+func TestClient_Pool(t *testing.T) {
+	srv := testServer(t, ldaptest.WithLDIFFile(testDirectory))
+	defer srv.Close()
+	tests := []struct {
+		name     string
+		min, max int
+		parallel int
+	}{
+		{name: "single", min: 1, max: 1, parallel: 10},
+		{name: "bounded", min: 1, max: 4, parallel: 30},
+		{name: "lazy", min: 0, max: 2, parallel: 5},
+	}
+	for _, test := range tests {
+		tt := test
+		t.Run(tt.name, func(t *testing.T) {
+			idle := 100 * time.Millisecond
+			c := testClient(t, srv, WithPoolSize(tt.min, tt.max), WithPoolIdleTimeout(idle))
+			defer c.Close()
+			wg := sync.WaitGroup{}
+			for i := 0; i < tt.parallel; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					usr, pass := `corp\test.1`, "test1Pass"
+					if i%2 == 0 {
+						usr, pass = `corp\test.user`, "testPass"
+					}
+					if _, e := c.Auth(usr, pass); e != nil {
+						t.Errorf("Auth() unexpected error = %v", e)
+					}
+					if n := len(c.pool.slots); n > tt.max {
+						t.Errorf("pool opened %d connections, max %d", n, tt.max)
+					}
+				}(i)
+			}
+			wg.Wait()
+			if _, err := c.Auth(`corp\test.user`, "wrongPass"); err == nil {
+				t.Error("Auth() expected error for wrong password")
+			}
+			if _, err := c.Search("(sAMAccountName=test.2)"); err != nil {
+				t.Errorf("Search() after Auth unexpected error = %v", err)
+			}
+			time.Sleep(3 * idle)
+			if n := len(c.pool.slots); n > tt.min && n > 0 {
+				t.Errorf("pool kept %d connections after idle timeout, min %d", n, tt.min)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package ldap
+
+// noinspection GoRedundantImportAlias
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/url"
+	"time"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	ldap "github.com/go-ldap/ldap/v3"
+	"github.com/pkg/errors"
+)
+
+const startTLSOID = "1.3.6.1.4.1.1466.20037"
+
+// rawConn is a connection of its own for what go-ldap does not give: the results of a search before it is done,
+// a persistent search is never done, and the controls of a response
+type rawConn struct {
+	conn net.Conn
+	id   int64
+	// search is the message id of the watching search, pending its messages read while waiting for the ack
+	search  int64
+	pending []*ber.Packet
+}
+
+// dialRaw connects like the pool does and binds as usr
+func (c *Client) dialRaw(ctx context.Context, usr, pass string) (*rawConn, error) {
+	u, err := url.Parse(c.opt.url)
+	if err != nil {
+		return nil, err
+	}
+	host := u.Host
+	if u.Port() == "" {
+		port := "389"
+		if u.Scheme == "ldaps" {
+			port = "636"
+		}
+		host = net.JoinHostPort(u.Hostname(), port)
+	}
+	d := &net.Dialer{Timeout: c.opt.timeout}
+	conn, err := d.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return nil, err
+	}
+	cfg := c.opt.tlsConfig()
+	if u.Scheme == "ldaps" {
+		conn = tls.Client(conn, cfg)
+	}
+	w := &rawConn{conn: conn}
+	err = conn.SetDeadline(time.Now().Add(c.opt.timeout))
+	if err == nil && c.opt.startTLS {
+		op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationExtendedRequest, nil, "Start TLS")
+		op.AppendChild(ber.NewString(ber.ClassContext, ber.TypePrimitive, 0, startTLSOID, "Request Name"))
+		if err = w.call(op); err == nil {
+			tc := tls.Client(conn, cfg)
+			w.conn, err = tc, tc.Handshake()
+		}
+	}
+	if err == nil {
+		op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationBindRequest, nil, "Bind Request")
+		op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, 3, "Version"))
+		op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, usr, "User Name"))
+		op.AppendChild(ber.NewString(ber.ClassContext, ber.TypePrimitive, 0, pass, "Password"))
+		err = w.call(op)
+	}
+	if err == nil {
+		err = w.conn.SetDeadline(time.Time{})
+	}
+	if err != nil {
+		w.close()
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *rawConn) send(op *ber.Packet, controls ...ldap.Control) error {
+	w.id++
+	p := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Request")
+	p.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, w.id, "MessageID"))
+	p.AppendChild(op)
+	if len(controls) > 0 {
+		cs := ber.Encode(ber.ClassContext, ber.TypeConstructed, 0, nil, "Controls")
+		for _, c := range controls {
+			cs.AppendChild(c.Encode())
+		}
+		p.AppendChild(cs)
+	}
+	_, err := w.conn.Write(p.Bytes())
+	return err
+}
+
+// call sends op and waits for its result
+func (w *rawConn) call(op *ber.Packet) error {
+	p, err := w.exchange(op)
+	if err != nil {
+		return err
+	}
+	return resultError(p.Children[1])
+}
+
+// exchange sends op with controls and returns the whole response message, response controls included
+func (w *rawConn) exchange(op *ber.Packet, controls ...ldap.Control) (*ber.Packet, error) {
+	if err := w.send(op, controls...); err != nil {
+		return nil, err
+	}
+	p, err := ber.ReadPacket(w.conn)
+	if err != nil {
+		return nil, err
+	}
+	if len(p.Children) < 2 || berInt(p.Children[0]) != w.id {
+		return nil, errors.New("ldap unexpected response")
+	}
+	return p, nil
+}
+
+func (w *rawConn) close() {
+	_ = w.conn.Close()
+}
+
+func resultError(op *ber.Packet) error {
+	if len(op.Children) < 3 {
+		return errors.New("ldap malformed result")
+	}
+	code := uint16(berInt(op.Children[0]))
+	if code == ldap.LDAPResultSuccess {
+		return nil
+	}
+	return ldapError(ldap.NewError(code, errors.New(op.Children[2].Data.String())))
+}
@@ -0,0 +1,69 @@
+package ldap
+
+// noinspection GoRedundantImportAlias
+import (
+	"context"
+	"strings"
+
+	ldap "github.com/go-ldap/ldap/v3"
+	"github.com/pkg/errors"
+)
+
+const (
+	capActiveDirectory = "1.2.840.113556.1.4.800"
+	extPasswordModify  = "1.3.6.1.4.1.4203.1.11.1"
+)
+
+type rootDSE struct {
+	activeDirectory bool
+	passwordModify  bool
+	schema          *Schema
+}
+
+var rootDSEAttributes = []string{
+	"supportedCapabilities", "supportedExtension", "vendorName", "objectClass", "namingContexts",
+}
+
+// rootDSE reads server capabilities once and caches them on the client
+func (c *Client) rootDSE(ctx context.Context) (*rootDSE, error) {
+	c.mtx.Lock()
+	dse := c.dse
+	c.mtx.Unlock()
+	if dse != nil {
+		return dse, nil
+	}
+	ent, err := c.rootDSEEntry(ctx, rootDSEAttributes...)
+	if err != nil {
+		return nil, err
+	}
+	dse = &rootDSE{}
+	for _, v := range ent.GetAttributeValues("supportedCapabilities") {
+		if strings.TrimSpace(v) == capActiveDirectory {
+			dse.activeDirectory = true
+		}
+	}
+	for _, v := range ent.GetAttributeValues("supportedExtension") {
+		if strings.TrimSpace(v) == extPasswordModify {
+			dse.passwordModify = true
+		}
+	}
+	dse.schema = detectSchema(dse, ent.GetAttributeValue("vendorName"),
+		ent.GetAttributeValues("objectClass"), ent.GetAttributeValues("namingContexts"))
+	c.mtx.Lock()
+	c.dse = dse
+	c.mtx.Unlock()
+	return dse, nil
+}
+
+// rootDSEEntry reads attrs of the RootDSE, an empty entry when the server hides it
+func (c *Client) rootDSEEntry(ctx context.Context, attrs ...string) (*ldap.Entry, error) {
+	sr, err := c.search(ctx, ldap.NewSearchRequest("", ldap.ScopeBaseObject, ldap.NeverDerefAliases,
+		0, 0, false, Present("objectClass").String(), attrs, nil))
+	if err != nil {
+		return nil, errors.Wrap(err, "ldap read root dse")
+	}
+	if len(sr.Entries) == 0 {
+		return &ldap.Entry{}, nil
+	}
+	return sr.Entries[0], nil
+}
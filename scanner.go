@@ -1,60 +1,177 @@
 package ldap
 
+// noinspection GoRedundantImportAlias
 import (
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	ldap "github.com/go-ldap/ldap/v3"
+	"github.com/pkg/errors"
 	"github.com/shubinmi/util/errs"
 )
 
 type ResultsScanner interface {
 	Next() bool
 	LastErr() error
-	Scan(setter func(res interface{}))
+	// Scan hands the page read by Next to setter, an error of setter is kept as LastErr
+	Scan(setter func(res interface{}) error)
+	// Close gives back the connection of a paged search, call it when you stop before Next returns false
+	Close()
+	// Cursor is where the scan stands after the pages read so far, "" when there are no more.
+	// Resume takes it before the first Next of a scanner of the same search, also of another client.
+	// Only a single paged search can be resumed, others return ErrCursorNotSupported rather than read it again.
+	// Next fails with ErrInvalidCursor when the server does not take the cookie back, e.g. on another connection.
+	Cursor() string
+	Resume(cursor string) error
 }
 
-func GroupsSetter(gs *[]Group) func(res interface{}) {
-	return func(res interface{}) {
+func GroupsSetter(gs *[]Group) func(res interface{}) error {
+	return func(res interface{}) error {
 		if res == nil {
-			return
+			return nil
 		}
 		items := res.([]interface{})
 		for _, item := range items {
-			*gs = append(*gs, item.(Group))
+			v, ok := itemValue(item).(Group)
+			if !ok {
+				return errors.Errorf("ldap setter can not set %T into Group", itemValue(item))
+			}
+			*gs = append(*gs, v)
 		}
+		return nil
 	}
 }
 
-func UnitsSetter(us *[]Unit) func(res interface{}) {
-	return func(res interface{}) {
+func UnitsSetter(us *[]Unit) func(res interface{}) error {
+	return func(res interface{}) error {
 		if res == nil {
-			return
+			return nil
 		}
 		items := res.([]interface{})
 		for _, item := range items {
-			*us = append(*us, item.(Unit))
+			v, ok := itemValue(item).(Unit)
+			if !ok {
+				return errors.Errorf("ldap setter can not set %T into Unit", itemValue(item))
+			}
+			*us = append(*us, v)
 		}
+		return nil
 	}
 }
 
-func UsersSetter(us *[]User) func(res interface{}) {
-	return func(res interface{}) {
+func UsersSetter(us *[]User) func(res interface{}) error {
+	return func(res interface{}) error {
 		if res == nil {
-			return
+			return nil
 		}
 		items := res.([]interface{})
 		for _, item := range items {
-			*us = append(*us, item.(User))
+			v, ok := itemValue(item).(User)
+			if !ok {
+				return errors.Errorf("ldap setter can not set %T into User", itemValue(item))
+			}
+			*us = append(*us, v)
+		}
+		return nil
+	}
+}
+
+// Setter appends scanned results to the slice dst points to. Elements of the
+// scanner's own type are appended as is, any other struct is filled by Unmarshal
+// from the entry the result was read from. It returns the Unmarshal errors, Scan keeps them as LastErr.
+func Setter(dst interface{}) func(res interface{}) error {
+	return func(res interface{}) error {
+		if res == nil {
+			return nil
 		}
+		return appendItems(dst, res.([]interface{}))
 	}
 }
 
+func appendItems(dst interface{}, items []interface{}) error {
+	sv := reflect.ValueOf(dst)
+	if sv.Kind() != reflect.Ptr || sv.Elem().Kind() != reflect.Slice {
+		return errors.Errorf("ldap setter needs a pointer to slice, got %T", dst)
+	}
+	sv = sv.Elem()
+	et := sv.Type().Elem()
+	for _, item := range items {
+		v := itemValue(item)
+		if v != nil && reflect.TypeOf(v).AssignableTo(et) {
+			sv.Set(reflect.Append(sv, reflect.ValueOf(v)))
+			continue
+		}
+		it, ok := item.(scanItem)
+		if !ok || it.entry == nil {
+			return errors.Errorf("ldap setter can not set %T into %s", v, et)
+		}
+		nv := reflect.New(et)
+		target := nv
+		if et.Kind() == reflect.Ptr {
+			nv.Elem().Set(reflect.New(et.Elem()))
+			target = nv.Elem()
+		}
+		if err := Unmarshal(it.entry, target.Interface()); err != nil {
+			return err
+		}
+		sv.Set(reflect.Append(sv, nv.Elem()))
+	}
+	return nil
+}
+
+// scanItem keeps the source entry next to the mapped value, so Setter can decode it into any type
+type scanItem struct {
+	value interface{}
+	entry *ldap.Entry
+}
+
+func itemValue(item interface{}) interface{} {
+	if it, ok := item.(scanItem); ok {
+		return it.value
+	}
+	return item
+}
+
 type scanner struct {
 	result    interface{}
 	retriever func() (interface{}, error)
+	releases  []func()
 	lastErr   error
 	done      bool
+	identity  string
+	// paging is the control of a single paged search, its cookie goes into the cursor
+	paging  *ldap.ControlPaging
+	started bool
+	// offset counts the items read, resumed marks a cookie the server has yet to take back
+	offset  int
+	resumed bool
+}
+
+// cursor is the serialized position of a scanner
+type cursor struct {
+	Identity string `json:"i"`
+	Offset   int    `json:"o"`
+	Cookie   []byte `json:"c,omitempty"`
+}
+
+func newScanner(identity string, retriever func() (interface{}, error), releases ...func()) *scanner {
+	return &scanner{identity: identity, retriever: retriever, releases: releases}
 }
 
-func newScanner(retriever func() (interface{}, error)) *scanner {
-	return &scanner{retriever: retriever}
+func newPagedScanner(ps *pagedSearch) *scanner {
+	s := newScanner(ps.identity, ps.next, ps.release)
+	s.paging = ps.paging
+	return s
+}
+
+// searchIdentity digests what makes a search, page sizes may differ between the calls of a walk
+func searchIdentity(parts ...interface{}) string {
+	sum := sha1.Sum([]byte(fmt.Sprintf("%q", parts)))
+	return hex.EncodeToString(sum[:8])
 }
 
 func (s scanner) LastErr() error {
@@ -62,10 +179,20 @@ func (s scanner) LastErr() error {
 }
 
 func (s *scanner) Next() bool {
-	if s.done {
+	if s.done || s.lastErr != nil {
 		return false
 	}
+	s.started = true
 	gs, err := s.retriever()
+	var le *LDAPError
+	if s.resumed && errors.As(err, &le) {
+		// the server did not take the cookie back, e.g. it was issued on another connection
+		err = errors.Wrap(ErrInvalidCursor, err.Error())
+	}
+	s.resumed = false
+	if items, ok := gs.([]interface{}); ok {
+		s.offset += len(items)
+	}
 	s.result = gs
 	if err != nil && !errs.IsNothingToDo(err) {
 		s.lastErr = err
@@ -73,9 +200,58 @@ func (s *scanner) Next() bool {
 	if err != nil && errs.IsNothingToDo(err) {
 		s.done = true
 	}
+	if s.done || s.lastErr != nil {
+		s.Close()
+	}
 	return s.lastErr == nil && s.result != nil
 }
 
-func (s scanner) Scan(loader func(res interface{})) {
-	loader(s.result)
+func (s *scanner) Cursor() string {
+	if s.done || s.lastErr != nil {
+		return ""
+	}
+	cur := cursor{Identity: s.identity, Offset: s.offset}
+	if s.paging != nil {
+		cur.Cookie = s.paging.Cookie
+	}
+	bt, err := json.Marshal(cur)
+	if err != nil {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString(bt)
+}
+
+func (s *scanner) Resume(c string) error {
+	if s.started {
+		return errors.New("ldap cursor is resumed after the scan started")
+	}
+	if s.paging == nil {
+		return ErrCursorNotSupported
+	}
+	var cur cursor
+	bt, err := base64.RawURLEncoding.DecodeString(c)
+	if err == nil {
+		err = json.Unmarshal(bt, &cur)
+	}
+	if err != nil || cur.Identity != s.identity || cur.Offset < 0 || cur.Offset > 0 && len(cur.Cookie) == 0 {
+		return ErrInvalidCursor
+	}
+	s.offset = cur.Offset
+	if len(cur.Cookie) > 0 {
+		s.paging.SetCookie(cur.Cookie)
+		s.resumed = true
+	}
+	return nil
+}
+
+func (s *scanner) Close() {
+	for _, release := range s.releases {
+		release()
+	}
+}
+
+func (s *scanner) Scan(loader func(res interface{}) error) {
+	if err := loader(s.result); err != nil {
+		s.lastErr = err
+	}
 }
@@ -0,0 +1,161 @@
+package ldap
+
+// noinspection GoRedundantImportAlias
+import (
+	"context"
+	"strings"
+)
+
+// Schema describes how a directory server models users, groups and units: the filters that find them,
+// the attributes logins and memberships live in and how entries map to User, Group and Unit.
+type Schema struct {
+	Name   string
+	Users  Filter
+	Groups Filter
+	Units  Filter
+	// LoginAttrs are matched by SearchByLogon and Auth
+	LoginAttrs []string
+	// MemberAttrs hold member DNs on group entries
+	MemberAttrs []string
+	// MemberOfAttr lists the groups of a user entry, empty when the server keeps no back-links
+	MemberOfAttr string
+	// DNAttr holds the entry DN for filters, member lists are read in batches by it. Empty reads each member on its own
+	DNAttr string
+	// GroupClasses are the objectClass values CreateGroup adds
+	GroupClasses []string
+	// GroupLoginAttr is set to the group cn by CreateGroup when not empty
+	GroupLoginAttr string
+	// UserFields, GroupFields and UnitFields override the ldap tags of the User, Group and Unit fields:
+	// field name => comma separated attributes, the first one with values wins
+	UserFields  map[string]string
+	GroupFields map[string]string
+	UnitFields  map[string]string
+}
+
+var (
+	SchemaActiveDirectory = Schema{
+		Name:  "Active Directory",
+		Users: And(Eq("objectCategory", "person"), Eq("objectClass", "user")),
+		// group classes of other servers are kept, so directories that are not recognized still list their groups
+		Groups: Or(
+			Eq("objectclass", "group"),
+			Eq("objectclass", "groupofnames"),
+			Eq("objectclass", "groupofuniquenames"),
+			Eq("objectCategory", "group"),
+		),
+		Units:          Eq("objectCategory", "organizationalUnit"),
+		LoginAttrs:     []string{"sAMAccountName", "userPrincipalName"},
+		MemberAttrs:    []string{memberAttr, uniqueMemberAttr},
+		MemberOfAttr:   "memberOf",
+		DNAttr:         "distinguishedName",
+		GroupClasses:   []string{"top", "group"},
+		GroupLoginAttr: "sAMAccountName",
+	}
+	SchemaOpenLDAP = Schema{
+		Name:        "OpenLDAP",
+		Users:       Eq("objectClass", "inetOrgPerson"),
+		Groups:      Or(Eq("objectClass", "groupOfNames"), Eq("objectClass", "groupOfUniqueNames")),
+		Units:       Eq("objectClass", "organizationalUnit"),
+		LoginAttrs:  []string{"uid", "mail"},
+		MemberAttrs: []string{memberAttr, uniqueMemberAttr},
+		// the memberOf overlay is optional, group member lists are read instead
+		DNAttr:       "entryDN",
+		GroupClasses: []string{"top", "groupOfNames"},
+		UserFields: map[string]string{
+			"Name":  "displayName,cn,uid",
+			"Logon": "uid",
+			"Phone": "telephoneNumber,mobile",
+			"GUID":  "entryUUID",
+		},
+		GroupFields: map[string]string{"Name": "cn", "Member": "member,uniqueMember", "GUID": "entryUUID"},
+	}
+	SchemaFreeIPA = Schema{
+		Name:         "FreeIPA",
+		Users:        And(Eq("objectClass", "person"), Eq("objectClass", "posixAccount")),
+		Groups:       And(Eq("objectClass", "groupOfNames"), Eq("objectClass", "ipaUserGroup")),
+		Units:        Eq("objectClass", "organizationalUnit"),
+		LoginAttrs:   []string{"uid", "krbPrincipalName"},
+		MemberAttrs:  []string{memberAttr},
+		MemberOfAttr: "memberOf",
+		DNAttr:       "entryDN",
+		GroupClasses: []string{"top", "groupOfNames", "nestedGroup", "ipaUserGroup"},
+		UserFields: map[string]string{
+			"Name":  "displayName,cn,uid",
+			"Logon": "uid,krbPrincipalName",
+			"Phone": "telephoneNumber,mobile",
+			"GUID":  "ipaUniqueID",
+			"SID":   "ipaNTSecurityIdentifier",
+		},
+		GroupFields: map[string]string{"Name": "cn", "GUID": "ipaUniqueID", "SID": "ipaNTSecurityIdentifier"},
+	}
+	Schema389DS = Schema{
+		Name:         "389 Directory Server",
+		Users:        Eq("objectClass", "inetOrgPerson"),
+		Groups:       Or(Eq("objectClass", "groupOfNames"), Eq("objectClass", "groupOfUniqueNames")),
+		Units:        Eq("objectClass", "organizationalUnit"),
+		LoginAttrs:   []string{"uid", "mail"},
+		MemberAttrs:  []string{memberAttr, uniqueMemberAttr},
+		MemberOfAttr: "memberOf",
+		DNAttr:       "entryDN",
+		GroupClasses: []string{"top", "groupOfNames"},
+		UserFields: map[string]string{
+			"Name":  "displayName,cn,uid",
+			"Logon": "uid",
+			"Phone": "telephoneNumber,mobile",
+			"GUID":  "nsUniqueId",
+		},
+		GroupFields: map[string]string{"Name": "cn", "Member": "member,uniqueMember", "GUID": "nsUniqueId"},
+	}
+)
+
+// schema is the profile set by WithSchema or the one detected from RootDSE
+func (c *Client) schema(ctx context.Context) (*Schema, error) {
+	if c.opt.schema != nil {
+		return c.opt.schema, nil
+	}
+	dse, err := c.rootDSE(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return dse.schema, nil
+}
+
+// detectSchema picks the profile by the RootDSE of the server, unknown servers get the AD one
+func detectSchema(dse *rootDSE, vendor string, classes, contexts []string) *Schema {
+	has := func(vals []string, v string) bool {
+		for _, x := range vals {
+			if strings.EqualFold(strings.TrimSpace(x), v) {
+				return true
+			}
+		}
+		return false
+	}
+	switch {
+	case dse.activeDirectory:
+		return &SchemaActiveDirectory
+	case has(contexts, "o=ipaca"):
+		// the certificate authority suffix is there on every FreeIPA server
+		return &SchemaFreeIPA
+	case strings.Contains(vendor, "389 Project"):
+		return &Schema389DS
+	case has(classes, "OpenLDAProotDSE"):
+		return &SchemaOpenLDAP
+	}
+	return &SchemaActiveDirectory
+}
+
+func (s *Schema) memberFilter(dn string) Filter {
+	fs := make([]Filter, 0, len(s.MemberAttrs))
+	for _, a := range s.MemberAttrs {
+		fs = append(fs, Eq(a, dn))
+	}
+	return Or(fs...)
+}
+
+func (s *Schema) loginFilter(login string) Filter {
+	fs := make([]Filter, 0, len(s.LoginAttrs))
+	for _, a := range s.LoginAttrs {
+		fs = append(fs, Eq(a, login))
+	}
+	return Or(fs...)
+}
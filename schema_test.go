@@ -0,0 +1,159 @@
+package ldap
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/shubinmi/ldap/ldaptest"
+)
+
+const openLDAPLDIF = `dn: dc=example,dc=org
+objectClass: dcObject
+objectClass: organization
+dc: example
+
+dn: ou=people,dc=example,dc=org
+objectClass: organizationalUnit
+ou: people
+
+dn: uid=admin,ou=people,dc=example,dc=org
+objectClass: organizationalPerson
+objectClass: inetOrgPerson
+cn: admin
+sn: admin
+uid: admin
+userPassword: adminPass
+
+dn: uid=alice,ou=people,dc=example,dc=org
+objectClass: organizationalPerson
+objectClass: inetOrgPerson
+cn: Alice A
+sn: A
+displayName: Alice
+uid: alice
+mail: alice@example.org
+mobile: 123
+userPassword: alicePass
+
+dn: uid=bob,ou=people,dc=example,dc=org
+objectClass: organizationalPerson
+objectClass: inetOrgPerson
+cn: Bob B
+sn: B
+uid: bob
+
+dn: cn=devs,dc=example,dc=org
+objectClass: groupOfNames
+cn: devs
+member: uid=alice,ou=people,dc=example,dc=org
+member: cn=ops,dc=example,dc=org
+
+dn: cn=ops,dc=example,dc=org
+objectClass: groupOfUniqueNames
+cn: ops
+uniqueMember: uid=bob,ou=people,dc=example,dc=org
+`
+
+func TestDetectSchema(t *testing.T) {
+	tests := []struct {
+		name     string
+		dse      rootDSE
+		vendor   string
+		classes  []string
+		contexts []string
+		want     *Schema
+	}{
+		{name: "active directory", dse: rootDSE{activeDirectory: true}, want: &SchemaActiveDirectory},
+		{name: "freeipa", vendor: "389 Project", contexts: []string{"dc=ipa,dc=test", "o=ipaca"}, want: &SchemaFreeIPA},
+		{name: "389", vendor: "389 Project", contexts: []string{"dc=example,dc=com"}, want: &Schema389DS},
+		{name: "openldap", classes: []string{"top", "OpenLDAProotDSE"}, want: &SchemaOpenLDAP},
+		{name: "unknown", vendor: "ldaptest", classes: []string{"top"}, want: &SchemaActiveDirectory},
+	}
+	for _, test := range tests {
+		tt := test
+		t.Run(tt.name, func(t *testing.T) {
+			dse := tt.dse
+			if got := detectSchema(&dse, tt.vendor, tt.classes, tt.contexts); got != tt.want {
+				t.Errorf("detectSchema() got = %v, want %v", got.Name, tt.want.Name)
+			}
+		})
+	}
+}
+
+func TestClient_Schema(t *testing.T) {
+	srv := testServer(t, ldaptest.WithLDIF(openLDAPLDIF),
+		ldaptest.WithRootDSE(map[string][]string{"objectClass": {"top", "OpenLDAProotDSE"}}))
+	defer srv.Close()
+	plain := testServer(t, ldaptest.WithLDIF(openLDAPLDIF))
+	defer plain.Close()
+	tests := []struct {
+		name string
+		srv  *ldaptest.Server
+		fs   []optF
+	}{
+		{name: "detected", srv: srv},
+		{name: "configured", srv: plain, fs: []optF{WithSchema(SchemaOpenLDAP)}},
+	}
+	for _, test := range tests {
+		tt := test
+		t.Run(tt.name, func(t *testing.T) {
+			c := testClient(t, tt.srv, append([]optF{
+				WithBaseDN("dc=example,dc=org"), WithAdmin("admin", "adminPass"),
+			}, tt.fs...)...)
+			defer c.Close()
+			u, err := c.Auth("alice", "alicePass")
+			if err != nil {
+				t.Fatalf("Auth() unexpected error = %v", err)
+			}
+			want := User{Name: "Alice", DN: "uid=alice,ou=people,dc=example,dc=org", CN: "Alice A",
+				Mail: "alice@example.org", Phone: "123", Logon: "alice", Surname: "A", MemberOf: []string{}}
+			u.Status = AccountStatus{}
+			if !reflect.DeepEqual(u, want) {
+				t.Errorf("Auth() got = %+v, want %+v", u, want)
+			}
+			groups, err := c.UserGroups("uid=bob,ou=people,dc=example,dc=org", Transitive)
+			if got := groupNames(groups); err != nil || !reflect.DeepEqual(got, []string{"devs", "ops"}) {
+				t.Errorf("UserGroups() got = %v, err %v", got, err)
+			}
+			for mode, want := range map[MembershipMode][]string{Direct: {"alice"}, Transitive: {"alice", "bob"}} {
+				sc, err := c.GroupUsers("cn=devs,dc=example,dc=org", 10, mode)
+				if err != nil {
+					t.Fatalf("GroupUsers() unexpected error = %v", err)
+				}
+				var users []User
+				for sc.Next() {
+					sc.Scan(UsersSetter(&users))
+				}
+				got := make([]string, 0, len(users))
+				for _, u := range users {
+					got = append(got, u.Logon)
+				}
+				sort.Strings(got)
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("GroupUsers(%v) got = %v, want %v", mode, got, want)
+				}
+			}
+			sc, err := c.Groups(10)
+			if err != nil {
+				t.Fatalf("Groups() unexpected error = %v", err)
+			}
+			var gs []Group
+			for sc.Next() {
+				sc.Scan(GroupsSetter(&gs))
+			}
+			if got := groupNames(gs); !reflect.DeepEqual(got, []string{"devs", "ops"}) {
+				t.Errorf("Groups() got = %v", got)
+			}
+		})
+	}
+}
+
+func groupNames(gs []Group) []string {
+	res := make([]string, 0, len(gs))
+	for _, g := range gs {
+		res = append(res, g.Name)
+	}
+	sort.Strings(res)
+	return res
+}
@@ -0,0 +1,27 @@
+package ldap
+
+// noinspection GoRedundantImportAlias
+import (
+	ldap "github.com/go-ldap/ldap/v3"
+)
+
+// Scope of a search, the zero ScopeDefault is a subtree search
+type Scope int
+
+const (
+	ScopeDefault Scope = iota
+	ScopeBase
+	ScopeOneLevel
+	ScopeSubtree
+)
+
+// ldapScope is the scope of a go-ldap search request
+func (s Scope) ldapScope() int {
+	switch s {
+	case ScopeBase:
+		return ldap.ScopeBaseObject
+	case ScopeOneLevel:
+		return ldap.ScopeSingleLevel
+	}
+	return ldap.ScopeWholeSubtree
+}
@@ -0,0 +1,139 @@
+package ldap
+
+// noinspection GoRedundantImportAlias
+import (
+	"context"
+	"time"
+
+	ldap "github.com/go-ldap/ldap/v3"
+	"github.com/pkg/errors"
+)
+
+func (c *Client) SearchPaged(query string, pageSize uint32, o SearchOptions) (ResultsScanner, error) {
+	return c.SearchPagedContext(context.Background(), query, pageSize, o)
+}
+
+// SearchPagedContext streams the results of query a page at a time, so large exports are not held in memory.
+// Pages are the Search maps, Setter decodes them into your own types. SizeLimit does not apply, stop scanning instead.
+func (c *Client) SearchPagedContext(ctx context.Context, query string, pageSize uint32,
+	o SearchOptions) (ResultsScanner, error) {
+	if c.isClosed() {
+		return nil, ErrClosed
+	}
+	if o.View != nil {
+		return nil, errors.New("ldap search: a view can not be paged")
+	}
+	return newPagedScanner(c.pagedRetriever(ctx, pageSize, c.optionsRequest(query, o),
+		func(e *ldap.Entry) interface{} { return entryMap(e) })), nil
+}
+
+// optionsRequest is the search request of query tuned by o, SizeLimit and View are left to the caller
+func (c *Client) optionsRequest(query string, o SearchOptions) *ldap.SearchRequest {
+	req := c.searchRequest(query, o.Attributes, o.Controls...)
+	if len(o.Sort) > 0 && o.View == nil {
+		req.Controls = append(append([]ldap.Control(nil), req.Controls...), NewControlSort(o.Sort...))
+	}
+	if o.BaseDN != "" {
+		req.BaseDN = o.BaseDN
+	}
+	req.Scope = o.Scope.ldapScope()
+	if o.TimeLimit > 0 {
+		req.TimeLimit = timeLimit(o.TimeLimit)
+	}
+	req.DerefAliases = int(o.Deref)
+	req.TypesOnly = o.TypesOnly
+	return req
+}
+
+// searchPageSize stays within the AD MaxPageSize of 1000
+const searchPageSize = 1000
+
+type Deref int
+
+const (
+	DerefNever       Deref = ldap.NeverDerefAliases
+	DerefInSearching Deref = ldap.DerefInSearching
+	DerefFindingBase Deref = ldap.DerefFindingBaseObj
+	DerefAlways      Deref = ldap.DerefAlways
+)
+
+// limitedSearch pages through req on one connection until sizeLimit entries are read, every page has the client
+// timeout of its own. The size limit is not sent to the server: go-ldap drops every entry of a response ending
+// in sizeLimitExceeded.
+func (c *Client) limitedSearch(ctx context.Context, req *ldap.SearchRequest,
+	sizeLimit int) ([]*ldap.Entry, []ldap.Control, bool, error) {
+	pin := &pinnedConn{c: c}
+	defer pin.release()
+	search := func(r *ldap.SearchRequest) (sr *ldap.SearchResult, err error) {
+		op := func(con *ldap.Conn) (done chan struct{}) {
+			done = make(chan struct{})
+			go func() {
+				defer close(done)
+				sr, err = con.Search(r)
+			}()
+			return
+		}
+		err = doError(err, pin.do(ctx, op))
+		return
+	}
+	if ldap.FindControl(req.Controls, ldap.ControlTypePaging) != nil {
+		sr, err := search(req)
+		if isLimit(err) {
+			return nil, nil, true, nil
+		}
+		if err != nil {
+			return nil, nil, false, ldapError(err)
+		}
+		return sr.Entries, sr.Controls, false, nil
+	}
+	paging := ldap.NewControlPaging(searchPageSize)
+	r := *req
+	r.Controls = append(append([]ldap.Control(nil), req.Controls...), paging)
+	var entries []*ldap.Entry
+	for {
+		if sizeLimit > 0 {
+			paging.PagingSize = uint32(minInt(sizeLimit-len(entries), searchPageSize))
+		}
+		sr, err := search(&r)
+		if isLimit(err) {
+			return entries, nil, true, nil
+		}
+		if err != nil {
+			return nil, nil, false, ldapError(err)
+		}
+		entries = append(entries, sr.Entries...)
+		var cookie []byte
+		if ctrl, ok := ldap.FindControl(sr.Controls, ldap.ControlTypePaging).(*ldap.ControlPaging); ok {
+			cookie = ctrl.Cookie
+		}
+		if sizeLimit > 0 && len(entries) >= sizeLimit {
+			// a server ignoring the paging control returns everything at once
+			partial := len(entries) > sizeLimit || len(cookie) > 0
+			if len(cookie) > 0 {
+				// a zero page size releases the results the server keeps for the cookie
+				paging.PagingSize = 0
+				paging.SetCookie(cookie)
+				_, _ = search(&r)
+			}
+			return entries[:sizeLimit], sr.Controls, partial, nil
+		}
+		if len(cookie) == 0 {
+			return entries, sr.Controls, false, nil
+		}
+		paging.SetCookie(cookie)
+	}
+}
+
+func isLimit(err error) bool {
+	return ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) ||
+		ldap.IsErrorWithCode(err, ldap.LDAPResultTimeLimitExceeded) ||
+		ldap.IsErrorWithCode(err, ldap.LDAPResultAdminLimitExceeded)
+}
+
+// timeLimit is d in whole seconds for the time limit of a search request, rounded up as 0 means no limit
+func timeLimit(d time.Duration) int {
+	if d <= 0 {
+		return 0
+	}
+	return int((d + time.Second - 1) / time.Second)
+}
@@ -0,0 +1,275 @@
+package ldap
+
+import (
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	ldap "github.com/go-ldap/ldap/v3"
+	"github.com/pkg/errors"
+	"github.com/shubinmi/ldap/ldaptest"
+)
+
+func TestClient_SearchOptions(t *testing.T) {
+	srv := testServer(t, ldaptest.WithLDIFFile(testDirectory), ldaptest.WithMaxPageSize(1))
+	defer srv.Close()
+	c := testClient(t, srv)
+	defer c.Close()
+	const staff = "OU=Staff,DC=corp,DC=test,DC=com"
+	ous := Eq("objectClass", "organizationalUnit").String()
+	tests := []struct {
+		name        string
+		query       string
+		o           SearchOptions
+		want        []string
+		wantPartial bool
+	}{
+		{name: "subtree", query: Eq("cn", "Test 1").String(), want: []string{"CN=Test 1,OU=TestGroup," + staff}},
+		{name: "one level", query: ous, o: SearchOptions{BaseDN: staff, Scope: ScopeOneLevel},
+			want: []string{"OU=St-Petersburg," + staff, "OU=TestGroup," + staff}},
+		{name: "base", query: ous, o: SearchOptions{BaseDN: staff, Scope: ScopeBase}, want: []string{staff}},
+		{name: "base DN subtree", query: ous, o: SearchOptions{BaseDN: staff}, want: []string{staff,
+			"OU=St-Petersburg," + staff, "OU=Users,OU=St-Petersburg," + staff, "OU=TestGroup," + staff}},
+		{name: "size limit", query: ous, o: SearchOptions{SizeLimit: 2}, want: []string{staff, "OU=St-Petersburg," + staff},
+			wantPartial: true},
+		{name: "size limit not reached", query: ous, o: SearchOptions{BaseDN: staff, Scope: ScopeOneLevel, SizeLimit: 2},
+			want: []string{"OU=St-Petersburg," + staff, "OU=TestGroup," + staff}},
+		{name: "own paging", query: ous, o: SearchOptions{Controls: []ldap.Control{ldap.NewControlPaging(1)}},
+			want: []string{staff}},
+	}
+	for _, test := range tests {
+		tt := test
+		t.Run(tt.name, func(t *testing.T) {
+			tt.o.Attributes = []string{NoAttributes}
+			res, err := c.SearchWithOptions(tt.query, tt.o)
+			if err != nil {
+				t.Fatalf("SearchWithOptions() unexpected error = %v", err)
+			}
+			got := make([]string, 0, len(res.Entries))
+			for _, e := range res.Entries {
+				got = append(got, e["DN"].(string))
+			}
+			sort.Strings(got)
+			sort.Strings(tt.want)
+			if !reflect.DeepEqual(got, tt.want) || res.Partial != tt.wantPartial {
+				t.Errorf("SearchWithOptions() got = %v, partial %v, want %v, %v", got, res.Partial, tt.want, tt.wantPartial)
+			}
+		})
+	}
+
+	res, err := c.SearchWithOptions(Eq("cn", "Test 1").String(), SearchOptions{Attributes: []string{"cn", "mail"},
+		TypesOnly: true, TimeLimit: 1500 * time.Millisecond, Deref: DerefAlways})
+	if err != nil || len(res.Entries) != 1 || !reflect.DeepEqual(res.Entries[0]["mail"], []string(nil)) ||
+		res.Entries[0]["cn"] == nil {
+		t.Errorf("SearchWithOptions() types only got = %+v, err %v", res, err)
+	}
+	own, err := c.SearchWithOptions(Eq("objectClass", "organizationalUnit").String(),
+		SearchOptions{Controls: []ldap.Control{ldap.NewControlPaging(1)}})
+	if ctrl, ok := ldap.FindControl(own.Controls, ldap.ControlTypePaging).(*ldap.ControlPaging); err != nil || !ok ||
+		len(ctrl.Cookie) == 0 {
+		t.Errorf("SearchWithOptions() own paging controls = %v, err %v", own.Controls, err)
+	}
+}
+
+func TestTimeLimit(t *testing.T) {
+	for d, want := range map[time.Duration]int{0: 0, -time.Second: 0, time.Millisecond: 1, 5 * time.Second: 5,
+		5*time.Second + 1: 6} {
+		if got := timeLimit(d); got != want {
+			t.Errorf("timeLimit(%v) got = %v, want %v", d, got, want)
+		}
+	}
+}
+
+func TestClient_SearchPageTimeout(t *testing.T) {
+	// six pages of one entry take longer than the timeout, every one of them is within it
+	srv := testServer(t, ldaptest.WithLDIFFile(testDirectory), ldaptest.WithMaxPageSize(1),
+		ldaptest.WithLatency(100*time.Millisecond))
+	defer srv.Close()
+	c := testClient(t, srv, WithTimeout(400*time.Millisecond))
+	defer c.Close()
+	res, err := c.SearchWithOptions(Eq("objectClass", "organizationalUnit").String(),
+		SearchOptions{Attributes: []string{NoAttributes}})
+	if err != nil {
+		t.Fatalf("SearchWithOptions() unexpected error = %v", err)
+	}
+	if len(res.Entries) != 6 {
+		t.Errorf("SearchWithOptions() got %d entries, want 6", len(res.Entries))
+	}
+}
+
+func TestClient_SearchPaged(t *testing.T) {
+	srv := testServer(t, ldaptest.WithLDIFFile(testDirectory), ldaptest.WithMaxPageSize(1))
+	defer srv.Close()
+	c := testClient(t, srv, WithPoolSize(1, 3))
+	defer c.Close()
+	users := Eq("objectClass", "user").String()
+
+	sc, err := c.SearchPaged(users, 1, SearchOptions{Attributes: []string{"cn"}})
+	if err != nil {
+		t.Fatalf("SearchPaged() unexpected error = %v", err)
+	}
+	var got []map[string]interface{}
+	for sc.Next() {
+		// other requests take connections between the pages, the scan stays on its own
+		wg := sync.WaitGroup{}
+		for i := 0; i < 3; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, err := c.Search(users); err != nil {
+					t.Errorf("Search() between pages error = %v", err)
+				}
+			}()
+		}
+		wg.Wait()
+		sc.Scan(Setter(&got))
+	}
+	if sc.LastErr() != nil || len(got) != 3 || got[0]["cn"] == nil {
+		t.Errorf("SearchPaged() got = %v, err %v", got, sc.LastErr())
+	}
+
+	sc, err = c.SearchPaged(users, 2, SearchOptions{BaseDN: "OU=Staff,DC=corp,DC=test,DC=com", Scope: ScopeSubtree})
+	if err != nil {
+		t.Fatalf("SearchPaged() unexpected error = %v", err)
+	}
+	var persons []struct {
+		DN   string `ldap:"dn"`
+		Mail string `ldap:"mail"`
+	}
+	for sc.Next() {
+		sc.Scan(Setter(&persons))
+	}
+	if sc.LastErr() != nil || len(persons) != 3 || persons[0].Mail == "" {
+		t.Errorf("SearchPaged() into structs got = %+v, err %v", persons, sc.LastErr())
+	}
+
+	single := testClient(t, srv, WithPoolSize(1, 1), WithTimeout(200*time.Millisecond))
+	defer single.Close()
+	for _, closeIt := range []bool{true, false} {
+		sc, err = single.SearchPaged(users, 1, SearchOptions{})
+		if err != nil || !sc.Next() {
+			t.Fatalf("SearchPaged() first page err = %v, %v", err, sc.LastErr())
+		}
+		if len(single.pool.idle) != 0 {
+			t.Errorf("SearchPaged() gave back its connection before the last page")
+		}
+		if closeIt {
+			sc.Close()
+		} else {
+			// an abandoned scan gives the connection back after the timeout
+			time.Sleep(400 * time.Millisecond)
+		}
+		if len(single.pool.idle) != 1 {
+			t.Errorf("SearchPaged() kept the connection, closed %v", closeIt)
+		}
+	}
+}
+
+func TestClient_Cursor(t *testing.T) {
+	srv := testServer(t, ldaptest.WithLDIFFile(testDirectory))
+	defer srv.Close()
+	clients := []*Client{testClient(t, srv), testClient(t, srv)}
+	for _, c := range clients {
+		defer c.Close()
+	}
+	const clientsGroup = "CN=Clients,OU=Products,OU=Service Accounts,DC=corp,DC=test,DC=com"
+	scans := []struct {
+		name string
+		scan func(c *Client) (ResultsScanner, error)
+	}{
+		{name: "group users", scan: func(c *Client) (ResultsScanner, error) { return c.GroupUsers(clientsGroup, 1) }},
+		{name: "groups", scan: func(c *Client) (ResultsScanner, error) { return c.Groups(1) }},
+		{name: "ou users", scan: func(c *Client) (ResultsScanner, error) { return c.OUUsers(2, "Staff") }},
+		{name: "search", scan: func(c *Client) (ResultsScanner, error) {
+			return c.SearchPaged(Eq("objectClass", "organizationalUnit").String(), 2, SearchOptions{})
+		}},
+	}
+	type item struct {
+		DN string `ldap:"dn"`
+	}
+	for _, test := range scans {
+		tt := test
+		t.Run(tt.name, func(t *testing.T) {
+			sc, err := tt.scan(clients[0])
+			if err != nil {
+				t.Fatalf("scan unexpected error = %v", err)
+			}
+			var want []item
+			for sc.Next() {
+				sc.Scan(Setter(&want))
+			}
+			if sc.LastErr() != nil || len(want) < 2 || sc.Cursor() != "" {
+				t.Fatalf("scan got = %v, err %v, cursor %q", want, sc.LastErr(), sc.Cursor())
+			}
+			var got []item
+			cur := ""
+			for i := 0; i == 0 || cur != ""; i++ {
+				sc, err := tt.scan(clients[0])
+				if err != nil {
+					t.Fatalf("scan unexpected error = %v", err)
+				}
+				if cur != "" {
+					if err = sc.Resume(cur); err != nil {
+						t.Fatalf("Resume() unexpected error = %v", err)
+					}
+				}
+				if sc.Next() {
+					sc.Scan(Setter(&got))
+				}
+				if sc.LastErr() != nil {
+					t.Fatalf("Next() after Resume unexpected error = %v", sc.LastErr())
+				}
+				cur = sc.Cursor()
+				sc.Close()
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("cursor walk got = %v, want %v", got, want)
+			}
+			// the cookie is bound to its connection, another client is refused instead of reading it all again
+			sc, _ = tt.scan(clients[0])
+			sc.Next()
+			cur = sc.Cursor()
+			sc.Close()
+			sc, _ = tt.scan(clients[1])
+			if err = sc.Resume(cur); err != nil {
+				t.Fatalf("Resume() unexpected error = %v", err)
+			}
+			if sc.Next() || !errors.Is(sc.LastErr(), ErrInvalidCursor) {
+				t.Errorf("Next() on another connection error = %v, want %v", sc.LastErr(), ErrInvalidCursor)
+			}
+		})
+	}
+
+	sc, _ := clients[0].Groups(1)
+	sc.Next()
+	cur := sc.Cursor()
+	sc.Close()
+	if err := sc.Resume(cur); err == nil {
+		t.Error("Resume() expected error after the scan started")
+	}
+	for _, c := range []string{"garbage", cur} {
+		sc, _ = clients[0].GroupUsers(clientsGroup, 1)
+		if err := sc.Resume(c); err != ErrInvalidCursor {
+			t.Errorf("Resume(%q) error = %v, want %v", c, err, ErrInvalidCursor)
+		}
+	}
+	// member lists and several OUs have no paging cookie, resuming them would read everything again
+	for _, scan := range []func() (ResultsScanner, error){
+		func() (ResultsScanner, error) { return clients[0].GroupUsers(clientsGroup, 1, Transitive) },
+		func() (ResultsScanner, error) { return clients[0].OUUsers(1, "TestGroup", "Users") },
+	} {
+		sc, err := scan()
+		if err != nil {
+			t.Fatalf("scan unexpected error = %v", err)
+		}
+		sc.Next()
+		cur = sc.Cursor()
+		sc.Close()
+		if sc, _ = scan(); cur == "" || sc.Resume(cur) != ErrCursorNotSupported {
+			t.Errorf("Resume(%q) error, want %v", cur, ErrCursorNotSupported)
+		}
+		sc.Close()
+	}
+}
@@ -0,0 +1,68 @@
+package ldap
+
+import (
+	"context"
+	"crypto/tls"
+	"testing"
+
+	"github.com/shubinmi/ldap/ldaptest"
+)
+
+func TestClient_TLS(t *testing.T) {
+	cert, roots, err := ldaptest.GenerateCert()
+	if err != nil {
+		t.Fatal("generate cert", err)
+	}
+	srvTLS := &tls.Config{Certificates: []tls.Certificate{cert}}
+	ldaps := testServer(t, ldaptest.WithLDIFFile(testDirectory), ldaptest.WithTLS(srvTLS))
+	defer ldaps.Close()
+	plain := testServer(t, ldaptest.WithLDIFFile(testDirectory), ldaptest.WithStartTLS(srvTLS), ldaptest.WithRequireTLS())
+	defer plain.Close()
+	tests := []struct {
+		name    string
+		srv     *ldaptest.Server
+		fs      []optF
+		wantErr bool
+	}{
+		{name: "ldaps", srv: ldaps, fs: []optF{WithTLSConfig(&tls.Config{RootCAs: roots})}},
+		{name: "ldaps untrusted", srv: ldaps, wantErr: true},
+		{name: "ldaps insecure", srv: ldaps, fs: []optF{WithInsecureSkipVerify()}},
+		{name: "start tls", srv: plain, fs: []optF{WithStartTLS(), WithTLSConfig(&tls.Config{RootCAs: roots})}},
+		{name: "start tls untrusted", srv: plain, fs: []optF{WithStartTLS()}, wantErr: true},
+		{name: "plaintext bind", srv: plain, wantErr: true},
+	}
+	for _, test := range tests {
+		tt := test
+		t.Run(tt.name, func(t *testing.T) {
+			fs := append([]optF{
+				WithURL(tt.srv.URL()),
+				WithBaseDN(tt.srv.BaseDN()),
+				WithAdmin(`corp\test.user`, "testPass"),
+				WithPoolSize(1, 2),
+			}, tt.fs...)
+			c, err := New(context.Background(), fs...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("New() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			defer c.Close()
+			if _, err = c.Auth(`corp\test.1`, "test1Pass"); err != nil {
+				t.Errorf("Auth() over tls unexpected error = %v", err)
+			}
+			// a discarded connection is redialed with the same tls settings
+			pc, err := c.pool.get(context.Background(), c.opt.timeout)
+			if err != nil {
+				t.Fatalf("pool get error = %v", err)
+			}
+			c.pool.put(pc, true)
+			if _, err = c.Auth(`corp\test.2`, "test2Pass"); err != nil {
+				t.Errorf("Auth() after redial unexpected error = %v", err)
+			}
+		})
+	}
+	if _, err = newOpt(WithURL(ldaps.URL()), WithBaseDN("dc=test"), WithAdmin("u", "p"), WithStartTLS()); err == nil {
+		t.Error("newOpt() expected error for StartTLS over ldaps")
+	}
+}
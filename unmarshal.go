@@ -0,0 +1,188 @@
+package ldap
+
+// noinspection GoRedundantImportAlias
+import (
+	"crypto/x509"
+	"encoding"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	ldap "github.com/go-ldap/ldap/v3"
+	"github.com/pkg/errors"
+	"github.com/shubinmi/util/errs"
+)
+
+const (
+	tagName = "ldap"
+	tagDN   = "dn"
+	// AD stores timestamps as 100ns intervals since 1601-01-01 UTC
+	fileTimeEpochDiff = 116444736000000000
+	fileTimeNever     = 9223372036854775807
+)
+
+var (
+	bytesType             = reflect.TypeOf([]byte(nil))
+	timeType              = reflect.TypeOf(time.Time{})
+	certType              = reflect.TypeOf((*x509.Certificate)(nil))
+	textUnmarshalerType   = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	binaryUnmarshalerType = reflect.TypeOf((*encoding.BinaryUnmarshaler)(nil)).Elem()
+)
+
+// Unmarshal copies entry attributes into the struct v points to.
+// Fields are bound with `ldap:"attr1,attr2"` tags: the first attribute with values wins,
+// `ldap:"dn"` receives the entry DN and untagged fields are left alone.
+// Supported field types are strings, ints, uints, bools, time.Time (generalized time or AD file time),
+// []byte for binary values, *x509.Certificate, encoding.TextUnmarshaler, encoding.BinaryUnmarshaler (GUID, SID),
+// pointers to them and slices of them for multi-valued attributes.
+// A field that fails to convert is left as is, the others are still set and the errors of all of them are returned.
+func Unmarshal(ent *ldap.Entry, v interface{}) error {
+	return unmarshal(ent, v, nil)
+}
+
+// unmarshal is Unmarshal with fields overriding the tags: field name => comma separated attributes
+func unmarshal(ent *ldap.Entry, v interface{}, fields map[string]string) error {
+	if ent == nil {
+		return errors.New("ldap unmarshal nil entry")
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return errors.Errorf("ldap unmarshal needs a non-nil pointer to struct, got %T", v)
+	}
+	return unmarshalStruct(ent, rv.Elem(), fields)
+}
+
+func unmarshalStruct(ent *ldap.Entry, sv reflect.Value, fields map[string]string) (err error) {
+	st := sv.Type()
+	for i := 0; i < st.NumField(); i++ {
+		sf := st.Field(i)
+		fv := sv.Field(i)
+		tag, tagged := sf.Tag.Lookup(tagName)
+		if f, ok := fields[sf.Name]; ok {
+			tag, tagged = f, true
+		}
+		if !tagged && sf.Anonymous && fv.Kind() == reflect.Struct {
+			err = errs.Merge(err, unmarshalStruct(ent, fv, fields))
+			continue
+		}
+		if !tagged || tag == "-" || !fv.CanSet() {
+			continue
+		}
+		for _, name := range strings.Split(tag, ",") {
+			name = strings.TrimSpace(name)
+			var raw [][]byte
+			if strings.EqualFold(name, tagDN) {
+				raw = [][]byte{[]byte(ent.DN)}
+			} else if a := attribute(ent, name); a != nil {
+				raw = a.ByteValues
+			}
+			if len(raw) == 0 {
+				continue
+			}
+			if e := setField(fv, raw); e != nil {
+				err = errs.Merge(err, errors.Wrapf(e, "ldap unmarshal %s into %s", name, sf.Name))
+			}
+			break
+		}
+	}
+	return err
+}
+
+func attribute(ent *ldap.Entry, name string) *ldap.EntryAttribute {
+	for _, a := range ent.Attributes {
+		if strings.EqualFold(a.Name, name) {
+			return a
+		}
+	}
+	return nil
+}
+
+func setField(fv reflect.Value, raw [][]byte) error {
+	if fv.Type() == bytesType {
+		fv.SetBytes(raw[0])
+		return nil
+	}
+	if fv.Type() == certType {
+		cert, err := x509.ParseCertificate(raw[0])
+		if err != nil {
+			return err
+		}
+		fv.Set(reflect.ValueOf(cert))
+		return nil
+	}
+	if fv.Kind() == reflect.Slice {
+		s := reflect.MakeSlice(fv.Type(), len(raw), len(raw))
+		for i, b := range raw {
+			if err := setField(s.Index(i), [][]byte{b}); err != nil {
+				return err
+			}
+		}
+		fv.Set(s)
+		return nil
+	}
+	if fv.Kind() == reflect.Ptr {
+		p := reflect.New(fv.Type().Elem())
+		if err := setField(p.Elem(), raw); err != nil {
+			return err
+		}
+		fv.Set(p)
+		return nil
+	}
+	if fv.Type() == timeType {
+		t, err := parseTime(string(raw[0]))
+		if err != nil {
+			return err
+		}
+		fv.Set(reflect.ValueOf(t))
+		return nil
+	}
+	if fv.CanAddr() && fv.Addr().Type().Implements(textUnmarshalerType) {
+		return fv.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText(raw[0])
+	}
+	if fv.CanAddr() && fv.Addr().Type().Implements(binaryUnmarshalerType) {
+		return fv.Addr().Interface().(encoding.BinaryUnmarshaler).UnmarshalBinary(raw[0])
+	}
+	val := string(raw[0])
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(val)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(strings.ToLower(val))
+		if err != nil {
+			return err
+		}
+		fv.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(val, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(val, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetUint(n)
+	default:
+		return errors.Errorf("unsupported type %s", fv.Type())
+	}
+	return nil
+}
+
+func parseTime(val string) (time.Time, error) {
+	if n, err := strconv.ParseInt(val, 10, 64); err == nil && len(val) != 14 {
+		if n <= 0 || n == fileTimeNever {
+			return time.Time{}, nil
+		}
+		n -= fileTimeEpochDiff
+		return time.Unix(n/1e7, n%1e7*100).UTC(), nil
+	}
+	// fractional seconds are accepted by time.Parse even though the layout has none
+	t, err := time.Parse("20060102150405Z0700", val)
+	if err != nil {
+		return time.Time{}, errors.Wrap(err, "wrong generalized time")
+	}
+	return t, nil
+}
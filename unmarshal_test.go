@@ -0,0 +1,191 @@
+package ldap
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	ldap "github.com/go-ldap/ldap/v3"
+	"github.com/spf13/viper"
+)
+
+type testPerson struct {
+	User
+	Department string     `ldap:"department"`
+	Title      *string    `ldap:"title"`
+	EmployeeID int        `ldap:"employeeID"`
+	Manager    string     `ldap:"manager"`
+	Enabled    bool       `ldap:"enabled"`
+	Changed    time.Time  `ldap:"whenChanged"`
+	LastLogon  time.Time  `ldap:"lastLogonTimestamp"`
+	Expires    *time.Time `ldap:"accountExpires"`
+	Groups     []string   `ldap:"memberOf"`
+	Codes      []uint16   `ldap:"code"`
+	GUID       []byte     `ldap:"objectGUID"`
+	Missing    string     `ldap:"noSuchAttr"`
+	Ignored    string     `ldap:"-"`
+}
+
+func TestUnmarshal(t *testing.T) {
+	title := "Engineer"
+	ent := ldap.NewEntry("CN=Test User,DC=corp", map[string][]string{
+		"cn":                 {"Test User"},
+		"displayName":        {"Test U."},
+		"sAMAccountName":     {"test.user"},
+		"department":         {"R&D"},
+		"title":              {title},
+		"employeeID":         {"42"},
+		"manager":            {"CN=Boss,DC=corp"},
+		"enabled":            {"TRUE"},
+		"whenChanged":        {"20201017101112.0Z"},
+		"lastLogonTimestamp": {"132473664000000000"},
+		"accountExpires":     {"9223372036854775807"},
+		"memberOf":           {"CN=A,DC=corp", "CN=B,DC=corp"},
+		"code":               {"1", "2"},
+		"objectGUID":         {"\x01\x02\x00\xff"},
+		"Ignored":            {"x"},
+	})
+	tests := []struct {
+		name    string
+		ent     *ldap.Entry
+		v       interface{}
+		want    interface{}
+		wantErr bool
+		// errFields are the fields the error has to name
+		errFields []string
+	}{
+		{
+			name: "person",
+			ent:  ent,
+			v:    &testPerson{},
+			want: &testPerson{
+				// a binary GUID that is not 16 bytes long is kept as hex
+				User: User{Name: "Test U.", DN: "CN=Test User,DC=corp", CN: "Test User", Logon: "test.user",
+					GUID: "010200ff", Title: "Engineer", Department: "R&D", Manager: "CN=Boss,DC=corp", EmployeeID: "42",
+					WhenChanged: time.Date(2020, 10, 17, 10, 11, 12, 0, time.UTC),
+					LastLogon:   time.Date(2020, 10, 17, 0, 0, 0, 0, time.UTC)},
+				Department: "R&D",
+				Title:      &title,
+				EmployeeID: 42,
+				Manager:    "CN=Boss,DC=corp",
+				Enabled:    true,
+				Changed:    time.Date(2020, 10, 17, 10, 11, 12, 0, time.UTC),
+				LastLogon:  time.Date(2020, 10, 17, 0, 0, 0, 0, time.UTC),
+				Expires:    &time.Time{},
+				Groups:     []string{"CN=A,DC=corp", "CN=B,DC=corp"},
+				Codes:      []uint16{1, 2},
+				GUID:       []byte{1, 2, 0, 255},
+			},
+		},
+		{
+			name:    "wrong int",
+			ent:     ldap.NewEntry("cn=x", map[string][]string{"employeeID": {"x42"}}),
+			v:       &testPerson{},
+			wantErr: true,
+		},
+		{
+			// the fields that fail are left alone, the others are still set
+			name: "wrong fields",
+			ent: ldap.NewEntry("cn=x", map[string][]string{
+				"cn": {"x"}, "employeeID": {"x42"}, "enabled": {"maybe"}, "department": {"R&D"}}),
+			v: &testPerson{},
+			want: &testPerson{
+				User:       User{Name: "x", DN: "cn=x", CN: "x", Department: "R&D", EmployeeID: "x42"},
+				Department: "R&D",
+			},
+			wantErr:   true,
+			errFields: []string{"EmployeeID", "Enabled"},
+		},
+		{
+			name:    "not a pointer",
+			ent:     ent,
+			v:       testPerson{},
+			wantErr: true,
+		},
+		{
+			name:    "nil entry",
+			v:       &testPerson{},
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		tt := test
+		t.Run(tt.name, func(t *testing.T) {
+			err := Unmarshal(tt.ent, tt.v)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Unmarshal() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			for _, f := range tt.errFields {
+				if !strings.Contains(err.Error(), f) {
+					t.Errorf("Unmarshal() error = %v, want it to name %s", err, f)
+				}
+			}
+			if tt.want == nil {
+				return
+			}
+			got := tt.v.(*testPerson)
+			want := tt.want.(*testPerson)
+			if !got.Changed.Equal(want.Changed) || !got.LastLogon.Equal(want.LastLogon) {
+				t.Errorf("Unmarshal() times = %v, %v, want %v, %v", got.Changed, got.LastLogon, want.Changed, want.LastLogon)
+			}
+			got.Changed, got.LastLogon = want.Changed, want.LastLogon
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Unmarshal() got = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestClient_SearchInto(t *testing.T) {
+	c := client(t)
+	defer c.Close()
+	type member struct {
+		DN     string   `ldap:"dn"`
+		Login  string   `ldap:"sAMAccountName"`
+		Groups []string `ldap:"memberOf"`
+	}
+	var ms []member
+	if err := c.SearchInto(Eq("sAMAccountName", "test.user").String(), &ms); err != nil {
+		t.Fatalf("SearchInto() unexpected error = %v", err)
+	}
+	if len(ms) != 1 || ms[0].DN != viper.GetString("tests.client.auth.dn") || len(ms[0].Groups) == 0 {
+		t.Errorf("SearchInto() got = %+v", ms)
+	}
+	if err := c.SearchInto(Eq("sAMAccountName", "test.user").String(), ms); err == nil {
+		t.Error("SearchInto() expected error for non pointer destination")
+	}
+
+	sc, err := c.GroupUsers(viper.GetString("tests.client.groupUsers.nodeDN"), 1)
+	if err != nil {
+		t.Fatalf("GroupUsers() unexpected error = %v", err)
+	}
+	var ps []*member
+	for sc.Next() {
+		sc.Scan(Setter(&ps))
+	}
+	if sc.LastErr() != nil || len(ps) == 0 {
+		t.Errorf("Setter() got = %v, err %v", ps, sc.LastErr())
+	}
+	for _, p := range ps {
+		if p.Login == "" || p.DN == "" {
+			t.Errorf("Setter() got empty member = %+v", p)
+		}
+	}
+	var ints []int
+	sc, _ = c.Groups(1)
+	for sc.Next() {
+		sc.Scan(Setter(&ints))
+	}
+	if sc.LastErr() == nil {
+		t.Error("Setter() expected error for int destination")
+	}
+	// called on its own a setter returns the error rather than panicking
+	if err := Setter(&ints)([]interface{}{Group{}}); err == nil {
+		t.Error("Setter() expected error for a group into int")
+	}
+	var us []User
+	if err := UsersSetter(&us)([]interface{}{Group{}}); err == nil {
+		t.Error("UsersSetter() expected error for a group")
+	}
+}
@@ -0,0 +1,186 @@
+package ldap
+
+// noinspection GoRedundantImportAlias
+import (
+	"context"
+	"encoding/binary"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	ldap "github.com/go-ldap/ldap/v3"
+	"github.com/pkg/errors"
+)
+
+const (
+	uacAccountDisable = 0x2
+	uacNormalAccount  = 0x200
+)
+
+var userClasses = []string{"top", "person", "organizationalPerson", "user"}
+
+func (c *Client) CreateUser(u User, pass string, attrs map[string][]string) error {
+	return c.CreateUserContext(context.Background(), u, pass, attrs)
+}
+
+// CreateUserContext adds a disabled AD user built from u and attrs, which override the derived attributes.
+// When pass is given the password is set and the account is enabled, AD refuses to enable it earlier.
+func (c *Client) CreateUserContext(ctx context.Context, u User, pass string, attrs map[string][]string) error {
+	if c.isClosed() {
+		return ErrClosed
+	}
+	if u.DN == "" || u.Logon == "" {
+		return errors.New("user DN and Logon are required")
+	}
+	values := map[string][]string{
+		"objectClass":        userClasses,
+		"cn":                 {u.CN},
+		"sAMAccountName":     {u.Logon},
+		"userAccountControl": {strconv.Itoa(uacNormalAccount | uacAccountDisable)},
+	}
+	if u.CN == "" {
+		values["cn"] = []string{rdnValue(u.DN)}
+	}
+	if domain := domainOf(c.opt.dn); domain != "" {
+		values["userPrincipalName"] = []string{u.Logon + "@" + domain}
+	}
+	for attr, v := range userValues(u) {
+		if v != "" {
+			values[attr] = []string{v}
+		}
+	}
+	for attr, vs := range attrs {
+		values[attr] = vs
+	}
+	req := ldap.NewAddRequest(u.DN, nil)
+	for attr, vs := range values {
+		if len(vs) > 0 {
+			req.Attribute(attr, vs)
+		}
+	}
+	err := c.write(ctx, func(con *ldap.Conn) error {
+		return con.Add(req)
+	})
+	if err != nil {
+		return errors.Wrap(err, "ldap create user "+u.DN)
+	}
+	if pass == "" {
+		return nil
+	}
+	mod := ldap.NewModifyRequest(u.DN, nil)
+	mod.Replace("unicodePwd", []string{encodePassword(pass)})
+	err = c.write(ctx, func(con *ldap.Conn) error {
+		return con.Modify(mod)
+	})
+	if err != nil {
+		return errors.Wrap(err, "ldap user "+u.DN+" is created disabled, set password")
+	}
+	uac := uacNormalAccount
+	if vs := values["userAccountControl"]; len(vs) > 0 {
+		if n, e := strconv.Atoi(vs[0]); e == nil {
+			uac = n
+		}
+	}
+	mod = ldap.NewModifyRequest(u.DN, nil)
+	mod.Replace("userAccountControl", []string{strconv.Itoa(uac &^ uacAccountDisable)})
+	err = c.write(ctx, func(con *ldap.Conn) error {
+		return con.Modify(mod)
+	})
+	return errors.Wrap(err, "ldap user "+u.DN+" is created disabled, enable")
+}
+
+func (c *Client) UpdateUser(u User, attrs map[string][]string) error {
+	return c.UpdateUserContext(context.Background(), u, attrs)
+}
+
+// UpdateUserContext replaces non-empty fields of u and every attribute of attrs, an empty value list removes the attribute
+func (c *Client) UpdateUserContext(ctx context.Context, u User, attrs map[string][]string) error {
+	if c.isClosed() {
+		return ErrClosed
+	}
+	if u.DN == "" {
+		return errors.New("user DN is required")
+	}
+	req := ldap.NewModifyRequest(u.DN, nil)
+	values := userValues(u)
+	values["sAMAccountName"] = u.Logon
+	for attr, v := range values {
+		if _, ok := attrs[attr]; !ok && v != "" {
+			req.Replace(attr, []string{v})
+		}
+	}
+	for attr, vs := range attrs {
+		req.Replace(attr, vs)
+	}
+	if len(req.Changes) == 0 {
+		return nil
+	}
+	err := c.write(ctx, func(con *ldap.Conn) error {
+		return con.Modify(req)
+	})
+	return errors.Wrap(err, "ldap update user "+u.DN)
+}
+
+func (c *Client) DeleteUser(dn string) error {
+	return c.DeleteUserContext(context.Background(), dn)
+}
+
+func (c *Client) DeleteUserContext(ctx context.Context, dn string) error {
+	if c.isClosed() {
+		return ErrClosed
+	}
+	err := c.write(ctx, func(con *ldap.Conn) error {
+		return con.Del(ldap.NewDelRequest(dn, nil))
+	})
+	return errors.Wrap(err, "ldap delete user "+dn)
+}
+
+// userValues are the AD attributes of the writable fields of u
+func userValues(u User) map[string]string {
+	return map[string]string{
+		"displayName":     u.Name,
+		"mail":            u.Mail,
+		"telephoneNumber": u.Phone,
+		"title":           u.Title,
+		"department":      u.Department,
+		"company":         u.Company,
+		"manager":         u.Manager,
+		"employeeID":      u.EmployeeID,
+		"givenName":       u.GivenName,
+		"sn":              u.Surname,
+	}
+}
+
+// encodePassword builds an AD unicodePwd value: the quoted password in UTF-16LE
+func encodePassword(pass string) string {
+	u := utf16.Encode([]rune(`"` + pass + `"`))
+	b := make([]byte, len(u)*2)
+	for i, r := range u {
+		binary.LittleEndian.PutUint16(b[i*2:], r)
+	}
+	return string(b)
+}
+
+func rdnValue(dn string) string {
+	parsed, err := ldap.ParseDN(dn)
+	if err != nil || len(parsed.RDNs) == 0 || len(parsed.RDNs[0].Attributes) == 0 {
+		return ""
+	}
+	return parsed.RDNs[0].Attributes[0].Value
+}
+
+func domainOf(dn string) string {
+	parsed, err := ldap.ParseDN(dn)
+	if err != nil {
+		return ""
+	}
+	dcs := make([]string, 0, len(parsed.RDNs))
+	for _, rdn := range parsed.RDNs {
+		for _, a := range rdn.Attributes {
+			if strings.EqualFold(a.Type, "dc") {
+				dcs = append(dcs, a.Value)
+			}
+		}
+	}
+	return strings.ToLower(strings.Join(dcs, "."))
+}
@@ -0,0 +1,86 @@
+package ldap
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/shubinmi/ldap/ldaptest"
+)
+
+func writeClient(t *testing.T, dse map[string][]string) (*Client, func()) {
+	srv := testServer(t, ldaptest.WithLDIFFile(testDirectory), ldaptest.WithRootDSE(dse))
+	c := testClient(t, srv)
+	return c, func() {
+		c.Close()
+		srv.Close()
+	}
+}
+
+func TestClient_UserLifecycle(t *testing.T) {
+	c, closeAll := writeClient(t, nil)
+	defer closeAll()
+	dn := "CN=New Hire,OU=Users,OU=St-Petersburg,OU=Staff,DC=corp,DC=test,DC=com"
+	type account struct {
+		UPN        string   `ldap:"userPrincipalName"`
+		UAC        int      `ldap:"userAccountControl"`
+		Department string   `ldap:"department"`
+		Classes    []string `ldap:"objectClass"`
+		Title      string   `ldap:"title"`
+	}
+	read := func() account {
+		var as []account
+		if err := c.SearchInto(Eq("sAMAccountName", "new.hire").String(), &as); err != nil || len(as) != 1 {
+			t.Fatalf("SearchInto() got = %+v, err %v", as, err)
+		}
+		return as[0]
+	}
+
+	u := User{DN: dn, Name: "New Hire", Mail: "new.hire@test.com", Logon: "new.hire", GivenName: "New", Surname: "Hire"}
+	attrs := map[string][]string{"department": {"R&D"}, "title": {"Engineer"}}
+	if err := c.CreateUser(u, "newPass1!", attrs); err != nil {
+		t.Fatalf("CreateUser() unexpected error = %v", err)
+	}
+	if err := c.CreateUser(u, "newPass1!", nil); err == nil {
+		t.Error("CreateUser() expected error for existing user")
+	}
+	if err := c.CreateUser(User{DN: "CN=Nobody,DC=corp,DC=test,DC=com"}, "", nil); err == nil {
+		t.Error("CreateUser() expected error without Logon")
+	}
+	got, err := c.Auth(`corp\new.hire`, "newPass1!")
+	if err != nil {
+		t.Fatalf("Auth() as created user unexpected error = %v", err)
+	}
+	if got.DN != dn || got.CN != "New Hire" || got.Mail != u.Mail || got.GivenName != "New" || got.Surname != "Hire" ||
+		got.Department != "R&D" || got.Title != "Engineer" {
+		t.Errorf("Auth() got = %+v", got)
+	}
+	// account attributes have no field, they are kept raw next to the decoded Status
+	if uac := got.Attributes["userAccountControl"]; len(uac) != 1 || uac[0] != strconv.Itoa(uacNormalAccount) {
+		t.Errorf("Auth() got attributes = %v", got.Attributes)
+	}
+	a := read()
+	if a.UPN != "new.hire@corp.test.com" || a.UAC != uacNormalAccount || a.Department != "R&D" || len(a.Classes) != 4 {
+		t.Errorf("CreateUser() stored = %+v", a)
+	}
+
+	u.Mail = "hire@test.com"
+	if err = c.UpdateUser(User{DN: dn, Mail: u.Mail}, map[string][]string{"department": {"Sales"}, "title": nil}); err != nil {
+		t.Fatalf("UpdateUser() unexpected error = %v", err)
+	}
+	if got, err = c.SearchByLogon("new.hire"); err != nil || got.Mail != u.Mail || got.Name != "New Hire" {
+		t.Errorf("UpdateUser() got = %+v, err %v", got, err)
+	}
+	if a = read(); a.Department != "Sales" || a.Title != "" {
+		t.Errorf("UpdateUser() stored = %+v", a)
+	}
+
+	if err = c.DeleteUser(dn); err != nil {
+		t.Fatalf("DeleteUser() unexpected error = %v", err)
+	}
+	if _, err = c.SearchByLogon("new.hire"); err == nil {
+		t.Error("SearchByLogon() expected error for deleted user")
+	}
+	if err = c.DeleteUser(dn); err == nil {
+		t.Error("DeleteUser() expected error for missing user")
+	}
+}
@@ -0,0 +1,265 @@
+package ldap
+
+// noinspection GoRedundantImportAlias
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strings"
+
+	ldap "github.com/go-ldap/ldap/v3"
+	"github.com/pkg/errors"
+)
+
+// View is a window of Size entries of the results sorted by Sort, read with the Server Side Sort and
+// Virtual List View controls. It starts at the 1-based Offset, or at the first entry whose first sort key
+// is not below StartsWith when that is set.
+type View struct {
+	Sort       []SortKey
+	Offset     int
+	StartsWith string
+	Size       int
+	// ContentCount is the list size Offset is relative to, the last ViewResult.ContentCount; 0 is the server count
+	ContentCount int
+	// Context is the one of the last ViewResult
+	Context []byte
+}
+
+// ViewResult places the window in the list
+type ViewResult struct {
+	// Offset is the 1-based position of the first entry
+	Offset int
+	// ContentCount is the server estimate of the list size
+	ContentCount int
+	Context      []byte
+}
+
+func (c *Client) GroupsView(v View) ([]Group, ViewResult, error) {
+	return c.GroupsViewContext(context.Background(), v)
+}
+
+// GroupsViewContext reads a window of the groups, sorted by name unless View.Sort says otherwise.
+func (c *Client) GroupsViewContext(ctx context.Context, v View) ([]Group, ViewResult, error) {
+	if c.isClosed() {
+		return nil, ViewResult{}, ErrClosed
+	}
+	s, err := c.schema(ctx)
+	if err != nil {
+		return nil, ViewResult{}, err
+	}
+	v = v.sortedBy(fieldAttributes(reflect.TypeOf(Group{}), s.GroupFields, "Name"))
+	entries, _, res, err := c.viewSearch(ctx, c.searchRequest(s.Groups.String(), c.groupAttributes(s)), v)
+	if err != nil {
+		return nil, ViewResult{}, err
+	}
+	groups := make([]Group, 0, len(entries))
+	for _, e := range entries {
+		groups = append(groups, mapToGroup(s, e))
+	}
+	return groups, res, nil
+}
+
+func (c *Client) OrganizationalUnitsView(v View) ([]Unit, ViewResult, error) {
+	return c.OrganizationalUnitsViewContext(context.Background(), v)
+}
+
+// OrganizationalUnitsViewContext reads a window of the units, sorted by name unless View.Sort says otherwise.
+func (c *Client) OrganizationalUnitsViewContext(ctx context.Context, v View) ([]Unit, ViewResult, error) {
+	if c.isClosed() {
+		return nil, ViewResult{}, ErrClosed
+	}
+	s, err := c.schema(ctx)
+	if err != nil {
+		return nil, ViewResult{}, err
+	}
+	v = v.sortedBy(fieldAttributes(reflect.TypeOf(Unit{}), s.UnitFields, "Name"))
+	entries, _, res, err := c.viewSearch(ctx, c.searchRequest(s.Units.String(), c.unitAttributes(s)), v)
+	if err != nil {
+		return nil, ViewResult{}, err
+	}
+	units := make([]Unit, 0, len(entries))
+	for _, e := range entries {
+		units = append(units, mapToUnit(s, e))
+	}
+	return units, res, nil
+}
+
+func (c *Client) GroupUsersView(nodeDN string, v View, mode ...MembershipMode) ([]User, ViewResult, error) {
+	return c.GroupUsersViewContext(context.Background(), nodeDN, v, mode...)
+}
+
+// GroupUsersViewContext reads a window of the users of nodeDN, sorted by name unless View.Sort says otherwise.
+// Member lists the server can not search by are sorted by the client.
+func (c *Client) GroupUsersViewContext(ctx context.Context, nodeDN string, v View,
+	mode ...MembershipMode) ([]User, ViewResult, error) {
+	if c.isClosed() {
+		return nil, ViewResult{}, ErrClosed
+	}
+	s, err := c.schema(ctx)
+	if err != nil {
+		return nil, ViewResult{}, err
+	}
+	v = v.sortedBy(fieldAttributes(reflect.TypeOf(User{}), s.UserFields, "Name"))
+	transitive := membership(mode) == Transitive
+	f, err := c.groupUsersFilter(ctx, s, nodeDN, transitive)
+	if err != nil {
+		return nil, ViewResult{}, err
+	}
+	var (
+		entries []*ldap.Entry
+		res     ViewResult
+	)
+	if f == nil {
+		if err = v.validate(); err != nil {
+			return nil, ViewResult{}, err
+		}
+		if entries, err = c.members(ctx, s, nodeDN, transitive); err != nil {
+			return nil, ViewResult{}, err
+		}
+		entries, res = localView(entries, v)
+	} else if entries, _, res, err = c.viewSearch(ctx, c.searchRequest(f.String(), c.userAttributes(s)), v); err != nil {
+		return nil, ViewResult{}, err
+	}
+	users := make([]User, 0, len(entries))
+	for _, e := range entries {
+		users = append(users, mapToUser(s, e))
+	}
+	return users, res, nil
+}
+
+// sortedBy sorts v by the first of attrs when it has no sort keys
+func (v View) sortedBy(attrs []string) View {
+	if len(v.Sort) == 0 && len(attrs) > 0 {
+		v.Sort = []SortKey{{Attribute: attrs[0]}}
+	}
+	return v
+}
+
+func (v View) validate() error {
+	if len(v.Sort) == 0 {
+		return errors.New("ldap view needs a sort key")
+	}
+	if v.Size <= 0 {
+		return errors.New("ldap view size must be positive")
+	}
+	return nil
+}
+
+func (v View) controls() []ldap.Control {
+	offset := v.Offset
+	if offset < 1 {
+		offset = 1
+	}
+	return []ldap.Control{NewControlSort(v.Sort...), &ControlVLV{
+		AfterCount:     v.Size - 1,
+		Offset:         offset,
+		ContentCount:   v.ContentCount,
+		GreaterOrEqual: v.StartsWith,
+		ContextID:      v.Context,
+		Criticality:    true,
+	}}
+}
+
+// viewSearch reads the window v of req in one request, the Virtual List View can not be paged
+func (c *Client) viewSearch(ctx context.Context, req *ldap.SearchRequest, v View) ([]*ldap.Entry, []ldap.Control,
+	ViewResult, error) {
+	if err := v.validate(); err != nil {
+		return nil, nil, ViewResult{}, err
+	}
+	r := *req
+	r.Controls = append(append([]ldap.Control(nil), req.Controls...), v.controls()...)
+	var sr *ldap.SearchResult
+	err := c.exec(ctx, func(con *ldap.Conn) (e error) {
+		sr, e = con.Search(&r)
+		return
+	})
+	if err != nil {
+		return nil, nil, ViewResult{}, errors.Wrap(err, "ldap view")
+	}
+	controls, err := decodeControls(sr.Controls)
+	if err != nil {
+		return nil, nil, ViewResult{}, err
+	}
+	resp, ok := ldap.FindControl(controls, ControlTypeVLVResponse).(*ControlVLVResponse)
+	if !ok {
+		return nil, nil, ViewResult{}, errors.New("ldap view: no virtual list view response")
+	}
+	if resp.Result != ldap.LDAPResultSuccess {
+		return nil, nil, ViewResult{}, errors.Wrap(ldapError(ldap.NewError(resp.Result,
+			errors.New("virtual list view failed"))), "ldap view")
+	}
+	entries := sr.Entries
+	if len(entries) > v.Size {
+		entries = entries[:v.Size]
+	}
+	return entries, controls, ViewResult{
+		Offset:       resp.TargetPosition,
+		ContentCount: resp.ContentCount,
+		Context:      resp.ContextID,
+	}, nil
+}
+
+// localView is the window v of entries sorted by the client
+func localView(entries []*ldap.Entry, v View) ([]*ldap.Entry, ViewResult) {
+	sorted := append([]*ldap.Entry(nil), entries...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		for _, k := range v.Sort {
+			if r := compareSortValues(sortValue(sorted[i], k.Attribute), sortValue(sorted[j], k.Attribute)); r != 0 {
+				return (r < 0) != k.Reverse
+			}
+		}
+		return false
+	})
+	count := len(sorted)
+	pos := v.Offset
+	if pos < 1 {
+		pos = 1
+	}
+	if v.ContentCount > 0 {
+		// the offset is relative to the count the client knows, its last entry is the last one here
+		pos = 1 + (pos-1)*count/v.ContentCount
+		if v.Offset >= v.ContentCount {
+			pos = count
+		}
+	}
+	if pos > count {
+		pos = count
+	}
+	if v.StartsWith != "" {
+		k, from := v.Sort[0], strings.ToLower(v.StartsWith)
+		pos = 1 + sort.Search(count, func(i int) bool {
+			r := compareSortValues(sortValue(sorted[i], k.Attribute), &from)
+			return r == 0 || (r > 0) != k.Reverse
+		})
+	}
+	start := pos - 1
+	if start < 0 {
+		start = 0
+	}
+	end := minInt(start+v.Size, count)
+	if start > end {
+		start = end
+	}
+	return sorted[start:end], ViewResult{Offset: pos, ContentCount: count}
+}
+
+func sortValue(e *ldap.Entry, attr string) *string {
+	if a := attribute(e, attr); a != nil && len(a.Values) > 0 {
+		v := strings.ToLower(a.Values[0])
+		return &v
+	}
+	return nil
+}
+
+// compareSortValues orders missing values after all others, as servers do
+func compareSortValues(a, b *string) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return 1
+	case b == nil:
+		return -1
+	}
+	return strings.Compare(*a, *b)
+}
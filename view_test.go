@@ -0,0 +1,181 @@
+package ldap
+
+import (
+	"reflect"
+	"testing"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	ldap "github.com/go-ldap/ldap/v3"
+	"github.com/shubinmi/ldap/ldaptest"
+)
+
+func TestClient_View(t *testing.T) {
+	srv := testServer(t, ldaptest.WithLDIFFile(testDirectory))
+	defer srv.Close()
+	c := testClient(t, srv)
+	defer c.Close()
+
+	units := func(v View) ([]string, ViewResult, error) {
+		us, res, err := c.OrganizationalUnitsView(v)
+		names := make([]string, 0, len(us))
+		for _, u := range us {
+			names = append(names, u.Name)
+		}
+		return names, res, err
+	}
+	groups := func(v View) ([]string, ViewResult, error) {
+		gs, res, err := c.GroupsView(v)
+		names := make([]string, 0, len(gs))
+		for _, g := range gs {
+			names = append(names, g.Name)
+		}
+		return names, res, err
+	}
+	members := func(v View) ([]string, ViewResult, error) {
+		us, res, err := c.GroupUsersView("CN=Clients,OU=Products,OU=Service Accounts,DC=corp,DC=test,DC=com", v)
+		names := make([]string, 0, len(us))
+		for _, u := range us {
+			names = append(names, u.Name)
+		}
+		return names, res, err
+	}
+	tests := []struct {
+		name    string
+		view    func(v View) ([]string, ViewResult, error)
+		v       View
+		want    []string
+		wantRes ViewResult
+		wantErr bool
+	}{
+		{name: "units first window", view: units, v: View{Size: 2},
+			want: []string{"Products", "Service Accounts"}, wantRes: ViewResult{Offset: 1, ContentCount: 6}},
+		{name: "units by offset", view: units, v: View{Offset: 3, Size: 2},
+			want: []string{"St-Petersburg", "Staff"}, wantRes: ViewResult{Offset: 3, ContentCount: 6}},
+		{name: "units by stale count", view: units, v: View{Offset: 6, ContentCount: 12, Size: 2},
+			want: []string{"St-Petersburg", "Staff"}, wantRes: ViewResult{Offset: 3, ContentCount: 6}},
+		{name: "units last offset", view: units, v: View{Offset: 12, ContentCount: 12, Size: 2},
+			want: []string{"Users"}, wantRes: ViewResult{Offset: 6, ContentCount: 6}},
+		{name: "units starts with", view: units, v: View{StartsWith: "t", Size: 5},
+			want: []string{"TestGroup", "Users"}, wantRes: ViewResult{Offset: 5, ContentCount: 6}},
+		{name: "units reverse", view: units, v: View{Sort: []SortKey{{Attribute: "ou", Reverse: true}}, Size: 2},
+			want: []string{"Users", "TestGroup"}, wantRes: ViewResult{Offset: 1, ContentCount: 6}},
+		{name: "units past the end", view: units, v: View{StartsWith: "z", Size: 2},
+			want: []string{}, wantRes: ViewResult{Offset: 7, ContentCount: 6}},
+		{name: "groups", view: groups, v: View{Offset: 2, Size: 5},
+			want: []string{"Staff"}, wantRes: ViewResult{Offset: 2, ContentCount: 2}},
+		{name: "group users", view: members, v: View{Sort: []SortKey{{Attribute: "cn", Reverse: true}}, Size: 2},
+			want: []string{"Test User", "Test 2"}, wantRes: ViewResult{Offset: 1, ContentCount: 3}},
+		{name: "no size", view: units, v: View{}, wantErr: true},
+	}
+	for _, test := range tests {
+		tt := test
+		t.Run(tt.name, func(t *testing.T) {
+			got, res, err := tt.view(tt.v)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("view error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("view got = %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(res, tt.wantRes) {
+				t.Errorf("view result = %+v, want %+v", res, tt.wantRes)
+			}
+		})
+	}
+
+	ous := Eq("objectClass", "organizationalUnit").String()
+	sorted, err := c.SearchWithOptions(ous, SearchOptions{Attributes: []string{"ou"},
+		Sort: []SortKey{{Attribute: "ou", Reverse: true}}})
+	if err != nil {
+		t.Fatalf("SearchWithOptions() sorted unexpected error = %v", err)
+	}
+	if len(sorted.Entries) != 6 || sorted.Entries[0]["ou"].([]string)[0] != "Users" {
+		t.Errorf("SearchWithOptions() sorted got = %v", sorted.Entries)
+	}
+	if r, ok := ldap.FindControl(sorted.Controls, ControlTypeSortResult).(*ControlSortResult); !ok || r.Result != 0 {
+		t.Errorf("SearchWithOptions() sort result = %v", sorted.Controls)
+	}
+	window, err := c.SearchWithOptions(ous, SearchOptions{Attributes: []string{"ou"},
+		Sort: []SortKey{{Attribute: "ou"}}, View: &View{Offset: 6, Size: 3}})
+	if err != nil {
+		t.Fatalf("SearchWithOptions() view unexpected error = %v", err)
+	}
+	if len(window.Entries) != 1 || window.Entries[0]["ou"].([]string)[0] != "Users" ||
+		window.View.Offset != 6 || window.View.ContentCount != 6 {
+		t.Errorf("SearchWithOptions() view got = %v, %+v", window.Entries, window.View)
+	}
+	if _, err = c.SearchWithOptions(ous, SearchOptions{View: &View{Size: 1}}); err == nil {
+		t.Error("SearchWithOptions() expected error for a view without sort keys")
+	}
+	if _, err = c.SearchPaged(ous, 1, SearchOptions{View: &View{Size: 1}}); err == nil {
+		t.Error("SearchPaged() expected error for a view")
+	}
+}
+
+func TestLocalView(t *testing.T) {
+	entries := []*ldap.Entry{
+		ldap.NewEntry("cn=c", map[string][]string{"cn": {"C"}, "sn": {"2"}}),
+		ldap.NewEntry("cn=a", map[string][]string{"cn": {"a"}, "sn": {"2"}}),
+		ldap.NewEntry("cn=x", map[string][]string{"sn": {"1"}}),
+		ldap.NewEntry("cn=b", map[string][]string{"cn": {"B"}, "sn": {"1"}}),
+	}
+	tests := []struct {
+		name    string
+		v       View
+		want    []string
+		wantRes ViewResult
+	}{
+		{name: "missing last", v: View{Sort: []SortKey{{Attribute: "cn"}}, Size: 4},
+			want: []string{"cn=a", "cn=b", "cn=c", "cn=x"}, wantRes: ViewResult{Offset: 1, ContentCount: 4}},
+		{name: "two keys", v: View{Sort: []SortKey{{Attribute: "sn"}, {Attribute: "cn", Reverse: true}}, Size: 4},
+			want: []string{"cn=x", "cn=b", "cn=c", "cn=a"}, wantRes: ViewResult{Offset: 1, ContentCount: 4}},
+		{name: "offset", v: View{Sort: []SortKey{{Attribute: "cn"}}, Offset: 2, Size: 2},
+			want: []string{"cn=b", "cn=c"}, wantRes: ViewResult{Offset: 2, ContentCount: 4}},
+		{name: "starts with", v: View{Sort: []SortKey{{Attribute: "cn"}}, StartsWith: "b", Size: 1},
+			want: []string{"cn=b"}, wantRes: ViewResult{Offset: 2, ContentCount: 4}},
+		{name: "reverse starts with", v: View{Sort: []SortKey{{Attribute: "cn", Reverse: true}}, StartsWith: "bb", Size: 2},
+			want: []string{"cn=b", "cn=a"}, wantRes: ViewResult{Offset: 3, ContentCount: 4}},
+	}
+	for _, test := range tests {
+		tt := test
+		t.Run(tt.name, func(t *testing.T) {
+			got, res := localView(entries, tt.v)
+			dns := make([]string, 0, len(got))
+			for _, e := range got {
+				dns = append(dns, e.DN)
+			}
+			if !reflect.DeepEqual(dns, tt.want) {
+				t.Errorf("localView() got = %v, want %v", dns, tt.want)
+			}
+			if !reflect.DeepEqual(res, tt.wantRes) {
+				t.Errorf("localView() result = %+v, want %+v", res, tt.wantRes)
+			}
+		})
+	}
+}
+
+func TestDecodeControls(t *testing.T) {
+	want := []ldap.Control{
+		&ControlSortResult{Result: 16, Attribute: "sn"},
+		&ControlVLVResponse{TargetPosition: 37, ContentCount: 1200, ContextID: []byte("ctx")},
+		ldap.NewControlPaging(0),
+	}
+	controls := make([]ldap.Control, 0, len(want))
+	for _, c := range want {
+		d, err := ldap.DecodeControl(ber.DecodePacket(c.Encode().Bytes()))
+		if err != nil {
+			t.Fatalf("DecodeControl() unexpected error = %v", err)
+		}
+		controls = append(controls, d)
+	}
+	got, err := decodeControls(controls)
+	if err != nil {
+		t.Fatalf("decodeControls() unexpected error = %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("decodeControls() got = %v, want %v", got, want)
+	}
+}
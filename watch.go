@@ -0,0 +1,341 @@
+package ldap
+
+// noinspection GoRedundantImportAlias
+import (
+	"context"
+	"strings"
+	"time"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	ldap "github.com/go-ldap/ldap/v3"
+	"github.com/pkg/errors"
+)
+
+const (
+	watchRetry     = 100 * time.Millisecond
+	maxWatchRetry  = 30 * time.Second
+	anyObjectClass = "(objectClass=*)"
+)
+
+// watchAttributes tell AD notifications apart, AD has no entry change control
+var watchAttributes = []string{"uSNCreated", "uSNChanged", "isDeleted", "lastKnownParent"}
+
+// Event is a change of an entry Watch was notified about
+type Event struct {
+	Kind ChangeKind
+	DN   string
+	// PreviousDN is the DN before a rename
+	PreviousDN string
+	// Entry is the entry after the change the way Search returns it, the last state for deletions
+	Entry map[string]interface{}
+	// Err tells the subscription was lost, the changes until Watch subscribes again are missed
+	Err error
+}
+
+type watch struct {
+	c      *Client
+	base   string
+	filter string
+	ad     bool
+}
+
+// Watch sends the changes of the entries under baseDN that match filter until ctx is done or the client is closed,
+// then closes the channel. AD is asked with the LDAP_SERVER_NOTIFICATION_OID control, it takes no filter, so
+// every notified entry is checked against filter with a search; other servers with the Persistent Search control.
+// A lost connection is reported with an Event of Err and subscribed again with the pool credentials.
+func (c *Client) Watch(ctx context.Context, baseDN, filter string) (<-chan Event, error) {
+	if c.isClosed() {
+		return nil, ErrClosed
+	}
+	if baseDN == "" {
+		baseDN = c.opt.dn
+	}
+	if filter == "" {
+		filter = anyObjectClass
+	}
+	if _, err := ldap.CompileFilter(filter); err != nil {
+		return nil, errors.Wrap(err, "ldap watch")
+	}
+	dse, err := c.rootDSE(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ent, err := c.rootDSEEntry(ctx, "supportedControl")
+	if err != nil {
+		return nil, err
+	}
+	supported := make(map[string]bool)
+	for _, v := range ent.GetAttributeValues("supportedControl") {
+		supported[strings.TrimSpace(v)] = true
+	}
+	w := &watch{c: c, base: baseDN, filter: filter}
+	switch {
+	case dse.activeDirectory && supported[ldap.ControlTypeMicrosoftNotification]:
+		w.ad = true
+	case !supported[ControlTypePersistentSearch]:
+		return nil, ErrWatchNotSupported
+	}
+	con, err := w.subscribe(ctx)
+	if err != nil {
+		return nil, err
+	}
+	events := make(chan Event)
+	go w.run(ctx, con, events)
+	return events, nil
+}
+
+func (w *watch) run(ctx context.Context, con *rawConn, events chan<- Event) {
+	defer close(events)
+	for {
+		err := w.read(ctx, con, events)
+		con.close()
+		if w.stopped(ctx) || !w.send(ctx, events, Event{Err: err}) {
+			return
+		}
+		if con = w.resubscribe(ctx); con == nil {
+			return
+		}
+	}
+}
+
+func (w *watch) resubscribe(ctx context.Context) *rawConn {
+	retry := watchRetry
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-w.c.pool.done:
+			return nil
+		case <-time.After(retry):
+		}
+		if con, err := w.subscribe(ctx); err == nil {
+			return con
+		}
+		if retry *= 2; retry > maxWatchRetry {
+			retry = maxWatchRetry
+		}
+	}
+}
+
+func (w *watch) subscribe(ctx context.Context) (*rawConn, error) {
+	con, err := w.c.dialRaw(ctx, w.c.opt.usr, w.c.opt.pass)
+	if err != nil {
+		return nil, errors.Wrap(err, "ldap watch")
+	}
+	filter, attrs := w.filter, defaultAttributes
+	var control ldap.Control = &ControlPersistentSearch{
+		ChangeTypes: PersistentSearchAdd | PersistentSearchDelete | PersistentSearchModify | PersistentSearchModDN,
+		ChangesOnly: true, ReturnECs: true, Criticality: true,
+	}
+	if w.ad {
+		filter, attrs = anyObjectClass, append(append([]string{}, defaultAttributes...), watchAttributes...)
+		control = ldap.NewControlMicrosoftNotification()
+	}
+	f, err := ldap.CompileFilter(filter)
+	if err != nil {
+		con.close()
+		return nil, errors.Wrap(err, "ldap watch")
+	}
+	op := searchOp(w.base, ldap.ScopeWholeSubtree, f, attrs)
+	controls := []ldap.Control{control}
+	if w.ad {
+		// deletions are notified with the tombstone
+		controls = append(controls, ldap.NewControlMicrosoftShowDeleted())
+	}
+	if err = con.send(op, controls...); err == nil {
+		con.search = con.id
+		err = con.ack(w.c.opt.timeout)
+	}
+	if err != nil {
+		con.close()
+		return nil, errors.Wrap(err, "ldap watch")
+	}
+	return con, nil
+}
+
+// ack waits for a RootDSE read sent after the watching search. Servers answer the requests of a connection
+// in order, so the search is registered once the read is done and no change made after that is missed.
+func (w *rawConn) ack(timeout time.Duration) error {
+	op := searchOp("", ldap.ScopeBaseObject,
+		ber.NewString(ber.ClassContext, ber.TypePrimitive, ldap.FilterPresent, "objectClass", "Present"), []string{"1.1"})
+	if err := w.conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return err
+	}
+	if err := w.send(op); err != nil {
+		return err
+	}
+	for {
+		p, err := ber.ReadPacket(w.conn)
+		if err != nil {
+			return err
+		}
+		if len(p.Children) < 2 {
+			return errors.New("ldap malformed message")
+		}
+		switch id, op := berInt(p.Children[0]), p.Children[1]; {
+		case id == w.id && op.Tag == ldap.ApplicationSearchResultDone:
+			if err = resultError(op); err != nil {
+				return err
+			}
+			return w.conn.SetDeadline(time.Time{})
+		case id == w.id:
+		case id == w.search && op.Tag == ldap.ApplicationSearchResultDone:
+			// the server refused the watching search
+			if err = resultError(op); err == nil {
+				err = errors.New("ldap the server ended the search")
+			}
+			return err
+		default:
+			w.pending = append(w.pending, p)
+		}
+	}
+}
+
+func searchOp(base string, scope int, filter *ber.Packet, attrs []string) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchRequest, nil, "Search Request")
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, base, "Base DN"))
+	op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, uint64(scope), "Scope"))
+	op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, uint64(ldap.NeverDerefAliases), "Deref Aliases"))
+	op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, 0, "Size Limit"))
+	op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, 0, "Time Limit"))
+	op.AppendChild(ber.NewBoolean(ber.ClassUniversal, ber.TypePrimitive, ber.TagBoolean, false, "Types Only"))
+	op.AppendChild(filter)
+	list := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attributes")
+	for _, a := range attrs {
+		list.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, a, "Attribute"))
+	}
+	op.AppendChild(list)
+	return op
+}
+
+// next is the next message of the watching search
+func (w *rawConn) next() (*ber.Packet, error) {
+	if len(w.pending) > 0 {
+		p := w.pending[0]
+		w.pending = w.pending[1:]
+		return p, nil
+	}
+	return ber.ReadPacket(w.conn)
+}
+
+// read sends the notified changes until the search ends, the connection breaks or the watch is stopped
+func (w *watch) read(ctx context.Context, con *rawConn, events chan<- Event) error {
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-w.c.pool.done:
+		case <-stop:
+			return
+		}
+		con.close()
+	}()
+	for {
+		p, err := con.next()
+		if err != nil {
+			return errors.Wrap(err, "ldap watch")
+		}
+		if len(p.Children) < 2 {
+			return errors.New("ldap watch: malformed message")
+		}
+		switch op := p.Children[1]; op.Tag {
+		case ldap.ApplicationSearchResultEntry:
+			ev, ok := w.event(ctx, p)
+			if ok && !w.send(ctx, events, ev) {
+				return ctx.Err()
+			}
+		case ldap.ApplicationSearchResultReference:
+		default:
+			// the search is done only when the server gives up on it, a notice of disconnection ends it too
+			if err = resultError(op); err == nil {
+				err = errors.New("ldap watch: the server ended the search")
+			}
+			return errors.Wrap(err, "ldap watch")
+		}
+	}
+}
+
+func (w *watch) event(ctx context.Context, p *ber.Packet) (Event, bool) {
+	e := decodeEntry(p.Children[1])
+	if e == nil {
+		return Event{}, false
+	}
+	ev := Event{Kind: ChangeModified, DN: e.DN, Entry: entryMap(e)}
+	if !w.ad {
+		var controls []ldap.Control
+		if len(p.Children) > 2 && p.Children[2].Tag == 0 {
+			for _, c := range p.Children[2].Children {
+				if ctrl, err := ldap.DecodeControl(c); err == nil {
+					controls = append(controls, ctrl)
+				}
+			}
+		}
+		controls, _ = decodeControls(controls)
+		if ec, ok := ldap.FindControl(controls, ControlTypeEntryChange).(*ControlEntryChange); ok {
+			switch ec.ChangeType {
+			case PersistentSearchAdd:
+				ev.Kind = ChangeAdded
+			case PersistentSearchDelete:
+				ev.Kind = ChangeDeleted
+			case PersistentSearchModDN:
+				ev.Kind, ev.PreviousDN = ChangeRenamed, ec.PreviousDN
+			}
+		}
+		return ev, true
+	}
+	if strings.EqualFold(firstValue(e, "isDeleted"), "TRUE") {
+		// tombstones keep too few attributes to match the filter
+		ev.Kind, ev.DN = ChangeDeleted, deletedDN(e.DN, firstValue(e, "lastKnownParent"))
+		return ev, true
+	}
+	if created := firstValue(e, "uSNCreated"); created != "" && created == firstValue(e, "uSNChanged") {
+		ev.Kind = ChangeAdded
+	}
+	if w.filter == anyObjectClass {
+		return ev, true
+	}
+	sr, err := w.c.search(ctx, ldap.NewSearchRequest(e.DN, ldap.ScopeBaseObject, ldap.NeverDerefAliases, 1,
+		timeLimit(w.c.opt.timeout), false, w.filter, []string{"1.1"}, nil))
+	return ev, err == nil && len(sr.Entries) > 0
+}
+
+func (w *watch) send(ctx context.Context, events chan<- Event, ev Event) bool {
+	select {
+	case events <- ev:
+		return true
+	case <-ctx.Done():
+	case <-w.c.pool.done:
+	}
+	return false
+}
+
+func (w *watch) stopped(ctx context.Context) bool {
+	select {
+	case <-ctx.Done():
+		return true
+	case <-w.c.pool.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func decodeEntry(op *ber.Packet) *ldap.Entry {
+	if len(op.Children) < 2 {
+		return nil
+	}
+	e := &ldap.Entry{DN: op.Children[0].Data.String()}
+	for _, a := range op.Children[1].Children {
+		if len(a.Children) < 2 {
+			continue
+		}
+		attr := &ldap.EntryAttribute{Name: a.Children[0].Data.String()}
+		for _, v := range a.Children[1].Children {
+			attr.Values = append(attr.Values, v.Data.String())
+			attr.ByteValues = append(attr.ByteValues, v.ByteValue)
+		}
+		e.Attributes = append(e.Attributes, attr)
+	}
+	return e
+}
@@ -0,0 +1,117 @@
+package ldap
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/shubinmi/ldap/ldaptest"
+)
+
+func TestClient_Watch(t *testing.T) {
+	const (
+		staff   = "OU=Staff,DC=corp,DC=test,DC=com"
+		group   = "CN=Clients,OU=Products,OU=Service Accounts,DC=corp,DC=test,DC=com"
+		member  = "CN=Test 2,OU=TestGroup," + staff
+		created = "CN=New Hire,OU=Users,OU=St-Petersburg," + staff
+	)
+	tests := []struct {
+		name string
+		dse  map[string][]string
+	}{
+		{name: "persistent search"},
+		{name: "active directory", dse: map[string][]string{"supportedCapabilities": {capActiveDirectory}}},
+	}
+	for _, test := range tests {
+		tt := test
+		t.Run(tt.name, func(t *testing.T) {
+			srv := testServer(t, ldaptest.WithLDIFFile(testDirectory), ldaptest.WithRootDSE(tt.dse))
+			defer srv.Close()
+			c := testClient(t, srv)
+			defer c.Close()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			events, err := c.Watch(ctx, "", "(|(objectClass=group)(cn=New Hire))")
+			if err != nil {
+				t.Fatalf("Watch() unexpected error = %v", err)
+			}
+			next := func(wait time.Duration) (Event, bool) {
+				select {
+				case ev, ok := <-events:
+					if !ok {
+						t.Fatal("Watch() channel closed")
+					}
+					return ev, true
+				case <-time.After(wait):
+					return Event{}, false
+				}
+			}
+			// CreateUser sets the password and enables the account after the add, those are modifications
+			expect := func(kind ChangeKind, dn string) {
+				ev, ok := next(5 * time.Second)
+				for ok && ev.Kind == ChangeModified && kind != ChangeModified && ev.DN == dn {
+					ev, ok = next(5 * time.Second)
+				}
+				if !ok || ev.Err != nil || ev.Kind != kind || ev.DN != dn || ev.Entry == nil {
+					t.Fatalf("Watch() got = %+v, want %v of %s", ev, kind, dn)
+				}
+			}
+
+			// the filter excludes the user, so the group change is the first event
+			if err = c.UpdateUser(User{DN: "CN=Test 1,OU=TestGroup," + staff, Mail: "test.1@test.com"}, nil); err != nil {
+				t.Fatalf("UpdateUser() unexpected error = %v", err)
+			}
+			if err = c.RemoveGroupMember(group, member); err != nil {
+				t.Fatalf("RemoveGroupMember() unexpected error = %v", err)
+			}
+			expect(ChangeModified, group)
+			if err = c.CreateUser(User{DN: created, Name: "New Hire", Logon: "new.hire"}, "newPass1!", nil); err != nil {
+				t.Fatalf("CreateUser() unexpected error = %v", err)
+			}
+			expect(ChangeAdded, created)
+			if err = c.DeleteUser(created); err != nil {
+				t.Fatalf("DeleteUser() unexpected error = %v", err)
+			}
+			expect(ChangeDeleted, created)
+
+			srv.DropConnections()
+			if ev, ok := next(5 * time.Second); !ok || ev.Err == nil {
+				t.Fatalf("Watch() after a dropped connection got = %+v", ev)
+			}
+			for deadline := time.Now().Add(5 * time.Second); srv.Watches() == 0; time.Sleep(10 * time.Millisecond) {
+				if time.Now().After(deadline) {
+					t.Fatal("Watch() did not subscribe again")
+				}
+			}
+			if err = c.AddGroupMember(group, member); err != nil {
+				t.Fatalf("AddGroupMember() unexpected error = %v", err)
+			}
+			expect(ChangeModified, group)
+
+			cancel()
+			for {
+				select {
+				case _, ok := <-events:
+					if !ok {
+						return
+					}
+				case <-time.After(5 * time.Second):
+					t.Fatal("Watch() channel is not closed after cancel")
+				}
+			}
+		})
+	}
+}
+
+func TestClient_WatchErrors(t *testing.T) {
+	c, closeAll := writeClient(t, map[string][]string{"supportedControl": {"1.2.840.113556.1.4.319"}})
+	defer closeAll()
+	if _, err := c.Watch(context.Background(), "", "(cn=Test"); err == nil {
+		t.Error("Watch() expected error for a malformed filter")
+	}
+	if _, err := c.Watch(context.Background(), "", ""); !errors.Is(err, ErrWatchNotSupported) {
+		t.Errorf("Watch() error = %v, want %v", err, ErrWatchNotSupported)
+	}
+}